@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
+)
+
+// Admin bot allows superusers to manage bots at runtime: "bot! list", "bot! on name", "bot! off name" and "bot! status",
+// to see history of bans with "bans!" and to reload data files of bots with "reload!"
+type Admin struct {
+	superUser SuperUser
+	bots      []*Managed
+	reporters []StatusReporter
+	started   time.Time
+}
+
+// StatusReporter is implemented by components reporting their state in the chat for "bot! status",
+// i.e. OpenAI cooldown
+type StatusReporter interface {
+	Status(chatID int64) string
+}
+
+// BansReporter is implemented by components keeping history of bans for "bans!", i.e. telegram listener
+type BansReporter interface {
+	Bans(chatID int64) string
+}
+
+// Reloader is implemented by bots with data files reloaded by "reload!", i.e. sys bot. On error the bot keeps
+// the current data and the error reported to superuser.
+type Reloader interface {
+	Reload() error
+}
+
+// NewAdmin makes admin bot for given managed bots, reporters add their state to status.
+// Reporters implementing BansReporter answer "bans!".
+func NewAdmin(superUser SuperUser, bots []*Managed, reporters ...StatusReporter) *Admin {
+	log.Printf("[INFO] admin bot for %d bots, supers: %v", len(bots), superUser)
+	return &Admin{superUser: superUser, bots: bots, reporters: reporters, started: time.Now()}
+}
+
+// Commands returns admin command, hidden from menu as superusers only
+func (a *Admin) Commands() Commands {
+	return Commands{
+		{Triggers: []string{"bot!"}, Description: "управление ботами: list, on, off, status (только для админов)",
+			Args: true, Hidden: true},
+		{Triggers: []string{"bans!"}, Description: "активные и последние баны (только для админов)", Hidden: true},
+		{Triggers: []string{"reload!"}, Description: "перечитать файлы данных ботов (только для админов)", Hidden: true},
+	}
+}
+
+// Help returns help message
+func (a *Admin) Help() string {
+	return a.Commands().Help()
+}
+
+// ReactOn keys
+func (a *Admin) ReactOn() []string {
+	return a.Commands().ReactOn()
+}
+
+// OnMessage runs admin command requested by superuser
+func (a *Admin) OnMessage(msg Message) (response Response) {
+	cmd, ok := a.Commands().Match(msg.Text)
+	if !ok || !a.superUser.IsSuper(msg.From.Username) {
+		return Response{}
+	}
+	if cmd.Trigger == "bans!" {
+		return Response{Text: a.bans(msg.ChatID), Send: true}
+	}
+	if cmd.Trigger == "reload!" {
+		log.Printf("[INFO] reload of bots data requested by %s", msg.From.Username)
+		return Response{Text: a.reload(), Send: true}
+	}
+
+	args := strings.Fields(cmd.Args)
+	if len(args) == 0 {
+		return Response{Text: format.Markdown(format.Italic(format.Text("используй: bot! list | on <бот> | off <бот> | status"))), Send: true}
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "list":
+		return Response{Text: a.list(), Send: true}
+	case "status":
+		return Response{Text: a.status(msg.ChatID), Send: true}
+	case "on", "off":
+		if len(args) < 2 {
+			return Response{Text: format.Markdown(format.Italic(format.Text("не указан бот"))), Send: true}
+		}
+		enable := strings.EqualFold(args[0], "on")
+		b := a.find(args[1])
+		if b == nil {
+			return Response{Text: format.Markdown(format.Italic(format.Text("нет такого бота: " + args[1]))), Send: true}
+		}
+		b.SetEnabled(enable)
+		log.Printf("[INFO] bot %s enabled=%v by %s", b.Name(), enable, msg.From.Username)
+		state := "выключен"
+		if enable {
+			state = "включен"
+		}
+		return Response{Text: format.Markdown(format.Text(fmt.Sprintf("бот %s %s", b.Name(), state))), Send: true,
+			RefreshMenu: true}
+	}
+	return Response{Text: format.Markdown(format.Italic(format.Text("неизвестная команда: " + args[0]))), Send: true}
+}
+
+func (a *Admin) find(name string) *Managed {
+	for _, b := range a.bots {
+		if strings.EqualFold(b.Name(), name) {
+			return b
+		}
+	}
+	return nil
+}
+
+func (a *Admin) list() string {
+	sb := strings.Builder{}
+	for _, b := range a.bots {
+		mark := "✅"
+		if !b.Enabled() {
+			mark = "⛔️"
+		}
+		_, _ = sb.WriteString(format.Markdown(format.Text(mark + " " + b.Name() + "\n")))
+	}
+	return sb.String()
+}
+
+func (a *Admin) bans(chatID int64) string {
+	res := ""
+	for _, r := range a.reporters {
+		if br, ok := r.(BansReporter); ok {
+			res += br.Bans(chatID)
+		}
+	}
+	if res == "" {
+		return format.Markdown(format.Italic(format.Text("история банов не ведется")))
+	}
+	return res
+}
+
+// reload reloads data of all bots implementing Reloader, disabled ones as well, and reports results per bot
+func (a *Admin) reload() string {
+	sb := strings.Builder{}
+	for _, b := range a.bots {
+		r, ok := unwrap(b).(Reloader)
+		if !ok {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			log.Printf("[WARN] can't reload %s, %v", b.Name(), err)
+			_, _ = sb.WriteString(format.Markdown(format.Bold(format.Text(b.Name())),
+				format.Text(" не обновлен, данные прежние: "+err.Error()+"\n")))
+			continue
+		}
+		_, _ = sb.WriteString(format.Markdown(format.Bold(format.Text(b.Name())), format.Text(" обновлен\n")))
+	}
+	if sb.Len() == 0 {
+		return format.Markdown(format.Italic(format.Text("нечего перечитывать")))
+	}
+	return sb.String()
+}
+
+func (a *Admin) status(chatID int64) string {
+	sb := strings.Builder{}
+	_, _ = sb.WriteString(format.Markdown(format.Bold(format.Text("работаю")), format.Text(" "+HumanizeDuration(time.Since(a.started))+"\n")))
+
+	off := []string{}
+	for _, b := range a.bots {
+		if !b.Enabled() {
+			off = append(off, b.Name())
+		}
+	}
+	if len(off) > 0 {
+		_, _ = sb.WriteString(format.Markdown(format.Bold(format.Text("выключены:")), format.Text(" "+strings.Join(off, ", ")+"\n")))
+	}
+
+	for _, b := range a.bots {
+		if err, ts := b.LastError(); err != nil {
+			_, _ = sb.WriteString(format.Markdown(format.Bold(format.Text(b.Name())),
+				format.Text(fmt.Sprintf(" %s назад: %s\n", HumanizeDuration(time.Since(ts)), err.Error()))))
+		}
+	}
+
+	for _, r := range a.reporters {
+		if st := r.Status(chatID); st != "" {
+			_, _ = sb.WriteString(st)
+			if !strings.HasSuffix(st, "\n") {
+				_, _ = sb.WriteString("\n")
+			}
+		}
+	}
+	return sb.String()
+}
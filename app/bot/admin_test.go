@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestAdmin_OnMessage(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	news := NewManaged("news", &InterfaceMock{
+		OnMessageFunc: func(m Message) Response { return Response{Send: true, Text: "news"} },
+		HelpFunc:      func() string { return "news help" },
+	})
+	gpt := NewManaged("openai", &InterfaceMock{})
+	st := &statusMock{status: "*ChatGPT* доступен"}
+	a := NewAdmin(su, []*Managed{news, gpt}, st)
+
+	assert.Equal(t, Response{}, a.OnMessage(Message{Text: "bot! off news", From: User{Username: "user"}}), "not super")
+	assert.True(t, news.Enabled())
+
+	resp := a.OnMessage(Message{Text: "bot! off News", From: User{Username: "admin"}})
+	assert.Equal(t, Response{Text: "бот news выключен", Send: true, RefreshMenu: true}, resp)
+	assert.False(t, news.Enabled())
+	assert.Equal(t, Response{}, news.OnMessage(Message{Text: "news!"}))
+	assert.Equal(t, "", news.Help())
+
+	resp = a.OnMessage(Message{Text: "bot! list", From: User{Username: "admin"}})
+	assert.Equal(t, Response{Text: "⛔️ news\n✅ openai\n", Send: true}, resp)
+
+	resp = a.OnMessage(Message{Text: "/bot status", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "*работаю* пару секунд\n*выключены:* news\n*ChatGPT* доступен\n", Send: true}, resp)
+	assert.Equal(t, int64(123), st.chatID, "status of the chat asked")
+
+	resp = a.OnMessage(Message{Text: "bot! on news", From: User{Username: "admin"}})
+	assert.Equal(t, Response{Text: "бот news включен", Send: true, RefreshMenu: true}, resp)
+	assert.Equal(t, Response{Send: true, Text: "news"}, news.OnMessage(Message{Text: "news!"}))
+
+	resp = a.OnMessage(Message{Text: "bot! off blah", From: User{Username: "admin"}})
+	assert.Equal(t, Response{Text: "_нет такого бота: blah_", Send: true}, resp)
+	resp = a.OnMessage(Message{Text: "bot! off", From: User{Username: "admin"}})
+	assert.Equal(t, Response{Text: "_не указан бот_", Send: true}, resp)
+	resp = a.OnMessage(Message{Text: "bot! blah", From: User{Username: "admin"}})
+	assert.Equal(t, Response{Text: "_неизвестная команда: blah_", Send: true}, resp)
+}
+
+func TestAdmin_StatusWithErrors(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return true }}
+	slow := NewManaged("slow_bot", &InterfaceMock{OnMessageFunc: func(m Message) Response {
+		time.Sleep(100 * time.Millisecond)
+		return Response{Send: true}
+	}})
+	mb := MultiBot{Bots: []Interface{slow}, Timeout: 10 * time.Millisecond}
+	assert.Empty(t, mb.OnMessages(context.Background(), Message{Text: "ping"}))
+
+	err, ts := slow.LastError()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.WithinDuration(t, time.Now(), ts, time.Second)
+
+	a := NewAdmin(su, []*Managed{slow})
+	resp := a.OnMessage(Message{Text: "bot! status"})
+	assert.Contains(t, resp.Text, "*slow\\_bot* пару секунд назад: no answer on \"ping\" in time: context deadline exceeded\n")
+
+	failed := NewManaged("news", &InterfaceMock{OnMessageFunc: func(m Message) Response {
+		return Response{Error: errors.New("failed to send request")}
+	}})
+	assert.Equal(t, Response{Error: errors.New("failed to send request")}, failed.OnMessage(Message{Text: "news!"}))
+	resp = NewAdmin(su, []*Managed{failed}).OnMessage(Message{Text: "bot! status"})
+	assert.Contains(t, resp.Text, "*news* пару секунд назад: failed to send request\n", "failure reported by bot")
+}
+
+func TestAdmin_Bans(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	a := NewAdmin(su, nil, &statusMock{status: "ok"}, &bansMock{})
+
+	assert.Equal(t, Response{}, a.OnMessage(Message{Text: "bans!", ChatID: 1, From: User{Username: "user"}}), "not super")
+	assert.Equal(t, Response{Text: "bans of 123", Send: true}, a.OnMessage(Message{Text: "/bans", ChatID: 123, From: User{Username: "admin"}}))
+
+	a = NewAdmin(su, nil, &statusMock{status: "ok"})
+	assert.Equal(t, Response{Text: "_история банов не ведется_", Send: true},
+		a.OnMessage(Message{Text: "bans!", ChatID: 123, From: User{Username: "admin"}}))
+}
+
+func TestAdmin_Reload(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	good, bad := &reloaderMock{}, &reloaderMock{err: errors.New("bad lines in basic.data: line 2: empty triggers or message")}
+	a := NewAdmin(su, []*Managed{NewManaged("sys", good), NewManaged("news", &InterfaceMock{}),
+		NewManaged("time", ContextAdapter{Interface: bad})})
+
+	assert.Equal(t, Response{}, a.OnMessage(Message{Text: "reload!", From: User{Username: "user"}}), "not super")
+	assert.Equal(t, 0, good.reloads)
+
+	resp := a.OnMessage(Message{Text: "reload!", From: User{Username: "admin"}})
+	assert.Equal(t, Response{Text: "*sys* обновлен\n*time* не обновлен, данные прежние: bad lines in basic\\.data: " +
+		"line 2: empty triggers or message\n", Send: true}, resp)
+	assert.Equal(t, 1, good.reloads)
+	assert.Equal(t, 1, bad.reloads)
+
+	a = NewAdmin(su, []*Managed{NewManaged("news", &InterfaceMock{})})
+	assert.Equal(t, Response{Text: "_нечего перечитывать_", Send: true},
+		a.OnMessage(Message{Text: "/reload", From: User{Username: "admin"}}))
+}
+
+type reloaderMock struct {
+	InterfaceMock
+	err     error
+	reloads int
+}
+
+func (r *reloaderMock) Reload() error {
+	r.reloads++
+	return r.err
+}
+
+type statusMock struct {
+	status string
+	chatID int64
+}
+
+func (s *statusMock) Status(chatID int64) string {
+	s.chatID = chatID
+	return s.status
+}
+
+type bansMock struct{}
+
+func (b *bansMock) Status(int64) string { return "" }
+
+func (b *bansMock) Bans(chatID int64) string { return fmt.Sprintf("bans of %d", chatID) }
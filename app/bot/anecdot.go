@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -9,6 +10,8 @@ import (
 	"time"
 
 	"github.com/go-pkgz/lcw"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // Anecdote bot, returns from https://jokesrv.rubedo.cloud/
@@ -26,42 +29,52 @@ func NewAnecdote(client HTTPClient) *Anecdote {
 
 // Help returns help message
 func (a Anecdote) Help() string {
-	return GenHelpMsg(a.ReactOn(), "расскажет анекдот или шутку")
+	return a.Commands().Help()
 }
 
-// OnMessage returns one entry
-func (a Anecdote) OnMessage(msg Message) (response Response) {
+// Commands returns joke command with triggers for all categories
+func (a Anecdote) Commands() Commands {
+	return a.commands(context.Background())
+}
 
-	if !contains(a.ReactOn(), msg.Text) {
-		return Response{}
+func (a Anecdote) commands(ctx context.Context) Commands {
+	cc, err := a.categories(ctx)
+	if err != nil {
+		log.Printf("[WARN] category retrival failed, %v", err)
 	}
+	return Commands{{Triggers: append([]string{"анекдот!", "анкедот!", "joke!", "chuck!"}, cc...), Description: "расскажет анекдот или шутку"}}
+}
 
-	if contains([]string{"chuck!", "/chuck"}, msg.Text) {
-		return a.chuck()
-	}
+// OnMessage returns one entry
+func (a Anecdote) OnMessage(msg Message) (response Response) {
+	return a.OnMessageContext(context.Background(), msg)
+}
 
-	cc, err := a.categories()
-	if err != nil {
-		log.Printf("[WARN] category retrival failed, %v", err)
+// OnMessageContext returns one entry, requests to jokes services canceled with ctx
+func (a Anecdote) OnMessageContext(ctx context.Context, msg Message) (response Response) {
+
+	cmd, ok := a.commands(ctx).Match(msg.Text)
+	if !ok {
+		return Response{}
 	}
 
-	switch {
-	case contains([]string{"chuck!", "/chuck"}, msg.Text):
-		return a.chuck()
-	case contains(cc, msg.Text):
-		return a.jokesrv(strings.TrimSuffix(strings.TrimPrefix(msg.Text, "/"), "!"))
-	default:
-		return a.jokesrv("oneliner")
+	switch cmd.Trigger {
+	case "chuck!":
+		return a.chuck(ctx)
+	case "анекдот!", "анкедот!", "joke!":
+		return a.jokesrv(ctx, "oneliner")
+	default: // category trigger, i.e. "excuse!"
+		return a.jokesrv(ctx, strings.TrimSuffix(cmd.Trigger, "!"))
 	}
 
 }
 
 // get categorize from https://jokesrv.rubedo.cloud/categories and extend with / prefix and ! suffix
 // to mach commands
-func (a Anecdote) categories() ([]string, error) {
+func (a Anecdote) categories(ctx context.Context) ([]string, error) {
 	res, err := a.categCache.Get("categories", func() (interface{}, error) {
 		var categories []string
-		req, err := http.NewRequest("GET", "https://jokesrv.rubedo.cloud/categories", http.NoBody)
+		req, err := http.NewRequestWithContext(ctx, "GET", "https://jokesrv.rubedo.cloud/categories", http.NoBody)
 		if err != nil {
 			return nil, fmt.Errorf("can't make categories request: %w", err)
 		}
@@ -90,10 +103,10 @@ func (a Anecdote) categories() ([]string, error) {
 	return cc, nil
 }
 
-func (a Anecdote) jokesrv(category string) (response Response) {
+func (a Anecdote) jokesrv(ctx context.Context, category string) (response Response) {
 	reqURL := "https://jokesrv.rubedo.cloud/" + category
 
-	req, err := makeHTTPRequest(reqURL)
+	req, err := makeHTTPRequest(ctx, reqURL)
 	if err != nil {
 		log.Printf("[WARN] failed to make request %s, error=%v", reqURL, err)
 		return Response{}
@@ -101,7 +114,7 @@ func (a Anecdote) jokesrv(category string) (response Response) {
 	resp, err := a.client.Do(req)
 	if err != nil {
 		log.Printf("[WARN] failed to send request %s, error=%v", reqURL, err)
-		return Response{}
+		return Response{Error: fmt.Errorf("failed to send request %s: %w", reqURL, err)}
 	}
 	defer resp.Body.Close() // nolint
 	rr := struct {
@@ -111,21 +124,21 @@ func (a Anecdote) jokesrv(category string) (response Response) {
 
 	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
 		log.Printf("[WARN] failed to parse body, error=%v", err)
-		return Response{}
+		return Response{Error: fmt.Errorf("failed to parse response: %w", err)}
 
 	}
 
-	return Response{Text: EscapeMarkDownV1Text(strings.TrimSuffix(rr.Content, ".")), Send: true}
+	return Response{Text: format.Markdown(format.Text(strings.TrimSuffix(rr.Content, "."))), Send: true}
 }
 
-func (a Anecdote) chuck() (response Response) {
+func (a Anecdote) chuck(ctx context.Context) (response Response) {
 
 	chuckResp := struct {
 		Value string
 	}{}
 
 	reqURL := "https://api.chucknorris.io/jokes/random"
-	req, err := makeHTTPRequest(reqURL)
+	req, err := makeHTTPRequest(ctx, reqURL)
 	if err != nil {
 		log.Printf("[WARN] failed to make request %s, error=%v", reqURL, err)
 		return Response{}
@@ -133,27 +146,21 @@ func (a Anecdote) chuck() (response Response) {
 	resp, err := a.client.Do(req)
 	if err != nil {
 		log.Printf("[WARN] failed to send request %s, error=%v", reqURL, err)
-		return Response{}
+		return Response{Error: fmt.Errorf("failed to send request %s: %w", reqURL, err)}
 	}
 	defer resp.Body.Close() // nolint
 
 	if err = json.NewDecoder(resp.Body).Decode(&chuckResp); err != nil {
 		log.Printf("[WARN] failed to convert from json, error=%v", err)
-		return Response{}
+		return Response{Error: fmt.Errorf("failed to parse response: %w", err)}
 	}
 	return Response{
-		Text: EscapeMarkDownV1Text(chuckResp.Value),
+		Text: format.Markdown(format.Text(chuckResp.Value)),
 		Send: true,
 	}
 }
 
 // ReactOn keys
 func (a Anecdote) ReactOn() []string {
-
-	cc, err := a.categories()
-	if err != nil {
-		log.Printf("[WARN] category retrival failed, %v", err)
-	}
-
-	return append([]string{"анекдот!", "анкедот!", "joke!", "chuck!"}, cc...)
+	return a.Commands().ReactOn()
 }
@@ -2,6 +2,7 @@ package bot
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -29,7 +30,7 @@ func TestAnecdot_Help(t *testing.T) {
 ]`))}, nil
 	}}
 	a := NewAnecdote(mockHTTP)
-	require.Equal(t, "анекдот!, анкедот!, joke!, chuck!, excuse!, pirozhki!, radiot!, zaibatsu!, excuse\\_en!, facts!, oneliner! _– расскажет анекдот или шутку_\n",
+	require.Equal(t, "анекдот\\!, анкедот\\!, joke\\!, chuck\\!, excuse\\!, pirozhki\\!, radiot\\!, zaibatsu\\!, excuse\\_en\\!, facts\\!, oneliner\\! _– расскажет анекдот или шутку_\n",
 		a.Help())
 }
 
@@ -52,7 +53,7 @@ func TestAnecdot_ujokesrvRetursnNothingOnUnableToDoReq(t *testing.T) {
 	}}
 	b := NewAnecdote(mockHTTP)
 
-	response := b.jokesrv("oneliners")
+	response := b.jokesrv(context.Background(), "oneliners")
 	require.False(t, response.Send)
 	require.Empty(t, response.Text)
 }
@@ -76,7 +77,9 @@ func TestAnecdotReactsOnBadChuckMessage(t *testing.T) {
 	}}
 	b := NewAnecdote(mockHTTP)
 
-	require.Equal(t, Response{}, b.OnMessage(Message{Text: "chuck!"}))
+	resp := b.OnMessage(Message{Text: "chuck!"})
+	require.False(t, resp.Send)
+	require.EqualError(t, resp.Error, "failed to parse response: invalid character 'o' in literal null (expecting 'u')")
 }
 
 func TestAnecdotReactsOnChuckMessageUnableToDoReq(t *testing.T) {
@@ -85,7 +88,9 @@ func TestAnecdotReactsOnChuckMessageUnableToDoReq(t *testing.T) {
 	}}
 	b := NewAnecdote(mockHTTP)
 
-	require.Equal(t, Response{}, b.OnMessage(Message{Text: "chuck!"}))
+	resp := b.OnMessage(Message{Text: "chuck!"})
+	require.False(t, resp.Send)
+	require.EqualError(t, resp.Error, "failed to send request https://api.chucknorris.io/jokes/random: err")
 }
 
 func TestAnecdotReactsOnChuckMessage(t *testing.T) {
@@ -104,5 +109,5 @@ func TestAnecdotReactsOnChuckMessage(t *testing.T) {
 	}}
 	b := NewAnecdote(mockHTTP)
 
-	require.Equal(t, Response{Text: "Chuck Norris got pulled over by a cop once. The cop was lucky to leave with a \\_warning\\_.", Send: true}, b.OnMessage(Message{Text: "chuck!"}))
+	require.Equal(t, Response{Text: "Chuck Norris got pulled over by a cop once\\. The cop was lucky to leave with a \\_warning\\_\\.", Send: true}, b.OnMessage(Message{Text: "chuck!"}))
 }
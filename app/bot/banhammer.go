@@ -1,60 +1,78 @@
 package bot
 
 import (
-	"fmt"
 	"log"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
-//go:generate moq --out mocks/tg_ban_client.go --pkg mocks --skip-ensure . TgBanClient:TgBanClient
-
 // Banhammer bot, allows (superusers only) to ban or unban anyone
 type Banhammer struct {
-	tgClient  TgBanClient
 	superUser SuperUser
+	triggers  *ConfusableMatcher // ban and unban written with look-alikes
 
 	maxRecentUsers int
-	recentUsers    map[string]userInfo
+	store          KVStore
+
+	mu          sync.Mutex
+	recentUsers map[string]userInfo
 }
 
 type userInfo struct {
 	User
-	ts time.Time
+	TS time.Time
 }
 
-// TgBanClient is a subset of tg api limited to ban-related operations only
-type TgBanClient interface {
-	Request(c tbapi.Chattable) (*tbapi.APIResponse, error)
-}
+const banhammerBucket = "banhammer"
 
-// NewBanhammer makes a bot for admins reacting on ban!user unban!user
-func NewBanhammer(tgClient TgBanClient, superUser SuperUser, maxRecentUsers int) *Banhammer {
+// NewBanhammer makes a bot for admins reacting on ban!user unban!user.
+// Bans and unbans made by the listener, the bot only resolves the user.
+// Recent users restored from the store, if any, to resolve names seen before restart.
+func NewBanhammer(superUser SuperUser, maxRecentUsers int, store KVStore) *Banhammer {
 	log.Printf("[INFO] Banhammer bot, max users to keep: %d, supers: %v", maxRecentUsers, superUser)
-	return &Banhammer{tgClient: tgClient, superUser: superUser, recentUsers: map[string]userInfo{}, maxRecentUsers: maxRecentUsers}
+	b := &Banhammer{superUser: superUser, triggers: NewConfusableMatcher("ban!", "unban!"), recentUsers: map[string]userInfo{},
+		maxRecentUsers: maxRecentUsers, store: store}
+	b.load()
+	return b
 }
 
 // Help returns help message
 func (b *Banhammer) Help() string {
-	return GenHelpMsg(b.ReactOn(), "забанить/разбанить (только для админов)")
+	return b.Commands().Help()
+}
+
+// Commands returns ban and unban commands, hidden from menu as superusers only
+func (b *Banhammer) Commands() Commands {
+	return Commands{{Triggers: []string{"ban!", "unban!"}, Description: "забанить/разбанить (только для админов)", Args: true, Hidden: true}}
 }
 
 // ReactOn keys
 func (b *Banhammer) ReactOn() []string {
-	return []string{"ban!", "unban!"}
+	return b.Commands().ReactOn()
 }
 
 // OnMessage pass msg to all bots and collects responses
 // In order to translate username to ID (mandatory for tg kick/unban) collect up to maxRecentUsers recently seen users
 func (b *Banhammer) OnMessage(msg Message) (response Response) {
 
-	// update list of recent users
-	b.recentUsers[msg.From.Username] = userInfo{User: msg.From, ts: time.Now()}
-	if len(b.recentUsers) > b.maxRecentUsers {
-		b.cleanup()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// update list of recent users, stored only new, changed and long inactive users to avoid write on each message.
+	// users without username can't be banned by name, so not kept
+	if msg.From.Username != "" {
+		prev, seen := b.recentUsers[msg.From.Username]
+		b.recentUsers[msg.From.Username] = userInfo{User: msg.From, TS: time.Now()}
+		if !seen || prev.User != msg.From || time.Since(prev.TS) > time.Hour {
+			b.save(b.recentUsers[msg.From.Username])
+		}
+		if len(b.recentUsers) > b.maxRecentUsers {
+			b.cleanup()
+		}
 	}
 
 	ok, cmd, name := b.parse(msg.Text)
@@ -73,48 +91,75 @@ func (b *Banhammer) OnMessage(msg Message) (response Response) {
 	}
 
 	switch cmd {
-	case "ban":
-		_, err := b.tgClient.Request(tbapi.KickChatMemberConfig{
-			ChatMemberConfig: tbapi.ChatMemberConfig{UserID: user.ID, ChatID: msg.ChatID},
-		})
-		if err != nil {
-			log.Printf("[WARN] failed to ban %s, %v", name, err)
-			return Response{}
-		}
-		log.Printf("[INFO] banned %+v by %+v", user.User, msg.From)
-		return Response{Text: fmt.Sprintf("прощай %s", name), Send: true}
-	case "unban":
-		_, err := b.tgClient.Request(tbapi.UnbanChatMemberConfig{ChatMemberConfig: tbapi.ChatMemberConfig{UserID: user.ID, ChatID: msg.ChatID}})
-		if err != nil {
-			log.Printf("[WARN] failed to unban %s, %v", name, err)
-			return Response{}
-		}
-		log.Printf("[INFO] unbanned %+v by %+v", user.User, msg.From)
-		return Response{Text: fmt.Sprintf("амнистия для %s", name), Send: true}
+	case "ban": // kicked by listener, so the ban kept in history and can be undone with button
+		log.Printf("[INFO] ban of %+v requested by %+v", user.User, msg.From)
+		return Response{Text: format.Markdown(format.Text("прощай " + name)), Send: true, BanInterval: banForever,
+			Kick: true, User: user.User, BanReason: "бан админом"}
+	case "unban": // unbanned by listener, so scheduled unban and terminators' bans cleared as well
+		log.Printf("[INFO] unban of %+v requested by %+v", user.User, msg.From)
+		return Response{Text: format.Markdown(format.Text("амнистия для " + name)), Send: true, Unban: true, User: user.User}
 	}
 
 	return Response{}
 }
 
+// cleanup removes the oldest recent users, called under lock
 func (b *Banhammer) cleanup() {
-	users := make([]userInfo, len(b.recentUsers))
+	users := make([]userInfo, 0, len(b.recentUsers))
 	for _, u := range b.recentUsers {
 		users = append(users, u)
 	}
-	sort.Slice(users, func(i, j int) bool { return users[i].ts.Before(users[j].ts) })
+	sort.Slice(users, func(i, j int) bool { return users[i].TS.Before(users[j].TS) })
 	// remove 10% of the oldest records
 	for i := 0; i < b.maxRecentUsers/10; i++ {
 		delete(b.recentUsers, users[i].Username)
+		if b.store != nil {
+			if err := b.store.Delete(banhammerBucket, users[i].Username); err != nil {
+				log.Printf("[WARN] failed to remove stored user %s, %v", users[i].Username, err)
+			}
+		}
 	}
 }
 
-func (b *Banhammer) parse(text string) (react bool, cmd, name string) {
-
-	for _, prefix := range b.ReactOn() {
-		if strings.HasPrefix(text, prefix) {
-			return true, strings.TrimSuffix(prefix, "!"),
-				strings.Replace(strings.TrimSpace(strings.TrimPrefix(text, prefix)), " ", "+", -1)
+// load restores recent users from the store
+func (b *Banhammer) load() {
+	if b.store == nil {
+		return
+	}
+	keys, err := b.store.Keys(banhammerBucket)
+	if err != nil {
+		log.Printf("[WARN] failed to load recent users, %v", err)
+		return
+	}
+	for _, k := range keys {
+		var u userInfo
+		if _, err := b.store.Load(banhammerBucket, k, &u); err != nil {
+			log.Printf("[WARN] failed to load recent user %s, %v", k, err)
+			continue
 		}
+		b.recentUsers[k] = u
+	}
+	log.Printf("[INFO] loaded %d recent users", len(b.recentUsers))
+}
+
+func (b *Banhammer) save(u userInfo) {
+	if b.store == nil {
+		return
+	}
+	if err := b.store.Save(banhammerBucket, u.Username, u); err != nil {
+		log.Printf("[WARN] failed to store recent user %s, %v", u.Username, err)
+	}
+}
+
+// parse returns command and its argument, trigger written with look-alikes recognized as well, i.e. "bаn!"
+// with cyrillic "а"
+func (b *Banhammer) parse(text string) (react bool, cmd, name string) {
+	if req, ok := b.Commands().Match(text); ok {
+		return true, strings.TrimSuffix(req.Trigger, "!"), req.Args
+	}
+	trigger, args, _ := strings.Cut(strings.TrimSpace(text), " ")
+	if phrase, ok := b.triggers.MatchWhole(trigger); ok {
+		return true, strings.TrimSuffix(phrase, "!"), strings.TrimSpace(args)
 	}
 	return false, "", ""
 }
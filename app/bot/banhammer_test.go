@@ -1,18 +1,20 @@
 package bot
 
 import (
+	"path/filepath"
 	"strconv"
 	"testing"
 
-	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/radio-t/super-bot/app/bot/mocks"
+	"github.com/radio-t/super-bot/app/storage"
 )
 
 func TestBanhammer_Help(t *testing.T) {
-	b := NewBanhammer(nil, nil, 10)
-	assert.Equal(t, "ban!, unban! _– забанить/разбанить (только для админов)_\n", b.Help())
+	b := NewBanhammer(nil, 10, nil)
+	assert.Equal(t, "ban\\!, unban\\! _– забанить/разбанить \\(только для админов\\)_\n", b.Help())
 }
 
 func TestBanhammer_parse(t *testing.T) {
@@ -24,12 +26,17 @@ func TestBanhammer_parse(t *testing.T) {
 		req  string
 	}{
 		{"blah", false, "", ""},
-		{"ban!someone", true, "ban", "someone"},
+		{"ban!someone", false, "", ""},
 		{"ban! user2", true, "ban", "user2"},
 		{"unban! user2", true, "unban", "user2"},
+		{"bаn! user2", true, "ban", "user2"},     // cyrillic "а"
+		{"ＵＮＢＡＮ! user2", true, "unban", "user2"}, // fullwidth
+		{"u.n.b.a.n! user2", true, "unban", "user2"},
+		{"banner! user2", false, "", ""},
+		{"bаn!someone", false, "", ""},
 	}
 
-	b := &Banhammer{}
+	b := NewBanhammer(nil, 10, nil)
 	for i, tt := range tbl {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			ok, cmd, req := b.parse(tt.text)
@@ -46,10 +53,7 @@ func TestBanhammer_parse(t *testing.T) {
 
 func TestBanhammer_OnMessage(t *testing.T) {
 	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
-	tg := &mocks.TgBanClient{RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
-		return &tbapi.APIResponse{Ok: true}, nil
-	}}
-	b := NewBanhammer(tg, su, 10)
+	b := NewBanhammer(su, 10, nil)
 
 	resp := b.OnMessage(Message{Text: "ban! user1", From: User{Username: "user1", ID: 1}})
 	assert.Equal(t, Response{}, resp, "not admin")
@@ -58,15 +62,48 @@ func TestBanhammer_OnMessage(t *testing.T) {
 	assert.Equal(t, Response{}, resp, "not a command")
 
 	resp = b.OnMessage(Message{Text: "ban! user1", From: User{Username: "admin"}, ChatID: 123})
-	assert.Equal(t, Response{Text: "прощай user1", Send: true}, resp)
+	assert.Equal(t, Response{Text: "прощай user1", Send: true, BanInterval: banForever, Kick: true,
+		User: User{Username: "user1", ID: 1}, BanReason: "бан админом"}, resp, "banned by listener")
 
 	resp = b.OnMessage(Message{Text: "unban! user1", From: User{Username: "admin"}, ChatID: 123})
-	assert.Equal(t, Response{Text: "амнистия для user1", Send: true}, resp)
+	assert.Equal(t, Response{Text: "амнистия для user1", Send: true, Unban: true, User: User{Username: "user1", ID: 1}},
+		resp, "unbanned by listener")
 
 	assert.Equal(t, 5, len(su.IsSuperCalls()))
-	assert.Equal(t, 2, len(tg.RequestCalls()))
-	assert.Equal(t, int64(1), tg.RequestCalls()[0].C.(tbapi.BanChatMemberConfig).UserID)
-	assert.Equal(t, int64(123), tg.RequestCalls()[0].C.(tbapi.BanChatMemberConfig).ChatID)
-	assert.Equal(t, int64(1), tg.RequestCalls()[1].C.(tbapi.UnbanChatMemberConfig).UserID)
-	assert.Equal(t, int64(123), tg.RequestCalls()[1].C.(tbapi.UnbanChatMemberConfig).ChatID)
+}
+
+func TestBanhammer_OnMessageRestored(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	b := NewBanhammer(su, 10, store)
+	resp := b.OnMessage(Message{Text: "hi", From: User{Username: "user1", ID: 1}})
+	assert.Equal(t, Response{}, resp)
+
+	b = NewBanhammer(su, 10, store) // restart
+	resp = b.OnMessage(Message{Text: "ban! user1", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, User{Username: "user1", ID: 1}, resp.User, "user resolved with recent users restored")
+	assert.Equal(t, banForever, resp.BanInterval)
+}
+
+func TestBanhammer_RecentUsers(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return false }}
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	b := NewBanhammer(su, 10, store)
+	b.OnMessage(Message{Text: "hi", From: User{ID: 1, DisplayName: "no username"}})
+	for i := 0; i < 11; i++ {
+		b.OnMessage(Message{Text: "hi", From: User{Username: "user" + strconv.Itoa(i), ID: int64(i + 10)}})
+	}
+
+	keys, err := store.Keys(banhammerBucket)
+	require.NoError(t, err)
+	assert.Equal(t, 10, len(keys), "user without username not kept, the oldest one removed")
+	assert.NotContains(t, keys, "user0")
+	assert.Contains(t, keys, "user10")
+	assert.Equal(t, 10, len(b.recentUsers))
 }
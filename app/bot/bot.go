@@ -5,13 +5,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
-	"github.com/go-pkgz/syncs"
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 //go:generate moq --out mocks/http_client.go --pkg mocks --skip-ensure . HTTPClient:HTTPClient
@@ -20,7 +20,7 @@ import (
 
 // GenHelpMsg construct help message from bot's ReactOn
 func GenHelpMsg(com []string, msg string) string {
-	return EscapeMarkDownV1Text(strings.Join(com, ", ")) + " _– " + msg + "_\n"
+	return format.Markdown(format.Text(strings.Join(com, ", ")+" "), format.Italic(format.Text("– "+msg)), format.Text("\n"))
 }
 
 // Interface is a bot reactive spec. response will be sent if "send" result is true
@@ -30,18 +30,88 @@ type Interface interface {
 	Help() string
 }
 
+// ContextInterface is a variant of Interface for bots able to stop processing on context cancellation,
+// i.e. bots making http requests. ctx is canceled when the answer is not needed anymore, on MultiBot timeout,
+// and the bot should pass it to all its requests and return as soon as it's done.
+// Slow bots should implement it, otherwise they are wrapped with ContextAdapter.
+type ContextInterface interface {
+	Interface
+	OnMessageContext(ctx context.Context, msg Message) (response Response)
+}
+
+// ContextAdapter makes ContextInterface from a regular Interface. The adapted bot can't honour ctx, so its
+// OnMessage keeps running after the timeout, concurrently with the next calls, and it must be safe for that,
+// i.e. guard its state with mutex.
+type ContextAdapter struct {
+	Interface
+}
+
+// WithContext returns bot as ContextInterface, wrapping it with ContextAdapter if it is not context-aware
+func WithContext(b Interface) ContextInterface {
+	if cb, ok := b.(ContextInterface); ok {
+		return cb
+	}
+	return ContextAdapter{Interface: b}
+}
+
+// OnMessageContext calls OnMessage of the wrapped bot and returns empty response if ctx is done before the answer.
+// The wrapped bot can't be interrupted, so it keeps running in background and its late answer is dropped.
+func (a ContextAdapter) OnMessageContext(ctx context.Context, msg Message) Response {
+	respCh := make(chan Response, 1) // buffered to let the late answer go without a reader
+	go func() {
+		respCh <- a.Interface.OnMessage(msg)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return Response{}
+	case resp := <-respCh:
+		return resp
+	}
+}
+
 // Response describes bot's answer on particular message
 type Response struct {
-	Text        string
-	Send        bool          // status
-	Pin         bool          // enable pin
-	Unpin       bool          // enable unpin
-	Preview     bool          // enable web preview
-	BanInterval time.Duration // bots banning user set the interval
-	User        User          // user to ban
-	ChannelID   int64         // channel to ban, if set then User and BanInterval are ignored
-	ReplyTo     int           // message to reply to, if 0 then no reply but common message
-	ParseMode   string        // parse mode for message in Telegram (we use Markdown by default)
+	Text          string
+	Send          bool          // status
+	Pin           bool          // enable pin
+	Unpin         bool          // enable unpin
+	Preview       bool          // enable web preview
+	BanInterval   time.Duration // bots banning user set the interval
+	User          User          // user to ban
+	ChannelID     int64         // channel to ban, if set then User and BanInterval are ignored
+	BanReason     string        // why the user banned, kept in bans history
+	Escalate      bool          // ban made longer for repeat offenders, the response text tells about it
+	Kick          bool          // User removed from the chat till unban instead of restriction, i.e. admin's ban
+	Unban         bool          // lift the ban of User, or of channel if ChannelID set, i.e. admin's unban
+	ReplyTo       int           // message to reply to, if 0 then no reply but common message
+	ParseMode     string        // parse mode for message in Telegram (we use MarkdownV2 by default)
+	Buttons       [][]Button    // rows of inline keyboard shown under the message
+	Key           string        // key to refer the sent message later, the listener keeps ids of bot messages by key
+	Edit          bool          // edit the message sent earlier with the same Key instead of sending a new one
+	EditID        int           // bot's message to edit instead of sending a new one, i.e. the message with pressed button
+	DeleteID      int           // message to delete, i.e. spam or wtf attempt. Text may be empty for deletion only
+	TTL           time.Duration // the sent message deleted after TTL, kept forever if 0
+	DeleteTrigger bool          // the message triggered the response deleted after TTL as well
+	RefreshMenu   bool          // commands of bots changed, i.e. bot turned on or off, telegram menu of the chat set again
+	Error         error         // failure of the bot, i.e. request to external service, shown in admin's status
+}
+
+// banForever is BanInterval of permanent ban, telegram treats restrictions over 366 days as permanent
+const banForever = 400 * Day
+
+// Button is a button of inline keyboard. Opens URL if set, otherwise Data passed back as Message.Callback
+// to the bot responded with the button.
+type Button struct {
+	Text string
+	URL  string
+	Data string // short, telegram limits data to 64 bytes including bot's name
+}
+
+// EditsChecker is implemented by bots checking edited messages as well, i.e. moderation bots.
+// Other bots don't get edited messages, so editing doesn't trigger their answers again.
+type EditsChecker interface {
+	ChecksEdits() bool
 }
 
 // HTTPClient wrap http.Client to allow mocking
@@ -54,6 +124,45 @@ type SuperUser interface {
 	IsSuper(userName string) bool
 }
 
+// KVStore keeps bots state across restarts, i.e. storage.Bolt. Each bot uses its own bucket,
+// values are encoded, so only exported fields stored. Bots work without persistence if store is nil.
+type KVStore interface {
+	Load(bucket, key string, v interface{}) (found bool, err error)
+	Save(bucket, key string, v interface{}) error
+	Delete(bucket, key string) error
+	Keys(bucket string) ([]string, error)
+}
+
+// prefixedStore is KVStore with prefixed bucket names
+type prefixedStore struct {
+	KVStore
+	prefix string
+}
+
+// WithBucketPrefix makes store with prefixed bucket names, to keep state of the same bots in different chats apart
+func WithBucketPrefix(store KVStore, prefix string) KVStore {
+	if store == nil {
+		return nil
+	}
+	return &prefixedStore{KVStore: store, prefix: prefix}
+}
+
+func (s *prefixedStore) Load(bucket, key string, v interface{}) (found bool, err error) {
+	return s.KVStore.Load(s.prefix+bucket, key, v)
+}
+
+func (s *prefixedStore) Save(bucket, key string, v interface{}) error {
+	return s.KVStore.Save(s.prefix+bucket, key, v)
+}
+
+func (s *prefixedStore) Delete(bucket, key string) error {
+	return s.KVStore.Delete(s.prefix+bucket, key)
+}
+
+func (s *prefixedStore) Keys(bucket string) ([]string, error) {
+	return s.KVStore.Keys(s.prefix + bucket)
+}
+
 // SenderChat is the sender of the message, sent on behalf of a chat. The
 // channel itself for channel messages. The supergroup itself for messages
 // from anonymous group administrators. The linked channel for messages
@@ -77,12 +186,16 @@ type Message struct {
 	Text       string    `json:",omitempty"`
 	Entities   *[]Entity `json:",omitempty"`
 	Image      *Image    `json:",omitempty"`
+	Edited     bool      `json:",omitempty"` // edited version of the message with the same ID
+	Callback   *Callback `json:",omitempty"` // pressed inline keyboard button, ID is the message with the keyboard
 	ReplyTo    struct {
 		From       User
 		Text       string `json:",omitempty"`
 		Sent       time.Time
 		SenderChat SenderChat `json:"sender_chat,omitempty"`
 	} `json:",omitempty"`
+	Forwarded *SenderChat `json:",omitempty"` // channel or group the message forwarded from
+	Joined    []User      `json:",omitempty"` // users joined the chat, service message without text
 }
 
 // Entity represents one special entity in a text message.
@@ -95,6 +208,12 @@ type Entity struct {
 	User   *User  `json:",omitempty"` // For “text_mention” only, the mentioned user
 }
 
+// Callback represents a press of inline keyboard button, passed only to the bot made the button
+type Callback struct {
+	ID   string // callback query id
+	Data string // data of the pressed button
+}
+
 // Image represents image
 type Image struct {
 	// FileID corresponds to Telegram file_id
@@ -113,12 +232,28 @@ type User struct {
 }
 
 // MultiBot combines many bots to one virtual
-type MultiBot []Interface
+type MultiBot struct {
+	Bots    []Interface
+	Timeout time.Duration // max time for each bot to answer, no limit if 0
+	BotName string        // telegram username of the bot, to accept commands like "/news@BotName"
+}
+
+// callbackSep separates name of the bot made the button from button's data in callback data
+const callbackSep = ":"
+
+// maxCallbackData is the limit of button's callback data in telegram
+const maxCallbackData = 64
+
+// helpCmd is the command to get help from all bots
+var helpCmd = Command{Triggers: []string{"help!", "help"}, Description: "список команд"}
+
+// helpTTL is the time help message kept in chat
+const helpTTL = 5 * time.Minute
 
 // Help returns help message
 func (b MultiBot) Help() string {
 	sb := strings.Builder{}
-	for _, child := range b {
+	for _, child := range b.Bots {
 		help := child.Help()
 		if help != "" {
 			// WriteString always returns nil err
@@ -132,88 +267,185 @@ func (b MultiBot) Help() string {
 }
 
 // OnMessage pass msg to all bots and collects responses (combining all of them)
-// noinspection GoShadowedVar
 func (b MultiBot) OnMessage(msg Message) (response Response) {
-	if contains([]string{"help", "/help", "help!"}, msg.Text) {
-		return Response{
-			Text: b.Help(),
-			Send: true,
+	return b.OnMessageContext(context.Background(), msg)
+}
+
+// OnMessageContext pass msg to all bots and combines their responses to a single one.
+// Used by callers unable to handle multiple responses, see OnMessages for independent responses.
+func (b MultiBot) OnMessageContext(ctx context.Context, msg Message) (response Response) {
+	resps := b.OnMessages(ctx, msg)
+	if len(resps) == 0 {
+		return Response{}
+	}
+
+	lines := make([]string, 0, len(resps))
+	buttons := [][]Button{}
+	response = resps[0]
+	for _, resp := range resps {
+		lines = append(lines, resp.Text)
+		response.Pin = response.Pin || resp.Pin
+		response.Unpin = response.Unpin || resp.Unpin
+		response.RefreshMenu = response.RefreshMenu || resp.RefreshMenu
+		if response.ReplyTo == 0 {
+			response.ReplyTo = resp.ReplyTo
+		}
+		if response.DeleteID == 0 {
+			response.DeleteID = resp.DeleteID
+		}
+		buttons = append(buttons, resp.Buttons...)
+		if resp.BanInterval > response.BanInterval {
+			response.BanInterval = resp.BanInterval
+			response.User = resp.User
+			response.ChannelID = resp.ChannelID
+			response.BanReason = resp.BanReason
+			response.Escalate = resp.Escalate
+			response.Kick = resp.Kick
+		}
+		if resp.Unban && !response.Unban {
+			response.Unban, response.User, response.ChannelID = true, resp.User, resp.ChannelID
 		}
 	}
+	response.Text = strings.Join(lines, "\n")
+	if len(buttons) > 0 {
+		response.Buttons = buttons
+	}
+	return response
+}
 
-	resps := make(chan string)
-	var pin, unpin int32
-	var channelID int64
-	var banInterval time.Duration
-	var user User
-	var mutex = &sync.Mutex{}
-	var replyTo int
-
-	wg := syncs.NewSizedGroup(4)
-	for _, bot := range b {
-		bot := bot
-		wg.Go(func(ctx context.Context) {
-			if resp := bot.OnMessage(msg); resp.Send {
-				resps <- resp.Text
-				if resp.Pin {
-					atomic.AddInt32(&pin, 1)
-				}
-				if resp.Unpin {
-					atomic.AddInt32(&unpin, 1)
-				}
-				if resp.ReplyTo > 0 {
-					replyTo = resp.ReplyTo
-				}
-				if resp.BanInterval > 0 {
-					mutex.Lock()
-					if resp.BanInterval > banInterval {
-						banInterval = resp.BanInterval
-					}
-					user = resp.User
-					channelID = resp.ChannelID
-					mutex.Unlock()
-				}
-			}
-		})
+// OnMessages pass msg to all bots and collects their responses, each one to be sent as a separate message.
+// Responses are ordered by bots priority, i.e. by the order of Bots.
+// All bots asked at once, each one has up to Timeout, or its own timeout if managed bot has it, to answer,
+// late answers are dropped. So the whole call takes no more than the longest timeout, regardless of the number
+// of slow bots.
+func (b MultiBot) OnMessages(ctx context.Context, msg Message) []Response {
+	msg.Text = TrimBotName(msg.Text, b.BotName)
+	if _, ok := (Commands{helpCmd}).Match(msg.Text); ok && !msg.Edited && msg.Callback == nil {
+		return []Response{{Text: b.Help(), Send: true, TTL: helpTTL, DeleteTrigger: true}}
 	}
 
-	go func() {
-		wg.Wait()
-		close(resps)
-	}()
+	target := "" // name of the bot made the pressed button
+	if msg.Callback != nil {
+		cb := *msg.Callback
+		target, cb.Data, _ = strings.Cut(cb.Data, callbackSep)
+		msg.Callback = &cb
+	}
 
-	lines := make([]string, 0, len(resps))
-	for r := range resps {
-		log.Printf("[DEBUG] collect %q", r)
-		lines = append(lines, r)
+	results := make([]Response, len(b.Bots)) // each bot writes to own slot only
+	wg := sync.WaitGroup{}
+	for i, bot := range b.Bots {
+		i, bot := i, bot
+		if !accepts(bot, msg, target) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = scoped(b.botResponse(ctx, bot, msg), botName(bot))
+		}()
+	}
+	wg.Wait()
+
+	resps := make([]Response, 0, len(results))
+	for _, resp := range results {
+		if !resp.Send {
+			continue
+		}
+		log.Printf("[DEBUG] collect %q", resp.Text)
+		resps = append(resps, resp)
+	}
+
+	log.Printf("[DEBUG] answers %d, send %v", len(resps), len(resps) > 0)
+	return resps
+}
+
+// botResponse gets response from a single bot, limited by Timeout or the own timeout of managed bot
+func (b MultiBot) botResponse(ctx context.Context, bot Interface, msg Message) Response {
+	timeout := b.Timeout
+	if m, ok := bot.(*Managed); ok && m.Timeout() > 0 {
+		timeout = m.Timeout()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	sort.Slice(lines, func(i, j int) bool {
-		return lines[i] < lines[j]
-	})
+	resp := WithContext(bot).OnMessageContext(ctx, msg)
+	if ctx.Err() != nil {
+		log.Printf("[WARN] bot %s didn't answer on %q in time, %v", botName(bot), msg.Text, ctx.Err())
+		if m, ok := bot.(*Managed); ok {
+			m.setError(fmt.Errorf("no answer on %q in time: %w", msg.Text, ctx.Err()))
+		}
+		return Response{}
+	}
+	return resp
+}
 
-	log.Printf("[DEBUG] answers %d, send %v", len(lines), len(lines) > 0)
-	return Response{
-		Text:        strings.Join(lines, "\n"),
-		Send:        len(lines) > 0,
-		Pin:         atomic.LoadInt32(&pin) > 0,
-		Unpin:       atomic.LoadInt32(&unpin) > 0,
-		BanInterval: banInterval,
-		User:        user,
-		ChannelID:   channelID,
-		ReplyTo:     replyTo,
+// accepts checks if bot wants the message. Callbacks passed to the target bot made the button only,
+// edited messages passed to bots checking edits only.
+func accepts(b Interface, msg Message, target string) bool {
+	switch {
+	case msg.Callback != nil:
+		return botName(b) == target
+	case msg.Edited:
+		c, ok := unwrap(b).(EditsChecker)
+		return ok && c.ChecksEdits()
+	}
+	return true
+}
+
+// scoped prefixes message key and data of buttons with the bot name, so keys of different bots don't clash
+// and callbacks passed back to the bot. Buttons with data exceeding telegram limit dropped.
+func scoped(resp Response, name string) Response {
+	if resp.Key != "" {
+		resp.Key = name + callbackSep + resp.Key
+	}
+	if len(resp.Buttons) == 0 {
+		return resp
+	}
+	var rows [][]Button
+	for _, row := range resp.Buttons {
+		r := make([]Button, 0, len(row))
+		for _, btn := range row {
+			if btn.URL == "" {
+				btn.Data = name + callbackSep + btn.Data
+				if len(btn.Data) > maxCallbackData {
+					log.Printf("[WARN] button %q of %s dropped, data %q too long", btn.Text, name, btn.Data)
+					continue
+				}
+			}
+			r = append(r, btn)
+		}
+		if len(r) > 0 {
+			rows = append(rows, r)
+		}
 	}
+	resp.Buttons = rows
+	return resp
 }
 
 // ReactOn returns combined list of all keywords
 func (b MultiBot) ReactOn() (res []string) {
-	for _, bot := range b {
+	for _, bot := range b.Bots {
 		res = append(res, bot.ReactOn()...)
 	}
 	return res
 }
 
-func contains(s []string, e string) bool {
+// BotCommands returns telegram menu made of commands of all bots
+func (b MultiBot) BotCommands() []tbapi.BotCommand {
+	res := []tbapi.BotCommand{}
+	for _, bot := range b.Bots {
+		if c, ok := bot.(Commander); ok {
+			res = append(res, c.Commands().BotCommands()...)
+		}
+	}
+	return append(res, Commands{helpCmd}.BotCommands()...)
+}
+
+// containsFold checks if s has e, case-insensitive and ignoring spaces around e, for triggers lookups
+func containsFold(s []string, e string) bool {
 	e = strings.TrimSpace(e)
 	for _, a := range s {
 		if strings.EqualFold(a, e) {
@@ -223,8 +455,42 @@ func contains(s []string, e string) bool {
 	return false
 }
 
-func makeHTTPRequest(url string) (*http.Request, error) {
-	req, err := http.NewRequest("GET", url, http.NoBody)
+// contains checks if s has exactly e, for data lists lookups, i.e. say! quotes
+func contains(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
+
+// botName returns bot's name for logging, type name used for unnamed bots, i.e. "bot.News"
+func botName(b Interface) string {
+	if m, ok := b.(*Managed); ok {
+		return m.Name()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", unwrap(b)), "*")
+}
+
+// unwrap returns the bot wrapped with Managed, Retriggered or ContextAdapter
+func unwrap(b Interface) Interface {
+	for {
+		switch w := b.(type) {
+		case *Managed:
+			b = w.Interface
+		case ContextAdapter:
+			b = w.Interface
+		case *Retriggered:
+			b = w.Interface
+		default:
+			return b
+		}
+	}
+}
+
+func makeHTTPRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request %s: %w", url, err)
 	}
@@ -232,14 +498,3 @@ func makeHTTPRequest(url string) (*http.Request, error) {
 	req.Header.Set("Accept", "application/json")
 	return req, nil
 }
-
-// EscapeMarkDownV1Text escapes markdownV1 special characters, used in places where we want to send text as-is.
-// For example, telegram username with underscores would be italicized if we don't escape it.
-// https://core.telegram.org/bots/api#markdown-style
-func EscapeMarkDownV1Text(text string) string {
-	escSymbols := []string{"_", "*", "`", "["}
-	for _, esc := range escSymbols {
-		text = strings.Replace(text, esc, "\\"+esc, -1)
-	}
-	return text
-}
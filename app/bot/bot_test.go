@@ -1,11 +1,15 @@
 package bot
 
 import (
+	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
 )
 
 func TestGenHelpMsg(t *testing.T) {
@@ -22,7 +26,7 @@ func TestMultiBotHelp(t *testing.T) {
 
 	// Must return concatenated b1 and b2 without space
 	// Line formatting only in GenHelpMsg()
-	require.Equal(t, "b1 help\nb2 help\n", MultiBot{b1, b2}.Help())
+	require.Equal(t, "b1 help\nb2 help\n", MultiBot{Bots: []Interface{b1, b2}}.Help())
 }
 
 func TestMultiBotReactsOnHelp(t *testing.T) {
@@ -35,11 +39,13 @@ func TestMultiBotReactsOnHelp(t *testing.T) {
 		},
 	}
 
-	mb := MultiBot{b}
+	mb := MultiBot{Bots: []Interface{b}}
 	resp := mb.OnMessage(Message{Text: "help"})
 
 	require.True(t, resp.Send)
 	require.Equal(t, "help\n", resp.Text)
+	assert.Equal(t, helpTTL, resp.TTL)
+	assert.True(t, resp.DeleteTrigger)
 }
 
 func TestMultiBotCombinesAllBotResponses(t *testing.T) {
@@ -54,7 +60,7 @@ func TestMultiBotCombinesAllBotResponses(t *testing.T) {
 		OnMessageFunc: func(m Message) Response { return Response{Send: true, Text: "b2 resp"} },
 	}
 
-	mb := MultiBot{b1, b2}
+	mb := MultiBot{Bots: []Interface{b1, b2}}
 	resp := mb.OnMessage(msg)
 	t.Logf("resp: %+v", resp)
 
@@ -65,3 +71,206 @@ func TestMultiBotCombinesAllBotResponses(t *testing.T) {
 	require.Contains(t, parts, "b2 resp")
 	assert.Equal(t, 789, resp.ReplyTo)
 }
+
+func TestMultiBotOnMessagesKeepsBotsOrder(t *testing.T) {
+	b1 := &InterfaceMock{OnMessageFunc: func(m Message) Response {
+		time.Sleep(50 * time.Millisecond) // answers last, but goes first
+		return Response{Send: true, Text: "z resp", ParseMode: "HTML", ReplyTo: 1}
+	}}
+	b2 := &InterfaceMock{OnMessageFunc: func(m Message) Response { return Response{} }}
+	b3 := &InterfaceMock{OnMessageFunc: func(m Message) Response { return Response{Send: true, Text: "a resp", Pin: true} }}
+
+	mb := MultiBot{Bots: []Interface{b1, b2, b3}}
+	resps := mb.OnMessages(context.Background(), Message{Text: "cmd"})
+	assert.Equal(t, []Response{
+		{Send: true, Text: "z resp", ParseMode: "HTML", ReplyTo: 1},
+		{Send: true, Text: "a resp", Pin: true},
+	}, resps)
+
+	resp := mb.OnMessage(Message{Text: "cmd"})
+	assert.Equal(t, Response{Send: true, Text: "z resp\na resp", ParseMode: "HTML", ReplyTo: 1, Pin: true}, resp)
+}
+
+func TestMultiBotPassesEditsToCheckers(t *testing.T) {
+	regular := &InterfaceMock{OnMessageFunc: func(m Message) Response { return Response{Send: true, Text: "regular"} }}
+	wtf := NewWTF(time.Hour, 2*time.Hour, &mocks.SuperUser{IsSuperFunc: func(string) bool { return false }}, nil)
+	wtf.rand = func(n int64) int64 { return 0 }
+	mb := MultiBot{Bots: []Interface{regular, NewManaged("wtf", wtf)}}
+
+	resps := mb.OnMessages(context.Background(), Message{Text: "wtf!", Edited: true, From: User{Username: "user"}})
+	require.Len(t, resps, 1)
+	assert.Equal(t, "@user получает бан на 1ч", resps[0].Text)
+
+	resps = mb.OnMessages(context.Background(), Message{Text: "help", Edited: true})
+	assert.Empty(t, resps, "no help for edited messages")
+
+	resps = mb.OnMessages(context.Background(), Message{Text: "blah", Edited: true})
+	assert.Empty(t, resps)
+}
+
+func TestMultiBotRoutesCallbacks(t *testing.T) {
+	pager := func(name string) *Managed {
+		return NewManaged(name, &InterfaceMock{OnMessageFunc: func(m Message) Response {
+			if m.Callback != nil {
+				return Response{Send: true, Text: name + " pressed " + m.Callback.Data}
+			}
+			return Response{Send: true, Text: name + " page", Buttons: [][]Button{
+				{{Text: "next", Data: "2"}, {Text: "site", URL: "https://radio-t.com"}},
+				{{Text: "long", Data: strings.Repeat("x", 64)}},
+			}}
+		}})
+	}
+	mb := MultiBot{Bots: []Interface{pager("b1"), pager("b2")}}
+
+	resps := mb.OnMessages(context.Background(), Message{Text: "cmd"})
+	require.Len(t, resps, 2)
+	assert.Equal(t, [][]Button{{{Text: "next", Data: "b1:2"}, {Text: "site", URL: "https://radio-t.com"}}}, resps[0].Buttons,
+		"data prefixed with bot name, too long dropped")
+	assert.Equal(t, [][]Button{{{Text: "next", Data: "b2:2"}, {Text: "site", URL: "https://radio-t.com"}}}, resps[1].Buttons)
+
+	resp := mb.OnMessage(Message{Text: "cmd"})
+	assert.Equal(t, "b1 page\nb2 page", resp.Text)
+	assert.Equal(t, append(resps[0].Buttons, resps[1].Buttons...), resp.Buttons)
+
+	resps = mb.OnMessages(context.Background(), Message{Callback: &Callback{ID: "1", Data: "b2:2"}})
+	assert.Equal(t, []Response{{Send: true, Text: "b2 pressed 2"}}, resps)
+
+	resps = mb.OnMessages(context.Background(), Message{Callback: &Callback{ID: "1", Data: "unknown:2"}})
+	assert.Empty(t, resps)
+}
+
+func TestManagedWithTTL(t *testing.T) {
+	b := NewManaged("ping", &InterfaceMock{OnMessageFunc: func(m Message) Response {
+		switch m.Text {
+		case "ping":
+			return Response{Send: true, Text: "pong"}
+		case "long":
+			return Response{Send: true, Text: "long pong", TTL: time.Hour}
+		}
+		return Response{}
+	}}).WithTTL(time.Minute)
+
+	assert.Equal(t, Response{Send: true, Text: "pong", TTL: time.Minute, DeleteTrigger: true}, b.OnMessage(Message{Text: "ping"}))
+	assert.Equal(t, Response{Send: true, Text: "long pong", TTL: time.Hour}, b.OnMessage(Message{Text: "long"}),
+		"bot's own ttl kept")
+	assert.Equal(t, Response{}, b.OnMessage(Message{Text: "blah"}))
+}
+
+func TestManagedCommands(t *testing.T) {
+	cmds := Commands{{Triggers: []string{"ping!"}, Description: "пинг"}}
+	b := NewManaged("ping", &commanderMock{cmds: cmds})
+	mb := MultiBot{Bots: []Interface{b}}
+	assert.Equal(t, cmds, b.Commands())
+	assert.Len(t, mb.BotCommands(), 2, "bot's command and help")
+
+	b.SetEnabled(false)
+	assert.Nil(t, b.Commands(), "turned off")
+	assert.Len(t, mb.BotCommands(), 1, "help only")
+}
+
+func TestMultiBotDropsLateAnswers(t *testing.T) {
+	slow := &InterfaceMock{
+		OnMessageFunc: func(m Message) Response {
+			time.Sleep(200 * time.Millisecond)
+			return Response{Send: true, Text: "slow resp"}
+		},
+	}
+	fast := &InterfaceMock{
+		OnMessageFunc: func(m Message) Response { return Response{Send: true, Text: "fast resp"} },
+	}
+
+	mb := MultiBot{Bots: []Interface{slow, fast}, Timeout: 50 * time.Millisecond}
+	st := time.Now()
+	resp := mb.OnMessage(Message{Text: "cmd"})
+	assert.Less(t, time.Since(st), 150*time.Millisecond)
+	require.True(t, resp.Send)
+	assert.Equal(t, "fast resp", resp.Text)
+}
+
+func TestMultiBotManySlowBots(t *testing.T) {
+	mb := MultiBot{Timeout: 50 * time.Millisecond}
+	for i := 0; i < 10; i++ {
+		mb.Bots = append(mb.Bots, &ctxBotMock{onMessageCtx: func(ctx context.Context, m Message) Response {
+			<-ctx.Done()
+			return Response{Send: true, Text: "too late"}
+		}})
+	}
+	mb.Bots = append(mb.Bots, &InterfaceMock{OnMessageFunc: func(m Message) Response { return Response{Send: true, Text: "fast"} }})
+
+	st := time.Now()
+	resps := mb.OnMessages(context.Background(), Message{Text: "cmd"})
+	assert.Less(t, time.Since(st), 150*time.Millisecond, "the whole call limited by timeout")
+	assert.Equal(t, []Response{{Send: true, Text: "fast"}}, resps)
+}
+
+func TestMultiBotManagedTimeout(t *testing.T) {
+	slow := &ctxBotMock{onMessageCtx: func(ctx context.Context, m Message) Response {
+		select {
+		case <-ctx.Done():
+			return Response{}
+		case <-time.After(100 * time.Millisecond):
+			return Response{Send: true, Text: "slow"}
+		}
+	}}
+
+	mb := MultiBot{Bots: []Interface{NewManaged("slow", slow)}, Timeout: 50 * time.Millisecond}
+	assert.False(t, mb.OnMessageContext(context.Background(), Message{Text: "cmd"}).Send, "common timeout")
+
+	mb = MultiBot{Bots: []Interface{NewManaged("slow", slow).WithTimeout(time.Second)}, Timeout: 50 * time.Millisecond}
+	assert.Equal(t, "slow", mb.OnMessageContext(context.Background(), Message{Text: "cmd"}).Text, "own timeout")
+}
+
+func TestMultiBotCancelsContextBots(t *testing.T) {
+	canceled := make(chan struct{})
+	b := &ctxBotMock{onMessageCtx: func(ctx context.Context, m Message) Response {
+		<-ctx.Done()
+		close(canceled)
+		return Response{Send: true, Text: "too late"}
+	}}
+
+	mb := MultiBot{Bots: []Interface{b}, Timeout: 50 * time.Millisecond}
+	resp := mb.OnMessageContext(context.Background(), Message{Text: "cmd"})
+	assert.False(t, resp.Send)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("bot's context wasn't canceled")
+	}
+}
+
+func TestContextAdapter(t *testing.T) {
+	b := &InterfaceMock{OnMessageFunc: func(m Message) Response { return Response{Send: true, Text: m.Text} }}
+	cb := WithContext(b)
+	assert.IsType(t, ContextAdapter{}, cb)
+	assert.Equal(t, Response{Send: true, Text: "msg"}, cb.OnMessageContext(context.Background(), Message{Text: "msg"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	block := make(chan struct{})
+	defer close(block)
+	b.OnMessageFunc = func(m Message) Response {
+		<-block
+		return Response{Send: true}
+	}
+	assert.Equal(t, Response{}, cb.OnMessageContext(ctx, Message{Text: "msg"}))
+
+	ctxBot := &ctxBotMock{}
+	assert.Equal(t, ctxBot, WithContext(ctxBot), "context-aware bot returned as is")
+}
+
+type ctxBotMock struct {
+	InterfaceMock
+	onMessageCtx func(ctx context.Context, m Message) Response
+}
+
+func (c *ctxBotMock) OnMessageContext(ctx context.Context, m Message) Response {
+	return c.onMessageCtx(ctx, m)
+}
+
+func TestContains(t *testing.T) {
+	assert.True(t, containsFold([]string{"Ping", "пинг"}, " ping "))
+	assert.False(t, containsFold([]string{"Ping"}, "pong"))
+	assert.True(t, contains([]string{"Мудрость", "b"}, "Мудрость"))
+	assert.False(t, contains([]string{"Мудрость"}, "мудрость"), "data lookups are case-sensitive")
+	assert.False(t, contains([]string{"Мудрость"}, " Мудрость"))
+}
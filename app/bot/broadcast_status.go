@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 const (
@@ -14,6 +16,9 @@ const (
 
 	// MsgBroadcastFinished defines text to be sent by the bot when the broadcast finished
 	MsgBroadcastFinished = "Вещание завершилось"
+
+	// broadcastKey is the key of "started" message, edited to "finished" one
+	broadcastKey = "status"
 )
 
 // BroadcastParams defines parameters for broadcast detection
@@ -22,6 +27,7 @@ type BroadcastParams struct {
 	PingInterval time.Duration // Ping interval
 	DelayToOff   time.Duration // State will be switched to off in no ok replies from URL in this interval
 	Client       http.Client   // http client
+	Store        KVStore       // keeps the last sent status across restarts, optional
 }
 
 // BroadcastStatus bot replies with current broadcast status
@@ -29,12 +35,22 @@ type BroadcastStatus struct {
 	status         bool // current broadcast status
 	lastSentStatus bool // last status sent with OnMessage
 	statusMx       sync.Mutex
+	store          KVStore
 }
 
-// NewBroadcastStatus starts status checking goroutine and returns bot instance
+const broadcastBucket = "broadcast"
+
+// NewBroadcastStatus starts status checking goroutine and returns bot instance.
+// The last sent status restored from the store, so restart during broadcast doesn't announce it again.
 func NewBroadcastStatus(ctx context.Context, params BroadcastParams) *BroadcastStatus {
 	log.Printf("[INFO] BroadcastStatus bot with %v", params.URL)
-	b := &BroadcastStatus{}
+	b := &BroadcastStatus{store: params.Store}
+	if b.store != nil {
+		if _, err := b.store.Load(broadcastBucket, "last_sent", &b.lastSentStatus); err != nil {
+			log.Printf("[WARN] failed to load last broadcast status, %v", err)
+		}
+		b.status = b.lastSentStatus
+	}
 	go b.checker(ctx, params)
 	return b
 }
@@ -44,7 +60,7 @@ func (b *BroadcastStatus) Help() string {
 	return ""
 }
 
-// OnMessage returns current broadcast status if it was changed
+// OnMessage returns current broadcast status if it was changed, "started" message edited to "finished" one
 func (b *BroadcastStatus) OnMessage(_ Message) (response Response) {
 	b.statusMx.Lock()
 	defer b.statusMx.Unlock()
@@ -52,19 +68,29 @@ func (b *BroadcastStatus) OnMessage(_ Message) (response Response) {
 	response.Pin = false
 	if b.lastSentStatus != b.status {
 		response.Send = true
+		response.Key = broadcastKey
 		if b.status {
-			response.Text = MsgBroadcastStarted
+			response.Text = format.Markdown(format.Text(MsgBroadcastStarted))
 		} else {
-			response.Text = MsgBroadcastFinished
+			response.Text = format.Markdown(format.Text(MsgBroadcastFinished))
+			response.Edit = true
 			response.Unpin = true // unpin message "broadcast started" (sent by outside clients)
 		}
 		b.lastSentStatus = b.status
+		if b.store != nil {
+			if err := b.store.Save(broadcastBucket, "last_sent", b.lastSentStatus); err != nil {
+				log.Printf("[WARN] failed to store last broadcast status, %v", err)
+			}
+		}
 	}
 	return
 }
 
 func (b *BroadcastStatus) checker(ctx context.Context, params BroadcastParams) {
 	lastOn := time.Time{}
+	if b.getStatus() { // restored status, off only after DelayToOff without ok replies
+		lastOn = time.Now()
+	}
 	for {
 		select {
 		case <-ctx.Done():
@@ -124,7 +150,7 @@ func ping(ctx context.Context, client http.Client, url string) (status bool) {
 	return
 }
 
-// nolint
+// getStatus returns current broadcast status
 func (b *BroadcastStatus) getStatus() bool {
 	b.statusMx.Lock()
 	defer b.statusMx.Unlock()
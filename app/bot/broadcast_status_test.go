@@ -4,12 +4,17 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/storage"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 func TestBroadcast_OnMessage(t *testing.T) {
@@ -19,8 +24,8 @@ func TestBroadcast_OnMessage(t *testing.T) {
 		expectedResponse Response
 	}{
 		{false, false, Response{}},
-		{false, true, Response{Text: MsgBroadcastStarted, Send: true}},
-		{true, false, Response{Text: MsgBroadcastFinished, Send: true, Unpin: true}},
+		{false, true, Response{Text: format.Markdown(format.Text(MsgBroadcastStarted)), Send: true, Key: broadcastKey}},
+		{true, false, Response{Text: format.Markdown(format.Text(MsgBroadcastFinished)), Send: true, Unpin: true, Key: broadcastKey, Edit: true}},
 		{true, true, Response{}},
 	}
 
@@ -76,7 +81,7 @@ func TestBroadcast_StatusTransitions(t *testing.T) {
 
 	// Wait for off->on
 	time.Sleep(20 * time.Millisecond)
-	require.Equal(t, Response{Text: MsgBroadcastStarted, Send: true, Pin: false}, b.OnMessage(Message{}))
+	require.Equal(t, Response{Text: format.Markdown(format.Text(MsgBroadcastStarted)), Send: true, Key: broadcastKey, Pin: false}, b.OnMessage(Message{}))
 	require.True(t, b.getStatus())
 
 	// off
@@ -88,10 +93,34 @@ func TestBroadcast_StatusTransitions(t *testing.T) {
 
 	// Deadline reached on->off
 	time.Sleep(110 * time.Millisecond)
-	require.Equal(t, Response{Text: MsgBroadcastFinished, Send: true, Unpin: true}, b.OnMessage(Message{}))
+	require.Equal(t, Response{Text: format.Markdown(format.Text(MsgBroadcastFinished)), Send: true, Unpin: true, Key: broadcastKey, Edit: true}, b.OnMessage(Message{}))
 	require.False(t, b.getStatus())
 }
 
+func TestBroadcast_StatusRestored(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	params := BroadcastParams{URL: ts.URL, PingInterval: time.Millisecond, DelayToOff: time.Second, Store: store}
+
+	b := NewBroadcastStatus(ctx, params)
+	require.Eventually(t, b.getStatus, time.Second, time.Millisecond)
+	require.Equal(t, Response{Text: format.Markdown(format.Text(MsgBroadcastStarted)), Send: true, Key: broadcastKey}, b.OnMessage(Message{}))
+
+	b = NewBroadcastStatus(ctx, params) // restart during broadcast
+	require.True(t, b.getStatus())
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, Response{}, b.OnMessage(Message{}), "started status already sent")
+}
+
 func TestBroadcast_StatusOffToOn(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -189,12 +218,12 @@ func TestBroadcast_OnMessageReturnsReplyOnChange(t *testing.T) {
 	b := &BroadcastStatus{lastSentStatus: false, status: true} // OFF ->ON
 	resp := b.OnMessage(Message{})
 	require.True(t, resp.Send)
-	require.Equal(t, MsgBroadcastStarted, resp.Text)
+	require.Equal(t, format.Markdown(format.Text(MsgBroadcastStarted)), resp.Text)
 
 	b = &BroadcastStatus{lastSentStatus: true, status: false} // ON -> OFF
 	resp = b.OnMessage(Message{})
 	require.True(t, resp.Send)
-	require.Equal(t, MsgBroadcastFinished, resp.Text)
+	require.Equal(t, format.Markdown(format.Text(MsgBroadcastFinished)), resp.Text)
 }
 
 func TestBroadcast_PingReturnsTrueOn200Status(t *testing.T) {
@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Command describes a command the bot reacts on.
+// Trigger with "!" suffix, i.e. "news!", matches "news! args", "/news args" and "/news@BotName args".
+// Other triggers, i.e. "when?" or "??", match as is, optionally followed by args.
+type Command struct {
+	Triggers    []string // the first latin trigger with "!" suffix used as the name in telegram menu
+	Description string   // shown in help and telegram menu
+	Args        bool     // command accepts arguments, otherwise only the trigger alone matches
+	Hidden      bool     // not shown in telegram menu, i.e. superuser's commands
+}
+
+// CommandRequest is a command matched in the message text
+type CommandRequest struct {
+	Command
+	Trigger string // matched trigger as defined in Command, i.e. "news!" for "/news"
+	Args    string // text after the trigger, trimmed
+}
+
+// Commands is a registry of commands used to parse messages and to make help and telegram menu
+type Commands []Command
+
+// Commander is implemented by bots declaring their commands
+type Commander interface {
+	Commands() Commands
+}
+
+// menuNameRe defines allowed name of telegram command, see https://core.telegram.org/bots/api#botcommand
+var menuNameRe = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// Match looks for any of commands in the text and returns the first one matched with its arguments
+func (cc Commands) Match(text string) (req CommandRequest, ok bool) {
+	for _, c := range cc {
+		if trigger, args, found := c.match(text); found {
+			return CommandRequest{Command: c, Trigger: trigger, Args: args}, true
+		}
+	}
+	return CommandRequest{}, false
+}
+
+// Help returns help message with a line per command
+func (cc Commands) Help() string {
+	sb := strings.Builder{}
+	for _, c := range cc {
+		_, _ = sb.WriteString(GenHelpMsg(c.Triggers, c.Description))
+	}
+	return sb.String()
+}
+
+// ReactOn returns all triggers of all commands
+func (cc Commands) ReactOn() []string {
+	res := []string{}
+	for _, c := range cc {
+		res = append(res, c.Triggers...)
+	}
+	return res
+}
+
+// BotCommands returns commands for telegram menu, set with setMyCommands.
+// Hidden commands and commands without latin "name!" trigger are skipped.
+func (cc Commands) BotCommands() []tbapi.BotCommand {
+	res := []tbapi.BotCommand{}
+	for _, c := range cc {
+		if c.Hidden || c.Description == "" {
+			continue
+		}
+		for _, t := range c.Triggers {
+			name := strings.ToLower(strings.TrimSuffix(t, "!"))
+			if strings.HasSuffix(t, "!") && menuNameRe.MatchString(name) {
+				res = append(res, tbapi.BotCommand{Command: name, Description: c.Description})
+				break
+			}
+		}
+	}
+	return res
+}
+
+// match checks all forms of command triggers in the text and returns matched trigger and args
+func (c Command) match(text string) (trigger, args string, ok bool) {
+	text = strings.TrimSpace(text)
+	for _, t := range c.Triggers {
+		if rest, found := trimPrefixFold(text, t); found {
+			if rest == "" || (c.Args && startsWithSpace(rest)) {
+				return t, strings.TrimSpace(rest), true
+			}
+			continue
+		}
+
+		if !strings.HasSuffix(t, "!") {
+			continue
+		}
+		rest, found := trimPrefixFold(text, "/"+strings.TrimSuffix(t, "!"))
+		if !found {
+			continue
+		}
+		// "/name" should be followed by a space or nothing, commands addressed to bots ("/name@BotName") are
+		// expected to be trimmed with TrimBotName before matching, so the rest of them belongs to other bots
+		if rest == "" {
+			return t, "", true
+		}
+		if c.Args && startsWithSpace(rest) {
+			return t, strings.TrimSpace(rest), true
+		}
+	}
+	return "", "", false
+}
+
+// TrimBotName removes "@botName" from slash-command, i.e. "/news@BotName args" becomes "/news args".
+// Commands addressed to other bots left as is.
+func TrimBotName(text, botName string) string {
+	if botName == "" || !strings.HasPrefix(text, "/") {
+		return text
+	}
+	cmdEnd := strings.IndexAny(text, " \n")
+	if cmdEnd < 0 {
+		cmdEnd = len(text)
+	}
+	cmd := text[:cmdEnd]
+	at := strings.Index(cmd, "@")
+	if at < 0 || !strings.EqualFold(cmd[at+1:], botName) {
+		return text
+	}
+	return cmd[:at] + text[cmdEnd:]
+}
+
+// startsWithSpace checks if text starts with whitespace, separating trigger from args
+func startsWithSpace(text string) bool {
+	r, _ := utf8.DecodeRuneInString(text)
+	return unicode.IsSpace(r)
+}
+
+// trimPrefixFold removes case-insensitive prefix from text
+func trimPrefixFold(text, prefix string) (rest string, ok bool) {
+	if len(text) < len(prefix) || !strings.EqualFold(text[:len(prefix)], prefix) {
+		return text, false
+	}
+	return text[len(prefix):], true
+}
+
+// Retriggered is a bot with triggers of its command replaced, i.e. with triggers set in configuration.
+// Message with a new trigger is passed to the bot with the original one, original triggers are ignored.
+type Retriggered struct {
+	Interface
+	cmd Command // command with new triggers
+}
+
+// WithTriggers replaces triggers of the bot's command. Only bots with a single command supported.
+func WithTriggers(b Interface, triggers []string) (*Retriggered, error) {
+	c, ok := b.(Commander)
+	if !ok || len(c.Commands()) != 1 {
+		return nil, fmt.Errorf("can't set triggers for %s, single command expected", botName(b))
+	}
+	if len(triggers) == 0 {
+		return nil, fmt.Errorf("can't set empty triggers for %s", botName(b))
+	}
+	cmd := c.Commands()[0]
+	cmd.Triggers = triggers
+	return &Retriggered{Interface: b, cmd: cmd}, nil
+}
+
+// OnMessage passes message to the wrapped bot with triggers replaced
+func (r *Retriggered) OnMessage(msg Message) Response {
+	return r.OnMessageContext(context.Background(), msg)
+}
+
+// OnMessageContext passes message to the wrapped bot with triggers replaced
+func (r *Retriggered) OnMessageContext(ctx context.Context, msg Message) Response {
+	orig := r.Interface.(Commander).Commands()
+	if req, ok := (Commands{r.cmd}).Match(msg.Text); ok {
+		msg.Text = strings.TrimSpace(orig[0].Triggers[0] + " " + req.Args)
+		return WithContext(r.Interface).OnMessageContext(ctx, msg)
+	}
+	if _, ok := orig.Match(msg.Text); ok {
+		return Response{} // original triggers replaced
+	}
+	return WithContext(r.Interface).OnMessageContext(ctx, msg)
+}
+
+// Commands returns the bot's command with new triggers
+func (r *Retriggered) Commands() Commands {
+	return Commands{r.cmd}
+}
+
+// Help returns help message for the command with new triggers
+func (r *Retriggered) Help() string {
+	return r.Commands().Help()
+}
+
+// ReactOn returns new triggers
+func (r *Retriggered) ReactOn() []string {
+	return r.Commands().ReactOn()
+}
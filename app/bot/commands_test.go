@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"context"
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommands_Match(t *testing.T) {
+	cc := Commands{
+		{Triggers: []string{"news!", "новости!"}, Description: "news"},
+		{Triggers: []string{"search!", "??"}, Description: "search", Args: true},
+		{Triggers: []string{"when?"}, Description: "when"},
+	}
+
+	tbl := []struct {
+		text    string
+		ok      bool
+		trigger string
+		args    string
+	}{
+		{"news!", true, "news!", ""},
+		{" News! ", true, "news!", ""},
+		{"НОВОСТИ!", true, "новости!", ""},
+		{"/news", true, "news!", ""},
+		{"/news@other_bot", false, "", ""},
+		{"/newsletter", false, "", ""},
+		{"news! please", false, "", ""},
+		{"/news please", false, "", ""},
+		{"search! lambda calculus", true, "search!", "lambda calculus"},
+		{"search!lambda", false, "", ""},
+		{"search!\tlambda", true, "search!", "lambda"},
+		{"when?ever", false, "", ""},
+		{"/search lambda  ", true, "search!", "lambda"},
+		{"/search", true, "search!", ""},
+		{"/searchlambda", false, "", ""},
+		{"?? what is go", true, "??", "what is go"},
+		{"when?", true, "when?", ""},
+		{"/when", false, "", ""},
+		{"blah news!", false, "", ""},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			req, ok := cc.Match(tt.text)
+			require.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.trigger, req.Trigger)
+			assert.Equal(t, tt.args, req.Args)
+		})
+	}
+}
+
+func TestCommands_HelpAndMenu(t *testing.T) {
+	cc := Commands{
+		{Triggers: []string{"новости!", "news!"}, Description: "последние новости"},
+		{Triggers: []string{"ban!", "unban!"}, Description: "бан", Hidden: true},
+		{Triggers: []string{"когда?", "when?"}, Description: "расписание"},
+	}
+
+	assert.Equal(t, "новости\\!, news\\! _– последние новости_\nban\\!, unban\\! _– бан_\nкогда?, when? _– расписание_\n", cc.Help())
+	assert.Equal(t, []string{"новости!", "news!", "ban!", "unban!", "когда?", "when?"}, cc.ReactOn())
+	assert.Equal(t, []tbapi.BotCommand{{Command: "news", Description: "последние новости"}}, cc.BotCommands())
+}
+
+func TestTrimBotName(t *testing.T) {
+	tbl := []struct {
+		text, botName, exp string
+	}{
+		{"/news@RadioT_bot", "radiot_bot", "/news"},
+		{"/search@radiot_bot lambda", "radiot_bot", "/search lambda"},
+		{"/search@other_bot lambda", "radiot_bot", "/search@other_bot lambda"},
+		{"news! @radiot_bot", "radiot_bot", "news! @radiot_bot"},
+		{"/news@radiot_bot", "", "/news@radiot_bot"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.exp, TrimBotName(tt.text, tt.botName))
+		})
+	}
+}
+
+func TestMultiBot_CommandAddressedToBot(t *testing.T) {
+	news := &News{}
+	b := &InterfaceMock{
+		OnMessageFunc: func(m Message) Response {
+			if _, ok := news.Commands().Match(m.Text); ok {
+				return Response{Send: true, Text: "news"}
+			}
+			return Response{}
+		},
+		HelpFunc: func() string { return "help" },
+	}
+	mb := MultiBot{Bots: []Interface{b}, BotName: "radiot_bot"}
+	assert.Len(t, mb.OnMessages(context.Background(), Message{Text: "/news@radiot_bot"}), 1)
+	assert.Len(t, mb.OnMessages(context.Background(), Message{Text: "/news@other_bot"}), 0)
+
+	resps := mb.OnMessages(context.Background(), Message{Text: "/help@radiot_bot"})
+	require.Len(t, resps, 1)
+	assert.Equal(t, "help\n", resps[0].Text)
+
+	assert.Equal(t, []tbapi.BotCommand{{Command: "help", Description: "список команд"}}, mb.BotCommands())
+	mb.Bots = append(mb.Bots, news)
+	assert.Equal(t, []tbapi.BotCommand{{Command: "news", Description: "5 последних новостей для Радио-Т"},
+		{Command: "help", Description: "список команд"}}, mb.BotCommands())
+}
+
+func TestWithTriggers(t *testing.T) {
+	news := &InterfaceMock{}
+	_, err := WithTriggers(news, []string{"новини!"})
+	require.Error(t, err, "not a commander")
+
+	d := &Duck{}
+	_, err = WithTriggers(d, nil)
+	require.Error(t, err, "empty triggers")
+
+	var received []string
+	b := &commanderMock{cmds: d.Commands(), InterfaceMock: InterfaceMock{OnMessageFunc: func(m Message) Response {
+		received = append(received, m.Text)
+		return Response{Send: true, Text: m.Text}
+	}}}
+	rb, err := WithTriggers(b, []string{"шукати!"})
+	require.NoError(t, err)
+
+	assert.Equal(t, Response{Send: true, Text: "ddg! lambda"}, rb.OnMessage(Message{Text: "шукати! lambda"}))
+	assert.Equal(t, Response{}, rb.OnMessage(Message{Text: "ddg! lambda"}), "original trigger ignored")
+	assert.Equal(t, Response{Send: true, Text: "free text"}, rb.OnMessage(Message{Text: "free text"}))
+	assert.Equal(t, []string{"ddg! lambda", "free text"}, received)
+	assert.Equal(t, []string{"шукати!"}, rb.ReactOn())
+	assert.Equal(t, "шукати\\! _– поискать на DuckDuckGo, например: ddg\\! lambda_\n", rb.Help())
+}
+
+type commanderMock struct {
+	InterfaceMock
+	cmds Commands
+}
+
+func (c *commanderMock) Commands() Commands { return c.cmds }
@@ -0,0 +1,362 @@
+package bot
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+//go:generate go run gen_confusables.go -out confusables_table.go
+
+// foldScripts are scripts of letters folded to look-alikes of the word's script, others kept as is
+var foldScripts = []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Greek}
+
+// lookalikes maps lower cased prototype to the lower case letter of the script representing it,
+// i.e. "a" → cyrillic "а" for cyrillic and latin "a" for latin. Letters of other script mixed into a word
+// replaced with the representatives of the word's script.
+var lookalikes = map[*unicode.RangeTable]map[string]rune{}
+
+func init() {
+	// fancy symbols of wtf tables missing in confusables data, i.e. "卄" for "h"
+	wtf := WTFSteroidChecker{}
+	for _, lib := range []map[string][]string{wtf.WTFUnicodeLibrary(), wtf.WTFUnicodeDiacriticLibrary()} {
+		for proto, analogs := range lib {
+			for _, a := range analogs {
+				r, size := utf8.DecodeRuneInString(a)
+				if size != len(a) || r <= unicode.MaxASCII || unicode.Is(unicode.Cyrillic, r) {
+					continue // only single fancy symbols, cyrillic letters in wtf tables are wtf-specific
+				}
+				if _, ok := confusables[r]; !ok {
+					confusables[r] = proto
+				}
+			}
+		}
+	}
+
+	for _, script := range foldScripts {
+		direct, byUpper := map[string]rune{}, map[string]rune{}
+		rangeRunes(script, func(r rune) {
+			if !unicode.IsLower(r) {
+				return
+			}
+			if _, ok := direct[prototype(r)]; !ok {
+				direct[prototype(r)] = r
+			}
+			if u := unicode.ToUpper(r); u != r { // i.e. cyrillic "в" represents "b" as its capital "В" looks like "B"
+				if _, ok := byUpper[prototype(u)]; !ok {
+					byUpper[prototype(u)] = r
+				}
+			}
+		})
+		for proto, r := range byUpper {
+			if _, ok := direct[proto]; !ok {
+				direct[proto] = r
+			}
+		}
+		lookalikes[script] = direct
+	}
+}
+
+// Skeleton returns the form of text used to compare it with look-alikes: compatibility forms folded
+// (i.e. fullwidth and mathematical letters), diacritics and invisible characters removed and letters lower cased.
+// Letters of other script in mixed-script words replaced with look-alikes of the word's script, i.e. "Ⓑа́Ｎ"
+// with cyrillic "а" → "ban" and "кaзинo" with latin "a" and "o" → "казино". Words of a single script are not
+// folded to other one, so distinct words of different alphabets don't collide.
+func Skeleton(text string) string {
+	sb, word := strings.Builder{}, []rune{}
+	for _, r := range normalize(text) {
+		if isWordRune(r) {
+			word = append(word, r)
+			continue
+		}
+		sb.WriteString(foldWord(word, nil))
+		word = word[:0]
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	sb.WriteString(foldWord(word, nil))
+	return norm.NFC.String(sb.String())
+}
+
+// normalize folds compatibility forms and removes diacritics and invisible characters
+func normalize(text string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.Predicate(func(r rune) bool {
+		return unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf)
+	})))
+	res, _, _ := transform.String(t, text)
+	return res
+}
+
+// foldWord lower cases the word and replaces its look-alikes with representatives of the target script,
+// if the word has letters of it, otherwise of the word's script, the script of most letters. Single-script words
+// only lower cased this way. Look-alikes of words without letters of fold scripts replaced with prototypes,
+// i.e. fancy symbols, digits kept.
+func foldWord(word []rune, target *unicode.RangeTable) string {
+	var dominant *unicode.RangeTable
+	counts := map[*unicode.RangeTable]int{}
+	for _, r := range word {
+		if s := scriptOf(r); s != nil {
+			counts[s]++
+			if dominant == nil || counts[s] > counts[dominant] {
+				dominant = s
+			}
+		}
+	}
+	if target != nil && counts[target] > 0 {
+		dominant = target
+	}
+
+	sb := strings.Builder{}
+	for _, r := range word {
+		lower := unicode.ToLower(r)
+		switch {
+		case dominant == nil && unicode.IsDigit(r):
+			sb.WriteRune(r)
+		case dominant == nil:
+			sb.WriteString(prototype(lower))
+		default:
+			protos := []string{prototype(lower)}
+			if scriptOf(r) != dominant && r != lower { // capital of other script, i.e. cyrillic "В" looks like "B"
+				protos = append([]string{prototype(r)}, protos...)
+			}
+			sb.WriteString(representative(dominant, lower, protos))
+		}
+	}
+	return sb.String()
+}
+
+// representative returns the letter of the script looking like one of prototypes, the first found,
+// or the prototype itself if it's not a letter, i.e. latin "ǃ" → "!". Otherwise the rune kept.
+func representative(script *unicode.RangeTable, r rune, protos []string) string {
+	for _, p := range protos {
+		if l, ok := lookalikes[script][p]; ok {
+			return string(l)
+		}
+	}
+	if p := protos[len(protos)-1]; strings.IndexFunc(p, isWordRune) < 0 {
+		return p
+	}
+	return string(r)
+}
+
+// prototype returns lower cased prototype of the look-alike, the rune itself if it's not a look-alike
+func prototype(r rune) string {
+	if p, ok := confusables[r]; ok {
+		return strings.ToLower(p)
+	}
+	return string(r)
+}
+
+// scriptOf returns fold script of the rune, nil for other scripts, digits and symbols
+func scriptOf(r rune) *unicode.RangeTable {
+	for _, s := range foldScripts {
+		if unicode.Is(s, r) {
+			return s
+		}
+	}
+	return nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// rangeRunes calls fn for each rune of the table
+func rangeRunes(table *unicode.RangeTable, fn func(r rune)) {
+	for _, rng := range table.R16 {
+		for r := rune(rng.Lo); r <= rune(rng.Hi); r += rune(rng.Stride) {
+			fn(r)
+		}
+	}
+	for _, rng := range table.R32 {
+		for r := rune(rng.Lo); r <= rune(rng.Hi); r += rune(rng.Stride) {
+			fn(r)
+		}
+	}
+}
+
+// ConfusableMatcher finds words and phrases in text regardless of look-alike characters, diacritics, case,
+// punctuation and separators between letters, i.e. "b.а.n!" with cyrillic "а" matches "ban!".
+// Mixed-script words of text folded to the script of the phrase word, words of a single script compared as is,
+// so cyrillic "ВАН" doesn't match "ban". Phrases matched by whole words, "!" and "?" matter as separate words.
+type ConfusableMatcher struct {
+	phrases []confusablePhrase
+}
+
+type confusablePhrase struct {
+	text  string
+	words []string
+}
+
+// NewConfusableMatcher makes matcher of phrases, empty ones ignored
+func NewConfusableMatcher(phrases ...string) *ConfusableMatcher {
+	res := &ConfusableMatcher{}
+	for _, p := range phrases {
+		words := skeletonWords(p)
+		if len(words) == 0 {
+			continue
+		}
+		res.phrases = append(res.phrases, confusablePhrase{text: p, words: words})
+	}
+	return res
+}
+
+// Match returns the first phrase found in text
+func (m *ConfusableMatcher) Match(text string) (phrase string, ok bool) {
+	found := m.match(text, true)
+	if len(found) == 0 {
+		return "", false
+	}
+	return found[0], true
+}
+
+// MatchAll returns all phrases found in text, in order of matcher's phrases
+func (m *ConfusableMatcher) MatchAll(text string) []string {
+	return m.match(text, false)
+}
+
+// MatchWhole returns the phrase the whole text looks like, i.e. command trigger without arguments
+func (m *ConfusableMatcher) MatchWhole(text string) (phrase string, ok bool) {
+	words := splitWords(normalize(text))
+	for _, ww := range [][]string{words, joinSingleLetters(words)} {
+		for _, p := range m.phrases {
+			if len(ww) == len(p.words) && containsLookalikes(ww, p.words) {
+				return p.text, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Len returns the number of phrases
+func (m *ConfusableMatcher) Len() int {
+	return len(m.phrases)
+}
+
+func (m *ConfusableMatcher) match(text string, first bool) (res []string) {
+	if len(m.phrases) == 0 {
+		return nil
+	}
+	words := splitWords(normalize(text))
+	joined := joinSingleLetters(words) // "w t f" written apart
+	for _, p := range m.phrases {
+		if containsLookalikes(words, p.words) || containsLookalikes(joined, p.words) {
+			res = append(res, p.text)
+			if first {
+				return res
+			}
+		}
+	}
+	return res
+}
+
+// skeletonWords splits skeleton of text to words of letters and digits, each "!" and "?" is a word as well
+func skeletonWords(text string) []string {
+	return splitWords(Skeleton(text))
+}
+
+// plainWords splits text to words the same way as skeletonWords, but with letters as is, only lower cased
+// and diacritics removed. Phrase found in skeleton words but not in plain ones is disguised with look-alikes.
+func plainWords(text string) []string {
+	return splitWords(removeDiacritics(strings.ToLower(text)))
+}
+
+// splitWords splits text to words of letters and digits, each "!" and "?" is a word as well
+func splitWords(text string) (res []string) {
+	word := strings.Builder{}
+	flush := func() {
+		if word.Len() > 0 {
+			res = append(res, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		case r == '!' || r == '?':
+			flush()
+			res = append(res, string(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return res
+}
+
+// joinSingleLetters joins sequences of single letter words, i.e. "w", "t", "f", "!" → "wtf", "!"
+func joinSingleLetters(words []string) []string {
+	res := make([]string, 0, len(words))
+	single := func(w string) bool {
+		r, size := utf8.DecodeRuneInString(w)
+		return size == len(w) && (unicode.IsLetter(r) || unicode.IsDigit(r))
+	}
+	for i, w := range words {
+		if i > 0 && single(w) && single(words[i-1]) {
+			res[len(res)-1] += w
+			continue
+		}
+		res = append(res, w)
+	}
+	return res
+}
+
+// containsLookalikes checks if normalized words of text have sub sequence looking like skeleton words
+func containsLookalikes(words, sub []string) bool {
+	for i := 0; i+len(sub) <= len(words); i++ {
+		found := true
+		for j := range sub {
+			if !looksLike(words[i+j], sub[j]) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLike checks if normalized word looks like skeleton word, mixed-script word folded to the script
+// of the skeleton word
+func looksLike(word, skeleton string) bool {
+	var target *unicode.RangeTable
+	for _, r := range skeleton {
+		if target = scriptOf(r); target != nil {
+			break
+		}
+	}
+	return norm.NFC.String(foldWord([]rune(word), target)) == skeleton
+}
+
+// containsWords checks if words have sub sequence
+func containsWords(words, sub []string) bool {
+	for i := 0; i+len(sub) <= len(words); i++ {
+		found := true
+		for j := range sub {
+			if words[i+j] != sub[j] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// removeDiacritics smart removes diacritic marks, i.e. "ẃŧḟ" → "wtf".
+// isMn check rune is in Unicode Mn category nonspacing marks
+// https://blog.golang.org/normalization#TOC_10.
+// https://pkg.go.dev/golang.org/x/text/runes#Remove
+func removeDiacritics(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	res, _, _ := transform.String(t, s)
+	return res
+}
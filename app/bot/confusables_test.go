@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"testing"
+	"unicode"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkeleton(t *testing.T) {
+	tbl := []struct {
+		text string
+		res  string
+	}{
+		{"ban", "ban"},
+		{"BAN", "ban"},
+		{"bаn", "ban"},         // cyrillic "а"
+		{"ВАН", "ван"},         // all cyrillic, not folded to latin
+		{"Вan", "ban"},         // cyrillic capital "В" looks like "B"
+		{"вan", "ʙan"},         // cyrillic "в" looks like small capital "ʙ", not "b"
+		{"Ⓑа́Ｎ", "ban"},        // circled, diacritic, fullwidth
+		{"𝓦𝓣𝓕!", "wtf!"},       // mathematical
+		{"b\u200ban", "ban"},   // zero width space
+		{"рaypal", "paypal"},   // cyrillic "р"
+		{"ᴘᴀʏᴘᴀʟ", "ᴘᴀyᴘᴀʟ"},   // small capitals are not look-alikes in unicode data
+		{"p0rn", "porn"},       // digit
+		{"ʍtf", "wtf"},         // from wtf tables
+		{"ёлка", "елка"},       // diacritic removed
+		{"казино", "казино"},   // single script kept
+		{"кaзинo", "казино"},   // latin "a" and "o" folded to the script of most letters
+		{"Казино!", "казино!"}, // case and punctuation
+		{"к0нтакт", "контакт"}, // digit
+		{"2023", "2023"},
+		{"ça va", "ca va"}, // diacritic
+		{"", ""},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.res, Skeleton(tt.text))
+		})
+	}
+}
+
+func TestConfusableMatcher(t *testing.T) {
+	m := NewConfusableMatcher("ban!", "казино", "пишите в лс", "", " ?! ")
+	assert.Equal(t, 4, m.Len(), "empty phrase ignored")
+
+	tbl := []struct {
+		text string
+		res  []string
+	}{
+		{"ban! user", []string{"ban!"}},
+		{"bаn!user", []string{"ban!"}},
+		{"b.a.n!", []string{"ban!"}},
+		{"b a n !", []string{"ban!"}},
+		{"ВАN!", []string{"ban!"}},
+		{"ВАН!", nil},
+		{"ban user", nil},
+		{"banner!", nil},
+		{"лучшее КАЗИНО!", []string{"казино"}},
+		{"кaзинo", []string{"казино"}},
+		{"KAЗИНO", []string{"казино"}},
+		{"kaзинo", []string{"казино"}},
+		{"кaзuнo", nil}, // latin "u" doesn't look like "и"
+		{"к а з и н о", []string{"казино"}},
+		{"заказино", nil},
+		{"казино, пишите в ЛС", []string{"казино", "пишите в лс"}},
+		{"пишите в личку", nil},
+		{"что?!", []string{" ?! "}},
+		{"", nil},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.res, m.MatchAll(tt.text))
+			phrase, ok := m.Match(tt.text)
+			assert.Equal(t, len(tt.res) > 0, ok)
+			if ok {
+				assert.Equal(t, tt.res[0], phrase)
+			}
+		})
+	}
+
+	assert.Nil(t, NewConfusableMatcher().MatchAll("ban!"))
+}
+
+func TestConfusableMatcher_MatchWhole(t *testing.T) {
+	m := NewConfusableMatcher("ban!", "unban!")
+	tbl := []struct {
+		text   string
+		phrase string
+		ok     bool
+	}{
+		{"ban!", "ban!", true},
+		{"uNbаn!", "unban!", true},
+		{"b.a.n!", "ban!", true},
+		{"ban! user", "", false},
+		{"ban", "", false},
+		{"бан!", "", false},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			phrase, ok := m.MatchWhole(tt.text)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.phrase, phrase)
+		})
+	}
+}
+
+func TestConfusablesTable(t *testing.T) {
+	assert.Greater(t, len(confusables), 6000, "generated from unicode data")
+	assert.Equal(t, "a", confusables['а'], "cyrillic")
+	assert.Equal(t, "W", confusables['𝓦'], "mathematical")
+	assert.Equal(t, "rn", confusables['m'])
+	assert.Equal(t, "w", confusables['ᘺ'], "from wtf tables")
+	assert.Equal(t, 'а', lookalikes[unicode.Cyrillic]["a"])
+	assert.Equal(t, 'в', lookalikes[unicode.Cyrillic]["b"], "capital looks like latin")
+	assert.Equal(t, 'a', lookalikes[unicode.Latin]["a"])
+}
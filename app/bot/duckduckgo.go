@@ -1,10 +1,13 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"strings"
+	"net/url"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // Duck bot, returns from duckduckgo via mashape
@@ -21,20 +24,31 @@ func NewDuck(key string, client HTTPClient) *Duck {
 
 // Help returns help message
 func (d *Duck) Help() string {
-	return GenHelpMsg(d.ReactOn(), "поискать на DuckDuckGo, например: ddg! lambda")
+	return d.Commands().Help()
+}
+
+// Commands returns search command
+func (d *Duck) Commands() Commands {
+	return Commands{{Triggers: []string{"ddg!", "??"}, Description: "поискать на DuckDuckGo, например: ddg! lambda", Args: true}}
 }
 
 // OnMessage pass msg to all bots and collects responses
 func (d *Duck) OnMessage(msg Message) (response Response) {
+	return d.OnMessageContext(context.Background(), msg)
+}
 
-	ok, reqText := d.request(msg.Text)
+// OnMessageContext returns search result from duckduckgo, request canceled with ctx
+func (d *Duck) OnMessageContext(ctx context.Context, msg Message) (response Response) {
+
+	cmd, ok := d.Commands().Match(msg.Text)
 	if !ok {
 		return Response{}
 	}
+	reqText := url.QueryEscape(cmd.Args)
 
 	reqURL := fmt.Sprintf("https://api.duckduckgo.com/?q=%s&format=json&no_html=1&no_redirect=1&skip_disambig=1", reqText)
 
-	req, err := makeHTTPRequest(reqURL)
+	req, err := makeHTTPRequest(ctx, reqURL)
 	if err != nil {
 		log.Printf("[WARN] failed to make request %s, error=%v", reqURL, err)
 		return Response{}
@@ -43,7 +57,7 @@ func (d *Duck) OnMessage(msg Message) (response Response) {
 	resp, err := d.client.Do(req)
 	if err != nil {
 		log.Printf("[WARN] failed to send request %s, error=%v", reqURL, err)
-		return Response{}
+		return Response{Error: fmt.Errorf("failed to send request %s: %w", reqURL, err)}
 	}
 	defer func() { _ = resp.Body.Close() }()
 
@@ -55,40 +69,25 @@ func (d *Duck) OnMessage(msg Message) (response Response) {
 	}{}
 	if err = json.NewDecoder(resp.Body).Decode(&duckResp); err != nil {
 		log.Printf("[WARN] failed to convert from json, error=%v", err)
-		return Response{}
-	}
-
-	mdLink := func(inp string) string {
-		result := strings.Replace(inp, "(", "%28", -1)
-		result = strings.Replace(result, ")", "%29", -1)
-		return result
+		return Response{Error: fmt.Errorf("failed to parse response: %w", err)}
 	}
 
 	if duckResp.AbstractText == "" {
 		return Response{
-			Text: fmt.Sprintf("_не в силах. но могу помочь_ [это поискать](https://duckduckgo.com/?q=%s)", mdLink(reqText)),
+			Text: format.Markdown(format.Italic(format.Text("не в силах. но могу помочь")), format.Text(" "),
+				format.Link("https://duckduckgo.com/?q="+reqText, format.Text("это поискать"))),
 			Send: true,
 		}
 	}
 
-	respMD := fmt.Sprintf("%s\n[%s](%s)", EscapeMarkDownV1Text(duckResp.AbstractText), duckResp.AbstractSource, mdLink(duckResp.AbstractURL))
 	return Response{
-		Text: respMD,
+		Text: format.Markdown(format.Text(duckResp.AbstractText+"\n"),
+			format.Link(duckResp.AbstractURL, format.Text(duckResp.AbstractSource))),
 		Send: true,
 	}
 }
 
-func (d *Duck) request(text string) (react bool, reqText string) {
-
-	for _, prefix := range d.ReactOn() {
-		if strings.HasPrefix(text, prefix) {
-			return true, strings.Replace(strings.TrimSpace(strings.TrimPrefix(text, prefix)), " ", "+", -1)
-		}
-	}
-	return false, ""
-}
-
 // ReactOn keys
 func (d *Duck) ReactOn() []string {
-	return []string{"ddg!", "??"}
+	return d.Commands().ReactOn()
 }
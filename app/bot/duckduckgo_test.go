@@ -14,7 +14,7 @@ import (
 )
 
 func TestDuck_Help(t *testing.T) {
-	require.Equal(t, "ddg!, ?? _– поискать на DuckDuckGo, например: ddg! lambda_\n", (&Duck{}).Help())
+	require.Equal(t, "ddg\\!, ?? _– поискать на DuckDuckGo, например: ddg\\! lambda_\n", (&Duck{}).Help())
 }
 
 func TestDuck_OnMessage(t *testing.T) {
@@ -43,13 +43,13 @@ func TestDuck_request(t *testing.T) {
 	d := &Duck{}
 	for i, tt := range tbl {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			ok, req := d.request(tt.text)
+			cmd, ok := d.Commands().Match(tt.text)
 			if !tt.ok {
 				assert.False(t, ok)
 				return
 			}
 			assert.True(t, ok)
-			assert.Equal(t, tt.req, req)
+			assert.Equal(t, tt.req, cmd.Args)
 		})
 	}
 }
@@ -9,6 +9,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // Excerpt bot, returns link excerpt
@@ -71,7 +73,7 @@ func (e *Excerpt) OnMessage(msg Message) (response Response) {
 	}
 
 	return Response{
-		Text: fmt.Sprintf("%s\n\n_%s_", r.Excerpt, r.Title),
+		Text: format.Markdown(format.Text(r.Excerpt+"\n\n"), format.Italic(format.Text(r.Title))),
 		Send: true,
 	}
 }
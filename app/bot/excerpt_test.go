@@ -44,11 +44,11 @@ func TestExcerpt(t *testing.T) {
 		excerpt string
 		fail    bool
 	}{
-		{"https://radio-t.com/p/2016/11/06/bot/", "В выпуске 520 была озвучена идея “сделай своего бота для любимого подкаста”." +
-			" Я создал репо для этого дела где попытался описать как и что. Надеюсь, " +
-			"получилось понятно. В двух словах - каждый ваш бот это микро-рест запакованный в контейнер и " +
-			"получающий все сообщения из нашего чата. Если боту есть ...\n\n" +
-			"_Больше ботов, хороших и разных — Радио-Т Подкаст_", false},
+		{"https://radio-t.com/p/2016/11/06/bot/", "В выпуске 520 была озвучена идея “сделай своего бота для любимого подкаста”\\." +
+			" Я создал репо для этого дела где попытался описать как и что\\. Надеюсь, " +
+			"получилось понятно\\. В двух словах \\- каждый ваш бот это микро\\-рест запакованный в контейнер и " +
+			"получающий все сообщения из нашего чата\\. Если боту есть \\.\\.\\.\n\n" +
+			"_Больше ботов, хороших и разных — Радио\\-Т Подкаст_", false},
 		{"https://xxxx.radio-t.com blah2", "", true},
 	}
 
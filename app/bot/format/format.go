@@ -0,0 +1,177 @@
+// Package format renders formatted text of telegram messages. Text made of typed parts, each part escaped
+// as required by the parse mode, so text taken from outside, usernames and urls never break formatting.
+package format
+
+import (
+	"html"
+	"strings"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Part is a piece of formatted text
+type Part interface {
+	render(sb *strings.Builder, mode string)
+}
+
+// Markdown renders parts to MarkdownV2, default parse mode of bot responses
+func Markdown(parts ...Part) string {
+	return Render(tbapi.ModeMarkdownV2, parts...)
+}
+
+// HTML renders parts to HTML
+func HTML(parts ...Part) string {
+	return Render(tbapi.ModeHTML, parts...)
+}
+
+// Render renders parts in the parse mode, tbapi.ModeMarkdownV2 or tbapi.ModeHTML. Other modes render plain text.
+func Render(mode string, parts ...Part) string {
+	sb := strings.Builder{}
+	for _, p := range parts {
+		p.render(&sb, mode)
+	}
+	return sb.String()
+}
+
+// Escape returns text escaped for the parse mode
+func Escape(mode, text string) string {
+	return Render(mode, Text(text))
+}
+
+// Text makes plain text part
+func Text(text string) Part {
+	return plain(text)
+}
+
+// Bold makes bold part of nested parts
+func Bold(parts ...Part) Part {
+	return entity{md: "*", tag: "b", parts: parts}
+}
+
+// Italic makes italic part of nested parts
+func Italic(parts ...Part) Part {
+	return entity{md: "_", tag: "i", parts: parts}
+}
+
+// Link makes parts linked to the url
+func Link(url string, parts ...Part) Part {
+	return link{url: url, parts: parts}
+}
+
+// Mention makes mention of user by username, without "@"
+func Mention(username string) Part {
+	return plain("@" + username)
+}
+
+// Code makes inline fixed-width code
+func Code(text string) Part {
+	return code{text: text}
+}
+
+// Pre makes pre-formatted fixed-width code block
+func Pre(text string) Part {
+	return code{text: text, block: true}
+}
+
+type plain string
+
+func (p plain) render(sb *strings.Builder, mode string) {
+	switch mode {
+	case tbapi.ModeMarkdownV2:
+		sb.WriteString(escapeMarkdown(string(p), "_*[]()~`>#+-=|{}.!\\"))
+	case tbapi.ModeHTML:
+		sb.WriteString(html.EscapeString(string(p)))
+	default:
+		sb.WriteString(string(p))
+	}
+}
+
+type entity struct {
+	md, tag string
+	parts   []Part
+}
+
+func (e entity) render(sb *strings.Builder, mode string) {
+	switch mode {
+	case tbapi.ModeMarkdownV2:
+		e.marker(sb)
+		e.renderParts(sb, mode)
+		e.marker(sb)
+	case tbapi.ModeHTML:
+		sb.WriteString("<" + e.tag + ">")
+		e.renderParts(sb, mode)
+		sb.WriteString("</" + e.tag + ">")
+	default:
+		e.renderParts(sb, mode)
+	}
+}
+
+// marker writes markdown marker of the entity. Markers of adjacent italic entities separated with "\r",
+// ignored by telegram, as "__" is underline.
+func (e entity) marker(sb *strings.Builder) {
+	prev := strings.TrimSuffix(sb.String(), "_")
+	escapes := len(prev) - len(strings.TrimRight(prev, `\`)) // odd number of backslashes escapes "_"
+	if e.md == "_" && prev != sb.String() && escapes%2 == 0 {
+		sb.WriteString("\r")
+	}
+	sb.WriteString(e.md)
+}
+
+func (e entity) renderParts(sb *strings.Builder, mode string) {
+	for _, p := range e.parts {
+		p.render(sb, mode)
+	}
+}
+
+type link struct {
+	url   string
+	parts []Part
+}
+
+func (l link) render(sb *strings.Builder, mode string) {
+	switch mode {
+	case tbapi.ModeMarkdownV2:
+		sb.WriteString("[")
+		entity{parts: l.parts}.renderParts(sb, mode)
+		sb.WriteString("](" + escapeMarkdown(l.url, ")\\") + ")")
+	case tbapi.ModeHTML:
+		sb.WriteString(`<a href="` + html.EscapeString(l.url) + `">`)
+		entity{parts: l.parts}.renderParts(sb, mode)
+		sb.WriteString("</a>")
+	default:
+		entity{parts: l.parts}.renderParts(sb, mode)
+		sb.WriteString(" (" + l.url + ")")
+	}
+}
+
+type code struct {
+	text  string
+	block bool
+}
+
+func (c code) render(sb *strings.Builder, mode string) {
+	switch {
+	case mode == tbapi.ModeMarkdownV2 && c.block:
+		sb.WriteString("```\n" + escapeMarkdown(c.text, "`\\") + "\n```")
+	case mode == tbapi.ModeMarkdownV2:
+		sb.WriteString("`" + escapeMarkdown(c.text, "`\\") + "`")
+	case mode == tbapi.ModeHTML && c.block:
+		sb.WriteString("<pre>" + html.EscapeString(c.text) + "</pre>")
+	case mode == tbapi.ModeHTML:
+		sb.WriteString("<code>" + html.EscapeString(c.text) + "</code>")
+	default:
+		sb.WriteString(c.text)
+	}
+}
+
+// escapeMarkdown prepends each of special characters in text with backslash
+func escapeMarkdown(text, special string) string {
+	sb := strings.Builder{}
+	for _, r := range text {
+		if strings.ContainsRune(special, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,49 @@
+package format
+
+import (
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	parts := []Part{
+		Text("user_name (admin) 1.5! "),
+		Bold(Text("bold "), Italic(Text("nested*"))),
+		Text(" "),
+		Link("https://example.com/a_(b)?c=1&d=2", Text("[go] <news>")),
+		Text(" "),
+		Mention("some_user"),
+		Text(" "),
+		Code("a`b\\c"),
+		Pre("x := `y`"),
+	}
+
+	tbl := []struct {
+		mode, res string
+	}{
+		{tbapi.ModeMarkdownV2, "user\\_name \\(admin\\) 1\\.5\\! *bold _nested\\*_* " +
+			"[\\[go\\] <news\\>](https://example.com/a_(b\\)?c=1&d=2) @some\\_user `a\\`b\\\\c`" + "```\nx := \\`y\\`\n```"},
+		{tbapi.ModeHTML, "user_name (admin) 1.5! <b>bold <i>nested*</i></b> " +
+			`<a href="https://example.com/a_(b)?c=1&amp;d=2">[go] &lt;news&gt;</a> @some_user <code>a` + "`" +
+			`b\c</code><pre>x := ` + "`y`</pre>"},
+		{"", "user_name (admin) 1.5! bold nested* [go] <news> (https://example.com/a_(b)?c=1&d=2) @some_user a`b\\cx := `y`"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.mode, func(t *testing.T) {
+			assert.Equal(t, tt.res, Render(tt.mode, parts...))
+		})
+	}
+
+	assert.Equal(t, Render(tbapi.ModeMarkdownV2, parts...), Markdown(parts...))
+	assert.Equal(t, Render(tbapi.ModeHTML, parts...), HTML(parts...))
+	assert.Equal(t, "a\\.b", Escape(tbapi.ModeMarkdownV2, "a.b"))
+}
+
+func TestRender_AdjacentItalic(t *testing.T) {
+	assert.Equal(t, "_a_\r_b_", Markdown(Italic(Text("a")), Italic(Text("b"))))
+	assert.Equal(t, "_\r_a_\r_", Markdown(Italic(Italic(Text("a")))))
+	assert.Equal(t, "a\\__b_", Markdown(Text("a_"), Italic(Text("b"))), "escaped underscore")
+	assert.Equal(t, "*a**b*", Markdown(Bold(Text("a")), Bold(Text("b"))))
+}
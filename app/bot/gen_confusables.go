@@ -0,0 +1,114 @@
+//go:build ignore
+
+// gen_confusables makes confusables_table.go from Unicode confusables data (UTS #39), mapping each look-alike
+// character to its prototype. Reads confusables.txt from unicode.org, or from local file set with -in.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultURL = "https://www.unicode.org/Public/security/15.1.0/confusables.txt"
+
+func main() {
+	in := flag.String("in", "", "local confusables.txt, downloaded from -url if not set")
+	url := flag.String("url", defaultURL, "confusables.txt url")
+	out := flag.String("out", "confusables_table.go", "output file")
+	flag.Parse()
+
+	src, origin, err := open(*in, *url)
+	if err != nil {
+		log.Fatalf("[ERROR] can't read confusables, %v", err)
+	}
+	defer src.Close()
+
+	table, err := parse(src)
+	if err != nil {
+		log.Fatalf("[ERROR] can't parse %s, %v", origin, err)
+	}
+
+	keys := make([]rune, 0, len(table))
+	for r := range table {
+		keys = append(keys, r)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "// Code generated by gen_confusables.go from %s; DO NOT EDIT.\n\n", origin)
+	fmt.Fprintf(&buf, "package bot\n\n")
+	fmt.Fprintf(&buf, "// confusables maps look-alike characters to their prototypes, %d mappings of UTS #39\n", len(keys))
+	fmt.Fprintf(&buf, "var confusables = map[rune]string{\n")
+	for _, r := range keys {
+		fmt.Fprintf(&buf, "\t0x%04X: %q, // %q\n", r, table[r], string(r))
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	res, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("[ERROR] can't format generated table, %v", err)
+	}
+	if err := os.WriteFile(*out, res, 0o600); err != nil {
+		log.Fatalf("[ERROR] can't write %s, %v", *out, err)
+	}
+	log.Printf("[INFO] %d confusables from %s written to %s", len(keys), origin, *out)
+}
+
+// open returns local file if set, otherwise downloads url
+func open(path, url string) (src io.ReadCloser, origin string, err error) {
+	if path != "" {
+		f, err := os.Open(path) // nolint
+		return f, filepath.Base(path), err
+	}
+	resp, err := http.Get(url) // nolint
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("request %s returned %s", url, resp.Status)
+	}
+	return resp.Body, url, nil
+}
+
+// parse reads lines "source ; target ; type # comment" with code points in hex, i.e. "0430 ;	0061 ;	MA"
+func parse(r io.Reader) (map[rune]string, error) {
+	res := map[rune]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("bad line %q", scanner.Text())
+		}
+		src, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad source in %q: %w", scanner.Text(), err)
+		}
+		target := strings.Builder{}
+		for _, cp := range strings.Fields(fields[1]) {
+			r, err := strconv.ParseUint(cp, 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("bad target in %q: %w", scanner.Text(), err)
+			}
+			target.WriteRune(rune(r))
+		}
+		res[rune(src)] = target.String()
+	}
+	return res, scanner.Err()
+}
@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Managed is a named bot which can be turned off and on at runtime, i.e. with admin commands.
+// Turned off bot doesn't answer and isn't shown in help. Failures reported by the bot with Response.Error
+// and timeouts detected by MultiBot are kept as the last error.
+// Answers of the bot deleted with messages triggered them after TTL, if set.
+// Timeout, if set, replaces MultiBot's one for this bot, i.e. longer for slow OpenAI.
+type Managed struct {
+	Interface
+	name    string
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu      sync.Mutex
+	off     bool
+	lastErr struct {
+		err error
+		ts  time.Time
+	}
+}
+
+// NewManaged makes managed bot with given name, turned on
+func NewManaged(name string, b Interface) *Managed {
+	return &Managed{Interface: b, name: name}
+}
+
+// WithTTL sets time to keep answers of the bot and messages triggered them in chat, applied to answers without TTL
+func (m *Managed) WithTTL(ttl time.Duration) *Managed {
+	m.ttl = ttl
+	return m
+}
+
+// WithTimeout sets max time for the bot to answer, MultiBot's timeout used if 0
+func (m *Managed) WithTimeout(timeout time.Duration) *Managed {
+	m.timeout = timeout
+	return m
+}
+
+// Timeout returns max time for the bot to answer, 0 if not set
+func (m *Managed) Timeout() time.Duration {
+	return m.timeout
+}
+
+// Name returns bot's name
+func (m *Managed) Name() string {
+	return m.name
+}
+
+// Enabled returns true if bot is turned on
+func (m *Managed) Enabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.off
+}
+
+// SetEnabled turns bot on or off
+func (m *Managed) SetEnabled(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.off = !enabled
+}
+
+// LastError returns the last error of the bot with its time, nil if no errors happened
+func (m *Managed) LastError() (err error, ts time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastErr.err, m.lastErr.ts
+}
+
+// OnMessage passes message to the wrapped bot if it is turned on
+func (m *Managed) OnMessage(msg Message) Response {
+	return m.OnMessageContext(context.Background(), msg)
+}
+
+// OnMessageContext passes message to the wrapped bot if it is turned on
+func (m *Managed) OnMessageContext(ctx context.Context, msg Message) Response {
+	if !m.Enabled() {
+		return Response{}
+	}
+	resp := WithContext(m.Interface).OnMessageContext(ctx, msg)
+	if resp.Error != nil {
+		m.setError(resp.Error)
+	}
+	if resp.Send && resp.TTL == 0 && m.ttl > 0 {
+		resp.TTL, resp.DeleteTrigger = m.ttl, true
+	}
+	return resp
+}
+
+// Help returns help message of the wrapped bot, empty if turned off
+func (m *Managed) Help() string {
+	if !m.Enabled() {
+		return ""
+	}
+	return m.Interface.Help()
+}
+
+// Commands returns commands of the wrapped bot, none if turned off, so not shown in telegram menu
+func (m *Managed) Commands() Commands {
+	if !m.Enabled() {
+		return nil
+	}
+	if c, ok := m.Interface.(Commander); ok {
+		return c.Commands()
+	}
+	return nil
+}
+
+func (m *Managed) setError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastErr.err = err
+	m.lastErr.ts = time.Now()
+}
@@ -0,0 +1,292 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
+)
+
+// Moderation bot applies rules from moderation.data to messages: warns, deletes the message, mutes or bans
+// its author. Superusers are exempt. Rules reloaded on file change or by "reload!" admin command, file with bad rules
+// rejected on reload. Actions saved to moderation log.
+type Moderation struct {
+	superUser   SuperUser
+	path        string
+	modLog      ModerationLog
+	reloadCheck time.Duration // rules file checked for changes not more often, tests may change it
+
+	mu      sync.Mutex
+	rules   []moderationRule
+	modTime time.Time // of the loaded rules file
+	checked time.Time // last check of the rules file
+}
+
+// ModerationLog keeps moderation actions, i.e. reporter.Reporter
+type ModerationLog interface {
+	SaveModeration(rec ModerationRecord)
+}
+
+// ModerationRecord is an action of moderation bot
+type ModerationRecord struct {
+	Time      time.Time
+	ChatID    int64
+	User      User
+	MessageID int
+	Text      string        // moderated message
+	Rule      string        // pattern of the rule
+	Action    string        // warn, delete, mute or ban
+	Duration  time.Duration `json:",omitempty"` // mute duration
+	Reason    string
+}
+
+// moderation actions
+const (
+	modWarn   = "warn"
+	modDelete = "delete"
+	modMute   = "mute"
+	modBan    = "ban"
+)
+
+// moderationRule is a line of moderation.data, "pattern|action|reason". Pattern is a phrase matched
+// regardless of look-alike characters, or regular expression with "re:" prefix. Action is "warn", "delete",
+// "mute <duration>" or "ban".
+type moderationRule struct {
+	pattern  string
+	phrase   *ConfusableMatcher
+	re       *regexp.Regexp
+	action   string
+	duration time.Duration
+	reason   string
+}
+
+// NewModeration makes moderation bot with rules from moderation.data in data location, the file is optional.
+// Bad rules skipped on start.
+func NewModeration(dataLocation string, superUser SuperUser, modLog ModerationLog) (*Moderation, error) {
+	log.Printf("[INFO] moderation bot, data location=%s", dataLocation)
+	m := &Moderation{superUser: superUser, path: filepath.Join(dataLocation, "moderation.data"), modLog: modLog,
+		reloadCheck: 10 * time.Second}
+	rules, modTime, err := m.load()
+	if err != nil && !isBadLines(err) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	m.rules, m.modTime = rules, modTime
+	return m, nil
+}
+
+// Reload reads rules now, regardless of file changes. Rules replaced only if all of them are good.
+func (m *Moderation) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules, modTime, err := m.load()
+	if err != nil {
+		return err
+	}
+	m.rules, m.modTime, m.checked = rules, modTime, time.Now()
+	return nil
+}
+
+// OnMessage applies the first matching rule to the message
+func (m *Moderation) OnMessage(msg Message) (response Response) {
+	if m.superUser.IsSuper(msg.From.Username) {
+		return Response{}
+	}
+
+	text := msg.Text
+	if msg.Image != nil {
+		text = msg.Image.Caption
+	}
+	rule, ok := m.match(text)
+	if !ok {
+		return Response{}
+	}
+
+	mention := "@" + msg.From.Username
+	if msg.From.Username == "" {
+		mention = msg.From.DisplayName
+	}
+	log.Printf("[INFO] moderation rule %q, %s for %s: %q", rule.pattern, rule.action, mention, text)
+	if m.modLog != nil {
+		m.modLog.SaveModeration(ModerationRecord{Time: time.Now(), ChatID: msg.ChatID, User: msg.From, MessageID: msg.ID,
+			Text: text, Rule: rule.pattern, Action: rule.action, Duration: rule.duration, Reason: rule.reason})
+	}
+
+	switch rule.action {
+	case modWarn:
+		return Response{Send: true, ReplyTo: msg.ID,
+			Text: format.Markdown(format.Text(mention+" "), format.Italic(format.Text("предупреждение: "+rule.reason)))}
+	case modDelete:
+		return Response{Send: true, DeleteID: msg.ID,
+			Text: format.Markdown(format.Text(fmt.Sprintf("сообщение %s удалено: %s", mention, rule.reason)))}
+	case modMute:
+		return Response{Send: true, DeleteID: msg.ID, BanInterval: rule.duration, User: msg.From, BanReason: rule.reason,
+			Text: format.Markdown(format.Text(fmt.Sprintf("%s получает бан на %s: %s", mention,
+				HumanizeDuration(rule.duration), rule.reason)))}
+	case modBan:
+		return Response{Send: true, DeleteID: msg.ID, BanInterval: banForever, User: msg.From, BanReason: rule.reason,
+			Text: format.Markdown(format.Text(fmt.Sprintf("%s получает бан навсегда: %s", mention, rule.reason)))}
+	}
+	return Response{}
+}
+
+// ChecksEdits returns true, rules apply to edited messages as well
+func (m *Moderation) ChecksEdits() bool {
+	return true
+}
+
+// ReactOn keys
+func (m *Moderation) ReactOn() []string {
+	return []string{}
+}
+
+// Help returns help message
+func (m *Moderation) Help() string {
+	return ""
+}
+
+// match returns the first rule matching the text, rules reloaded before if the file changed
+func (m *Moderation) match(text string) (moderationRule, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.checked) >= m.reloadCheck {
+		m.checked = time.Now()
+		if err := m.reload(); err != nil {
+			log.Printf("[WARN] can't reload moderation rules, previous kept, %v", err)
+		}
+	}
+	if text == "" {
+		return moderationRule{}, false
+	}
+	skeleton := Skeleton(text)
+	for _, r := range m.rules {
+		if r.phrase != nil {
+			if _, ok := r.phrase.Match(text); ok {
+				return r, true
+			}
+			continue
+		}
+		if r.re.MatchString(text) || r.re.MatchString(skeleton) {
+			return r, true
+		}
+	}
+	return moderationRule{}, false
+}
+
+// reload loads rules if the file changed since the last load, called under lock
+func (m *Moderation) reload() error {
+	fi, err := os.Stat(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		if len(m.rules) > 0 {
+			log.Printf("[INFO] %s removed, no moderation rules", m.path)
+		}
+		m.rules, m.modTime = nil, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't check %s: %w", m.path, err)
+	}
+	if fi.ModTime().Equal(m.modTime) {
+		return nil
+	}
+	rules, modTime, err := m.load()
+	if err != nil {
+		if isBadLines(err) {
+			m.modTime = modTime // not retried till the next change
+		}
+		return err
+	}
+	m.rules, m.modTime = rules, modTime
+	return nil
+}
+
+// load reads rules with modification time of the file. Rules of good lines returned with *badLinesError as well.
+func (m *Moderation) load() ([]moderationRule, time.Time, error) {
+	fi, err := os.Stat(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("[INFO] no %s, skipped", m.path)
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("can't check %s: %w", m.path, err)
+	}
+	lines, err := readLines(m.path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("can't load moderation rules: %w", err)
+	}
+
+	rules := []moderationRule{}
+	bad := badLinesError{file: filepath.Base(m.path)}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := parseModerationRule(line)
+		if err != nil {
+			bad.add(i, err.Error())
+			continue
+		}
+		rules = append(rules, r)
+	}
+	log.Printf("[INFO] loaded %d moderation rules", len(rules))
+	if len(bad.lines) > 0 {
+		return rules, fi.ModTime(), &bad
+	}
+	return rules, fi.ModTime(), nil
+}
+
+func parseModerationRule(line string) (moderationRule, error) {
+	elems := strings.Split(line, "|")
+	if len(elems) < 3 {
+		return moderationRule{}, fmt.Errorf("expected pattern|action|reason")
+	}
+	// regular expression may have "|" as well
+	elems = []string{strings.Join(elems[:len(elems)-2], "|"), elems[len(elems)-2], elems[len(elems)-1]}
+	res := moderationRule{pattern: strings.TrimSpace(elems[0]), reason: strings.TrimSpace(elems[2])}
+	if res.reason == "" {
+		return moderationRule{}, fmt.Errorf("empty reason")
+	}
+
+	if expr, ok := strings.CutPrefix(res.pattern, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return moderationRule{}, fmt.Errorf("bad regular expression: %w", err)
+		}
+		res.re = re
+	} else {
+		res.phrase = NewConfusableMatcher(res.pattern)
+		if res.phrase.Len() == 0 {
+			return moderationRule{}, fmt.Errorf("empty pattern")
+		}
+	}
+
+	action := strings.Fields(elems[1])
+	if len(action) == 0 {
+		return moderationRule{}, fmt.Errorf("empty action")
+	}
+	res.action = strings.ToLower(action[0])
+	switch {
+	case res.action == modMute && len(action) == 2:
+		d, err := time.ParseDuration(action[1])
+		if err != nil || d <= 0 {
+			return moderationRule{}, fmt.Errorf("bad mute duration %q", action[1])
+		}
+		res.duration = d
+	case res.action == modMute:
+		return moderationRule{}, fmt.Errorf("mute needs duration, i.e. \"mute 1h\"")
+	case len(action) > 1:
+		return moderationRule{}, fmt.Errorf("unexpected %q after %s", strings.Join(action[1:], " "), res.action)
+	case res.action != modWarn && res.action != modDelete && res.action != modBan:
+		return moderationRule{}, fmt.Errorf("unknown action %q", res.action)
+	}
+	return res, nil
+}
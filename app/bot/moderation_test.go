@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+type moderationLogMock struct {
+	records []ModerationRecord
+}
+
+func (m *moderationLogMock) SaveModeration(rec ModerationRecord) {
+	m.records = append(m.records, rec)
+}
+
+func TestModeration_OnMessage(t *testing.T) {
+	dir := t.TempDir()
+	rules := "# comment\n" +
+		"казино|delete|реклама казино\n" +
+		"re:t\\.me/(joinchat|\\+)|warn|приглашения в закрытые группы\n" +
+		"пишите в лс|mute 1h|спам\n" +
+		"porn|ban|порно\n" +
+		"bad line\n" +
+		"re:[|warn|bad regex\n" +
+		"слово|mute|no duration\n" +
+		"слово|kick|unknown action\n" +
+		"слово|warn|\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "moderation.data"), []byte(rules), 0o600))
+
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	modLog := &moderationLogMock{}
+	m, err := NewModeration(dir, su, modLog)
+	require.NoError(t, err)
+	require.Len(t, m.rules, 4, "bad rules skipped")
+
+	user := User{ID: 1, Username: "user"}
+	tbl := []struct {
+		text string
+		resp Response
+	}{
+		{"привет", Response{}},
+		{"лучшее кaзинo тут", Response{Send: true, DeleteID: 10, Text: "сообщение @user удалено: реклама казино"}},
+		{"заходи t.mе/+abc", Response{Send: true, ReplyTo: 10, Text: "@user _предупреждение: приглашения в закрытые группы_"}},
+		{"t.me/joinchat/abc", Response{Send: true, ReplyTo: 10, Text: "@user _предупреждение: приглашения в закрытые группы_"}},
+		{"t.me/channel", Response{}},
+		{"Пишите в ЛС", Response{Send: true, DeleteID: 10, BanInterval: time.Hour, User: user, BanReason: "спам",
+			Text: "@user получает бан на 1ч: спам"}},
+		{"р.о.r.n", Response{Send: true, DeleteID: 10, BanInterval: banForever, User: user, BanReason: "порно",
+			Text: "@user получает бан навсегда: порно"}},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.resp, m.OnMessage(Message{ID: 10, ChatID: 123, From: user, Text: tt.text}))
+		})
+	}
+
+	require.Len(t, modLog.records, 5)
+	rec := modLog.records[3]
+	assert.Equal(t, "mute", rec.Action)
+	assert.Equal(t, "пишите в лс", rec.Rule)
+	assert.Equal(t, time.Hour, rec.Duration)
+	assert.Equal(t, int64(123), rec.ChatID)
+	assert.Equal(t, 10, rec.MessageID)
+	assert.Equal(t, user, rec.User)
+	assert.Equal(t, "Пишите в ЛС", rec.Text)
+
+	assert.Equal(t, Response{}, m.OnMessage(Message{ID: 11, From: User{Username: "admin"}, Text: "казино"}), "superuser exempt")
+	resp := m.OnMessage(Message{ID: 12, From: User{DisplayName: "Other"}, Image: &Image{Caption: "казино"}})
+	assert.Equal(t, Response{Send: true, DeleteID: 12, Text: "сообщение Other удалено: реклама казино"}, resp, "caption checked")
+	assert.True(t, m.ChecksEdits())
+}
+
+func TestModeration_reload(t *testing.T) {
+	dir := t.TempDir()
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return false }}
+	m, err := NewModeration(dir, su, nil)
+	require.NoError(t, err)
+	m.reloadCheck = 0
+	assert.Equal(t, Response{}, m.OnMessage(Message{Text: "казино"}), "no rules file")
+
+	file := filepath.Join(dir, "moderation.data")
+	require.NoError(t, os.WriteFile(file, []byte("казино|delete|реклама\n"), 0o600))
+	assert.True(t, m.OnMessage(Message{Text: "казино"}).Send, "new file loaded")
+
+	require.NoError(t, os.WriteFile(file, []byte("ставки|delete|реклама\n"), 0o600))
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)))
+	assert.False(t, m.OnMessage(Message{Text: "казино"}).Send, "changed file reloaded")
+	assert.True(t, m.OnMessage(Message{Text: "ставки"}).Send)
+
+	m.reloadCheck = time.Hour
+	require.NoError(t, os.Remove(file))
+	assert.True(t, m.OnMessage(Message{Text: "ставки"}).Send, "not checked yet")
+	m.reloadCheck = 0
+	assert.False(t, m.OnMessage(Message{Text: "ставки"}).Send, "removed file")
+}
+
+func TestModeration_Reload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "moderation.data")
+	require.NoError(t, os.WriteFile(file, []byte("казино|delete|реклама\n"), 0o600))
+	m, err := NewModeration(dir, &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return false }}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(file, []byte("ставки|delete|реклама\nслово|kick|непонятно\n"), 0o600))
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)))
+	assert.EqualError(t, m.Reload(), "bad lines in moderation.data: line 2: unknown action \"kick\"")
+	m.reloadCheck = 0
+	assert.True(t, m.OnMessage(Message{Text: "казино"}).Send, "previous rules kept")
+	assert.False(t, m.OnMessage(Message{Text: "ставки"}).Send, "changed file with bad rules rejected")
+
+	require.NoError(t, os.WriteFile(file, []byte("ставки|delete|реклама\n"), 0o600))
+	require.NoError(t, m.Reload())
+	assert.False(t, m.OnMessage(Message{Text: "казино"}).Send)
+	assert.True(t, m.OnMessage(Message{Text: "ставки"}).Send)
+}
+
+func TestModeration_NoRules(t *testing.T) {
+	m, err := NewModeration(t.TempDir(), nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, m.rules)
+	assert.Equal(t, "", m.Help())
+	assert.Empty(t, m.ReactOn())
+
+	_, err = NewModeration("/dev/null", nil, nil)
+	assert.Error(t, err)
+}
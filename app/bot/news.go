@@ -1,11 +1,14 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"strings"
+	"strconv"
 	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // News bot, returns numArticles last articles in MD format from https://news.radio-t.com/api/v1/news/lastmd/5
@@ -29,19 +32,31 @@ func NewNews(client HTTPClient, api string, max int) *News {
 
 // Help returns help message
 func (n News) Help() string {
-	return GenHelpMsg(n.ReactOn(), "5 последних новостей для Радио-Т")
+	return n.Commands().Help()
+}
+
+// Commands returns news command
+func (n News) Commands() Commands {
+	return Commands{{Triggers: []string{"news!", "новости!"}, Description: "5 последних новостей для Радио-Т"}}
 }
 
 // OnMessage returns N last news articles
 func (n News) OnMessage(msg Message) (response Response) {
-	if !contains(n.ReactOn(), msg.Text) {
+	return n.OnMessageContext(context.Background(), msg)
+}
+
+// OnMessageContext returns N last news articles, request to news api canceled with ctx.
+// Response has "more" button, pressed button shows the next N articles in the same message.
+func (n News) OnMessageContext(ctx context.Context, msg Message) (response Response) {
+	count, ok := n.count(msg)
+	if !ok {
 		return Response{}
 	}
 
-	reqURL := fmt.Sprintf("%s/v1/news/last/%d", n.newsAPI, n.numArticles)
+	reqURL := fmt.Sprintf("%s/v1/news/last/%d", n.newsAPI, count)
 	log.Printf("[DEBUG] request %s", reqURL)
 
-	req, err := makeHTTPRequest(reqURL)
+	req, err := makeHTTPRequest(ctx, reqURL)
 	if err != nil {
 		log.Printf("[WARN] failed to make request %s, error=%v", reqURL, err)
 		return Response{}
@@ -50,30 +65,57 @@ func (n News) OnMessage(msg Message) (response Response) {
 	resp, err := n.client.Do(req)
 	if err != nil {
 		log.Printf("[WARN] failed to send request %s, error=%v", reqURL, err)
-		return Response{}
+		return Response{Error: fmt.Errorf("failed to send request %s: %w", reqURL, err)}
 	}
 	defer resp.Body.Close() // nolint
 
 	articles := []newsArticle{}
 	if err = json.NewDecoder(resp.Body).Decode(&articles); err != nil {
 		log.Printf("[WARN] failed to parse response, error %v", err)
+		return Response{Error: fmt.Errorf("failed to parse response: %w", err)}
+	}
+
+	shown := count - n.numArticles // already shown on previous pages
+	if shown >= len(articles) {
 		return Response{}
 	}
 
-	lines := make([]string, 0, len(articles))
-	for _, a := range articles {
+	var text []format.Part
+	for _, a := range articles[shown:] {
 		if a.Title == "" {
 			a.Title = "безымянная новость"
 		}
-		lines = append(lines, fmt.Sprintf("- [%s](%s) %s", a.Title, a.Link, a.Ts.Format("2006-01-02")))
+		text = append(text, format.Text("- "), format.Link(a.Link, format.Text(a.Title)), format.Text(" "+a.Ts.Format("2006-01-02")+"\n"))
 	}
-	return Response{
-		Text: strings.Join(lines, "\n") + "\n- [все новости и темы](https://news.radio-t.com)",
+	text = append(text, format.Text("- "), format.Link("https://news.radio-t.com", format.Text("все новости и темы")))
+	response = Response{
+		Text: format.Markdown(text...),
 		Send: true,
 	}
+	if msg.Callback != nil {
+		response.EditID = msg.ID
+	}
+	if len(articles) == count {
+		response.Buttons = [][]Button{{{Text: "ещё", Data: strconv.Itoa(count + n.numArticles)}}}
+	}
+	return response
+}
+
+// count returns number of the last articles to request, from the command or pressed "more" button
+func (n News) count(msg Message) (int, bool) {
+	if msg.Callback == nil {
+		_, ok := n.Commands().Match(msg.Text)
+		return n.numArticles, ok
+	}
+	count, err := strconv.Atoi(msg.Callback.Data)
+	if err != nil || count <= n.numArticles {
+		log.Printf("[WARN] unexpected news callback %q", msg.Callback.Data)
+		return 0, false
+	}
+	return count, true
 }
 
 // ReactOn keys
 func (n News) ReactOn() []string {
-	return []string{"news!", "новости!"}
+	return n.Commands().ReactOn()
 }
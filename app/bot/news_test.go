@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -38,8 +39,8 @@ func TestNewsBot_ReactionOnNewsRequest(t *testing.T) {
 
 	require.Equal(
 		t,
-		Response{Text: "- [title1](link1) 2020-02-09\n- [безымянная новость](link2) 2020-02-10" +
-			"\n- [все новости и темы](https://news.radio-t.com)", Send: true},
+		Response{Text: "\\- [title1](link1) 2020\\-02\\-09\n\\- [безымянная новость](link2) 2020\\-02\\-10" +
+			"\n\\- [все новости и темы](https://news.radio-t.com)", Send: true},
 		b.OnMessage(Message{Text: "news!"}),
 	)
 }
@@ -60,7 +61,7 @@ func TestNewsBot_ReactionOnNewsRequestAlt(t *testing.T) {
 
 	require.Equal(
 		t,
-		Response{Text: "- [title](link) 0001-01-01\n- [все новости и темы](https://news.radio-t.com)", Send: true},
+		Response{Text: "\\- [title](link) 0001\\-01\\-01\n\\- [все новости и темы](https://news.radio-t.com)", Send: true},
 		b.OnMessage(Message{Text: "news!"}),
 	)
 }
@@ -70,3 +71,29 @@ func TestNewsBot_ReactionOnUnexpectedMessage(t *testing.T) {
 	b := NewNews(mockHTTP, "", 5)
 	require.Equal(t, Response{}, b.OnMessage(Message{Text: "unexpected"}))
 }
+
+func TestNewsBot_More(t *testing.T) {
+	var urls []string
+	mockHTTP := &mocks.HTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		urls = append(urls, req.URL.String())
+		articles := []newsArticle{{Title: "t1", Link: "l1"}, {Title: "t2", Link: "l2"}, {Title: "t3", Link: "l3"}}
+		if strings.HasSuffix(req.URL.Path, "/2") {
+			articles = articles[:2]
+		}
+		articleJSON, err := json.Marshal(articles)
+		require.NoError(t, err)
+		return &http.Response{Body: io.NopCloser(bytes.NewReader(articleJSON))}, nil
+	}}
+	b := NewNews(mockHTTP, "http://example.com", 2)
+
+	resp := b.OnMessage(Message{Text: "news!"})
+	require.Equal(t, [][]Button{{{Text: "ещё", Data: "4"}}}, resp.Buttons)
+	require.Contains(t, resp.Text, "[t2](l2)")
+
+	resp = b.OnMessage(Message{ID: 7, Callback: &Callback{ID: "1", Data: "4"}})
+	require.Equal(t, Response{Text: "\\- [t3](l3) 0001\\-01\\-01\n\\- [все новости и темы](https://news.radio-t.com)", Send: true,
+		EditID: 7}, resp)
+
+	require.Equal(t, Response{}, b.OnMessage(Message{Callback: &Callback{ID: "1", Data: "2"}}))
+	require.Equal(t, []string{"http://example.com/v1/news/last/2", "http://example.com/v1/news/last/4"}, urls)
+}
@@ -6,13 +6,14 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
-	"strings"
 	"time"
 
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	tokenizer "github.com/sandwich-go/gpt3-encoder"
 	"github.com/sashabaranov/go-openai"
 
 	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 //go:generate moq --out mocks/openai_client.go --pkg mocks --skip-ensure . openAIClient:OpenAIClient
@@ -33,9 +34,12 @@ type Params struct {
 	Prompt                  string
 	EnableAutoResponse      bool
 	HistorySize             int
-	HistoryReplyProbability int // Percentage of the probability to reply with history
+	HistoryReplyProbability int         // Percentage of the probability to reply with history
+	Store                   bot.KVStore // keeps time of the last request across restarts, optional
 }
 
+const openAIBucket = "openai"
+
 // OpenAI bot, returns responses from ChatGPT via OpenAI API
 type OpenAI struct {
 	client openAIClient
@@ -60,12 +64,23 @@ func NewOpenAI(params Params, httpClient *http.Client, superUser bot.SuperUser)
 	client := openai.NewClientWithConfig(openAIConfig)
 	history := NewLimitedMessageHistory(params.HistorySize)
 
-	return &OpenAI{client: client, params: params, superUser: superUser,
+	o := &OpenAI{client: client, params: params, superUser: superUser,
 		history: history, rand: rand.Int63n, nowFn: time.Now}
+	if params.Store != nil {
+		if _, err := params.Store.Load(openAIBucket, "last_request", &o.lastDT); err != nil {
+			log.Printf("[WARN] failed to load time of the last request, %v", err)
+		}
+	}
+	return o
 }
 
 // OnMessage pass msg to all bots and collects responses
 func (o *OpenAI) OnMessage(msg bot.Message) (response bot.Response) {
+	return o.OnMessageContext(context.Background(), msg)
+}
+
+// OnMessageContext is OnMessage with requests to OpenAI canceled with ctx
+func (o *OpenAI) OnMessageContext(ctx context.Context, msg bot.Message) (response bot.Response) {
 	ok, reqText := o.request(msg.Text)
 	if !ok {
 		if !o.params.EnableAutoResponse || msg.Text == "idle" || len(msg.Text) < 8 {
@@ -81,32 +96,35 @@ func (o *OpenAI) OnMessage(msg bot.Message) (response bot.Response) {
 			return bot.Response{}
 		}
 
-		responseAI, err := o.chatGPTRequestWithHistory("You answer with no more than 50 words, should be in Russian language")
+		responseAI, err := o.chatGPTRequestWithHistory(ctx, "You answer with no more than 50 words, should be in Russian language")
 		if err != nil {
 			log.Printf("[WARN] failed to make context request to ChatGPT error=%v", err)
-			return bot.Response{}
+			return bot.Response{Error: fmt.Errorf("context request to ChatGPT: %w", err)}
 		}
 		log.Printf("[DEBUG] OpenAI bot answer with history: %q", responseAI)
 		return bot.Response{
-			Text: responseAI,
-			Send: true,
+			Text:      responseAI,
+			Send:      true,
+			ParseMode: tbapi.ModeMarkdown, // answers use legacy markdown, more tolerant to chatgpt's formatting
 		}
 	}
 
-	if ok, banMessage := o.checkRequest(msg.From.Username, reqText); !ok {
+	if ok, banMessage, reason := o.checkRequest(msg.From.Username, reqText); !ok {
 		return bot.Response{
 			Text:        banMessage,
 			Send:        true,
 			BanInterval: time.Hour,
+			BanReason:   reason,
+			Escalate:    true,
 			User:        msg.From,
 			ReplyTo:     msg.ID, // reply to the message
 		}
 	}
 
-	responseAI, err := o.chatGPTRequest(reqText, o.params.Prompt, "You answer with no more than 50 words")
+	responseAI, err := o.chatGPTRequest(ctx, reqText, o.params.Prompt, "You answer with no more than 50 words")
 	if err != nil {
 		log.Printf("[WARN] failed to make request to ChatGPT '%s', error=%v", reqText, err)
-		return bot.Response{}
+		return bot.Response{Error: fmt.Errorf("request to ChatGPT: %w", err)}
 	}
 
 	if ok, banMessage := o.checkResponseAI(msg.From.Username, responseAI); !ok {
@@ -114,6 +132,7 @@ func (o *OpenAI) OnMessage(msg bot.Message) (response bot.Response) {
 			Text:        banMessage,
 			Send:        true,
 			BanInterval: time.Hour,
+			BanReason:   "лотерея chatgpt", // not user's fault, not escalated
 			User:        msg.From,
 			ReplyTo:     msg.ID, // reply to the message
 		}
@@ -121,30 +140,35 @@ func (o *OpenAI) OnMessage(msg bot.Message) (response bot.Response) {
 
 	if !o.superUser.IsSuper(msg.From.Username) {
 		o.lastDT = o.nowFn() // don't update lastDT for super users
+		if o.params.Store != nil {
+			if err := o.params.Store.Save(openAIBucket, "last_request", o.lastDT); err != nil {
+				log.Printf("[WARN] failed to store time of the last request, %v", err)
+			}
+		}
 	}
 
 	log.Printf("[DEBUG] next request to ChatGPT can be made after %s, in %d minutes",
 		o.lastDT.Add(30*time.Minute), int(30-time.Since(o.lastDT).Minutes()))
 	return bot.Response{
-		Text:    responseAI,
-		Send:    true,
-		ReplyTo: msg.ID, // reply to the message
+		Text:      responseAI,
+		Send:      true,
+		ReplyTo:   msg.ID, // reply to the message
+		ParseMode: tbapi.ModeMarkdown,
 	}
 }
 
 func (o *OpenAI) request(text string) (react bool, reqText string) {
-	textLowerCase := strings.ToLower(text)
-	for _, prefix := range o.ReactOn() {
-		if strings.HasPrefix(textLowerCase, prefix) {
-			return true, strings.TrimSpace(text[len(prefix):])
-		}
+	cmd, ok := o.Commands().Match(text)
+	if !ok {
+		return false, ""
 	}
-	return false, ""
+	return true, cmd.Args
 }
 
-func (o *OpenAI) checkRequest(username, text string) (ok bool, banMessage string) {
+// checkRequest returns false for requests not allowed, with message and reason of the ban
+func (o *OpenAI) checkRequest(username, text string) (ok bool, banMessage, reason string) {
 	if o.superUser.IsSuper(username) {
-		return true, ""
+		return true, "", ""
 	}
 
 	wtfContains := bot.WTFSteroidChecker{Message: text}
@@ -152,7 +176,8 @@ func (o *OpenAI) checkRequest(username, text string) (ok bool, banMessage string
 	if wtfContains.ContainsWTF() {
 		log.Printf("[WARN] OpenAI bot has wtf request, %s banned", username)
 		reason := "Вы знаете правила"
-		return false, fmt.Sprintf("%s\n@%s получает бан на 1 час.", reason, username)
+		return false, format.Markdown(format.Text(reason+"\n"), format.Mention(username), format.Text(" получает бан на 1 час.")),
+			"wtf в запросе chatgpt"
 	}
 
 	if o.nowFn().Sub(o.lastDT) < 30*time.Minute {
@@ -160,10 +185,11 @@ func (o *OpenAI) checkRequest(username, text string) (ok bool, banMessage string
 		reason := fmt.Sprintf("Слишком много запросов, следующий запрос можно будет сделать через %d минут.",
 			int(30-time.Since(o.lastDT).Minutes()))
 
-		return false, fmt.Sprintf("%s\n@%s получает бан на 1 час.", reason, username)
+		return false, format.Markdown(format.Text(reason+"\n"), format.Mention(username), format.Text(" получает бан на 1 час.")),
+			"слишком частые запросы к chatgpt"
 	}
 
-	return true, ""
+	return true, "", ""
 }
 
 func (o *OpenAI) checkResponseAI(username, responseAI string) (ok bool, banMessage string) {
@@ -175,18 +201,32 @@ func (o *OpenAI) checkResponseAI(username, responseAI string) (ok bool, banMessa
 
 	if wtfContains.ContainsWTF() {
 		log.Printf("[WARN] OpenAI bot response contains wtf, User %s banned", username)
-		return false, fmt.Sprintf("@%s выиграл в лотерею и получает бан на 1 час.", username)
+		return false, format.Markdown(format.Mention(username), format.Text(" выиграл в лотерею и получает бан на 1 час."))
 	}
 
 	return true, ""
 }
 
+// Status reports time left till the next request allowed, used by admin's status command. The same for all chats
+func (o *OpenAI) Status(int64) string {
+	left := o.lastDT.Add(30 * time.Minute).Sub(o.nowFn())
+	if left <= 0 {
+		return format.Markdown(format.Bold(format.Text("ChatGPT")), format.Text(" доступен"))
+	}
+	return format.Markdown(format.Bold(format.Text("ChatGPT")), format.Text(" доступен через "+bot.HumanizeDuration(left)))
+}
+
 // Help returns help message
 func (o *OpenAI) Help() string {
-	return bot.GenHelpMsg(o.ReactOn(), "Спросите что-нибудь у ChatGPT")
+	return o.Commands().Help()
+}
+
+// Commands returns ChatGPT command
+func (o *OpenAI) Commands() bot.Commands {
+	return bot.Commands{{Triggers: []string{"chat!", "gpt!", "ai!", "чат!"}, Description: "Спросите что-нибудь у ChatGPT", Args: true}}
 }
 
-func (o *OpenAI) chatGPTRequest(request, userPrompt, sysPrompt string) (response string, err error) {
+func (o *OpenAI) chatGPTRequest(ctx context.Context, request, userPrompt, sysPrompt string) (response string, err error) {
 	// Reduce the request size with tokenizer and fallback to default reducer if it fails
 	// The API supports 4097 tokens ~16000 characters (<=4 per token) for request + result together
 	// The response is limited to 1000 tokens and OpenAI always reserved it for the result
@@ -227,7 +267,7 @@ func (o *OpenAI) chatGPTRequest(request, userPrompt, sysPrompt string) (response
 
 	r = reduceRequest(r)
 
-	return o.chatGPTRequestInternal([]openai.ChatCompletionMessage{
+	return o.chatGPTRequestInternal(ctx, []openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleSystem,
 			Content: sysPrompt,
@@ -252,7 +292,7 @@ func (o *OpenAI) shouldAnswerWithHistory(msg bot.Message) bool {
 	return o.rand(100) < int64(o.params.HistoryReplyProbability)
 }
 
-func (o *OpenAI) chatGPTRequestWithHistory(sysPrompt string) (response string, err error) {
+func (o *OpenAI) chatGPTRequestWithHistory(ctx context.Context, sysPrompt string) (response string, err error) {
 	messages := make([]openai.ChatCompletionMessage, 0, len(o.history.messages)+1)
 
 	messages = append(messages, openai.ChatCompletionMessage{
@@ -267,13 +307,13 @@ func (o *OpenAI) chatGPTRequestWithHistory(sysPrompt string) (response string, e
 		})
 	}
 
-	return o.chatGPTRequestInternal(messages)
+	return o.chatGPTRequestInternal(ctx, messages)
 }
 
-func (o *OpenAI) chatGPTRequestInternal(messages []openai.ChatCompletionMessage) (response string, err error) {
+func (o *OpenAI) chatGPTRequestInternal(ctx context.Context, messages []openai.ChatCompletionMessage) (response string, err error) {
 
 	resp, err := o.client.CreateChatCompletion(
-		context.Background(),
+		ctx,
 		openai.ChatCompletionRequest{
 			Model:     openai.GPT3Dot5Turbo,
 			MaxTokens: o.params.MaxTokensResponse,
@@ -297,10 +337,10 @@ func (o *OpenAI) chatGPTRequestInternal(messages []openai.ChatCompletionMessage)
 
 // Summary returns summary of the text
 func (o *OpenAI) Summary(text string) (response string, err error) {
-	return o.chatGPTRequest(text, "", "Make a short summary, up to 50 words, followed by a list of bullet points. Each bullet point is limited to 50 words, up to 7 in total. All in markdown format and translated to russian:\n")
+	return o.chatGPTRequest(context.Background(), text, "", "Make a short summary, up to 50 words, followed by a list of bullet points. Each bullet point is limited to 50 words, up to 7 in total. All in markdown format and translated to russian:\n")
 }
 
 // ReactOn keys
 func (o *OpenAI) ReactOn() []string {
-	return []string{"chat!", "gpt!", "ai!", "чат!"}
+	return o.Commands().ReactOn()
 }
@@ -21,7 +21,7 @@ import (
 )
 
 func TestOpenAI_Help(t *testing.T) {
-	require.Contains(t, (&OpenAI{}).Help(), "chat!")
+	require.Contains(t, (&OpenAI{}).Help(), "chat\\!")
 }
 
 func getDefaultTestingConfig() Params {
@@ -49,11 +49,12 @@ func TestOpenAI_OnMessage(t *testing.T) {
 		json       []byte
 		mockResult bool
 		response   bot.Response
+		failed     bool
 	}{
-		{"Good result", "Prompt", jsonResponse, true, bot.Response{Text: "Mock response", Send: true, ReplyTo: 756}},
-		{"Good result", "", jsonResponse, true, bot.Response{Text: "Mock response", Send: true, ReplyTo: 756}},
-		{"Error result", "", jsonResponse, false, bot.Response{}},
-		{"Empty result", "", []byte(`{}`), true, bot.Response{}},
+		{"Good result", "Prompt", jsonResponse, true, bot.Response{Text: "Mock response", Send: true, ReplyTo: 756, ParseMode: "Markdown"}, false},
+		{"Good result", "", jsonResponse, true, bot.Response{Text: "Mock response", Send: true, ReplyTo: 756, ParseMode: "Markdown"}, false},
+		{"Error result", "", jsonResponse, false, bot.Response{}, true},
+		{"Empty result", "", []byte(`{}`), true, bot.Response{}, true},
 	}
 
 	su := &bmocks.SuperUser{IsSuperFunc: func(userName string) bool {
@@ -85,10 +86,10 @@ func TestOpenAI_OnMessage(t *testing.T) {
 			o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, su)
 			o.client = mockOpenAIClient
 
-			assert.Equal(t,
-				tt.response,
-				o.OnMessage(bot.Message{Text: fmt.Sprintf("chat! %s", tt.request), ID: 756}),
-			)
+			resp := o.OnMessage(bot.Message{Text: fmt.Sprintf("chat! %s", tt.request), ID: 756})
+			assert.Equal(t, tt.failed, resp.Error != nil, "failure reported")
+			resp.Error = nil
+			assert.Equal(t, tt.response, resp)
 			calls := mockOpenAIClient.CreateChatCompletionCalls()
 			require.Equal(t, 1, len(calls))
 			// First message is system role setup
@@ -101,6 +102,29 @@ func TestOpenAI_OnMessage(t *testing.T) {
 	}
 }
 
+func TestOpenAI_OnMessageContext_Timeout(t *testing.T) {
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			<-ctx.Done() // slow openai
+			return ai.ChatCompletionResponse{}, ctx.Err()
+		},
+	}
+	su := &bmocks.SuperUser{IsSuperFunc: func(userName string) bool { return false }}
+	o := NewOpenAI(getDefaultTestingConfig(), &http.Client{Timeout: 10 * time.Second}, su)
+	o.client = mockOpenAIClient
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	st := time.Now()
+	resp := o.OnMessageContext(ctx, bot.Message{Text: "chat! something", ID: 1})
+	assert.False(t, resp.Send)
+	assert.ErrorIs(t, resp.Error, context.DeadlineExceeded)
+	assert.Less(t, time.Since(st), time.Second, "request stopped with ctx")
+	require.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 1)
+	_, hasDeadline := mockOpenAIClient.CreateChatCompletionCalls()[0].ContextMoqParam.Deadline()
+	assert.True(t, hasDeadline, "ctx deadline passed to openai client")
+}
+
 func TestOpenAI_OnMessage_TooManyRequests(t *testing.T) {
 	mockOpenAIClient := &mocks.OpenAIClient{
 		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
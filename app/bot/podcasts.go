@@ -1,13 +1,18 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // Podcasts search bot, returns search result via site-api see https://radio-t.com/api-docs/
@@ -38,11 +43,22 @@ func NewPodcasts(client HTTPClient, api string, maxResults int) *Podcasts {
 
 // Help returns help message
 func (p *Podcasts) Help() string {
-	return GenHelpMsg(p.ReactOn(), "искать в описаниях подкастов, например: search! lambda")
+	return p.Commands().Help()
+}
+
+// Commands returns search command
+func (p *Podcasts) Commands() Commands {
+	return Commands{{Triggers: []string{"search!", "подкаст!"}, Description: "искать в описаниях подкастов, например: search! lambda", Args: true}}
 }
 
 // OnMessage returns result of search via https://radio-t.com/site-api/search?
 func (p *Podcasts) OnMessage(msg Message) (response Response) {
+	return p.OnMessageContext(context.Background(), msg)
+}
+
+// OnMessageContext returns result of search, request to site-api canceled with ctx.
+// Response has "next" button if more results possible, pressed button shows the next page in the same message.
+func (p *Podcasts) OnMessageContext(ctx context.Context, msg Message) (response Response) {
 
 	defer func() { // to catch possible panics from potentially dangerous makeBotResponse
 		if r := recover(); r != nil {
@@ -51,13 +67,16 @@ func (p *Podcasts) OnMessage(msg Message) (response Response) {
 		}
 	}()
 
-	ok, reqText := p.request(msg.Text)
+	reqText, skip, ok := p.request(msg)
 	if !ok {
 		return Response{}
 	}
 
-	reqURL := fmt.Sprintf("%s/search?limit=%d&q=%s", p.siteAPI, p.maxResults, reqText)
-	req, err := http.NewRequest("GET", reqURL, http.NoBody)
+	reqURL := fmt.Sprintf("%s/search?limit=%d&q=%s", p.siteAPI, p.maxResults, url.QueryEscape(reqText))
+	if skip > 0 {
+		reqURL += fmt.Sprintf("&skip=%d", skip)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, http.NoBody)
 	if err != nil {
 		log.Printf("[WARN] failed to make request %s, error=%v", reqURL, err)
 		return Response{}
@@ -66,63 +85,90 @@ func (p *Podcasts) OnMessage(msg Message) (response Response) {
 	resp, err := p.client.Do(req)
 	if err != nil {
 		log.Printf("[WARN] failed to send request %s, error=%v", reqURL, err)
-		return Response{}
+		return Response{Error: fmt.Errorf("failed to send request %s: %w", reqURL, err)}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("[WARN] request %s returned %s", reqURL, resp.Status)
-		return Response{}
+		return Response{Error: fmt.Errorf("request %s returned %s", reqURL, resp.Status)}
 	}
 
 	sr := []siteAPIResp{}
 	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
 		log.Printf("[WARN] failed to parse response from %s, error=%v", reqURL, err)
-		return Response{}
+		return Response{Error: fmt.Errorf("failed to parse response: %w", err)}
 	}
-	return Response{
+	response = Response{
 		Text: p.makeBotResponse(sr, reqText),
 		Send: true,
 	}
+	if msg.Callback != nil {
+		response.EditID = msg.ID
+	}
+	if len(sr) == p.maxResults {
+		next := Button{Text: "дальше", Data: fmt.Sprintf("%d%s%s", skip+p.maxResults, callbackSep, reqText)}
+		response.Buttons = [][]Button{{next}}
+	}
+	return response
 }
 
-func (p *Podcasts) makeBotResponse(sr []siteAPIResp, reqText string) string {
-
-	makeRepLine := func(nl noteWithLink) string {
-		if nl.link != "" {
-			return fmt.Sprintf("[%s](%s)", nl.text, nl.link)
-		}
-		return nl.text
+// request returns search text with number of results to skip, from the command or pressed "next" button
+func (p *Podcasts) request(msg Message) (reqText string, skip int, ok bool) {
+	if msg.Callback == nil {
+		cmd, found := p.Commands().Match(msg.Text)
+		return cmd.Args, 0, found
 	}
+	skipStr, reqText, found := strings.Cut(msg.Callback.Data, callbackSep)
+	skip, err := strconv.Atoi(skipStr)
+	if !found || err != nil {
+		log.Printf("[WARN] unexpected podcasts callback %q", msg.Callback.Data)
+		return "", 0, false
+	}
+	return reqText, skip, true
+}
+
+func (p *Podcasts) makeBotResponse(sr []siteAPIResp, reqText string) string {
 
 	if len(sr) == 0 {
-		return fmt.Sprintf("ничего не нашел на запрос %q", reqText)
+		return format.Markdown(format.Text(fmt.Sprintf("ничего не нашел на запрос %q", reqText)))
 	}
 
-	var res string
+	var res []format.Part
 	for _, s := range sr {
-		nls := p.notesWithLinks(s)
-		nlsStr := ""
-		for _, nl := range nls {
+		type repLine struct {
+			mark string
+			noteWithLink
+		}
+		var lines []repLine
+		for _, nl := range p.notesWithLinks(s) {
 
 			if strings.Contains(strings.ToLower(nl.text), strings.ToLower(reqText)) {
-				nlsStr += "●  " + makeRepLine(nl) + "\n"
+				lines = append(lines, repLine{"●", nl})
 				continue
 			}
 
 			if strings.Contains(strings.ToLower(nl.link), strings.ToLower(reqText)) {
-				nlsStr += "○  " + makeRepLine(nl) + "\n"
+				lines = append(lines, repLine{"○", nl})
 				continue
 			}
 		}
 
-		if nlsStr != "" {
-			res += fmt.Sprintf("[Радио-Т #%d](%s) _%s_\n", s.ShowNum, s.URL, s.Date.Format("02 Jan 06"))
-			res += nlsStr
-			res += "\n"
+		if len(lines) == 0 {
+			continue
+		}
+		res = append(res, format.Link(s.URL, format.Text(fmt.Sprintf("Радио-Т #%d", s.ShowNum))), format.Text(" "),
+			format.Italic(format.Text(s.Date.Format("02 Jan 06"))), format.Text("\n"))
+		for _, l := range lines {
+			line := format.Text(l.text)
+			if l.link != "" {
+				line = format.Link(l.link, line)
+			}
+			res = append(res, format.Text(l.mark+"  "), line, format.Text("\n"))
 		}
+		res = append(res, format.Text("\n"))
 	}
-	return res
+	return format.Markdown(res...)
 }
 
 type noteWithLink struct {
@@ -160,17 +206,7 @@ func (p *Podcasts) notesWithLinks(s siteAPIResp) (res []noteWithLink) {
 	return res
 }
 
-func (p *Podcasts) request(text string) (react bool, reqText string) {
-
-	for _, prefix := range p.ReactOn() {
-		if strings.HasPrefix(text, prefix) {
-			return true, strings.Replace(strings.TrimSpace(strings.TrimPrefix(text, prefix)), " ", "+", -1)
-		}
-	}
-	return false, ""
-}
-
 // ReactOn keys
 func (p *Podcasts) ReactOn() []string {
-	return []string{"search!", "подкаст!"}
+	return p.Commands().ReactOn()
 }
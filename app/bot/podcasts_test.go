@@ -33,7 +33,7 @@ func TestPodcastBotReturnsOnlyTopicsWithSearchedNotes(t *testing.T) {
 	d := NewPodcasts(&client, ts.URL, 5)
 
 	resp := d.OnMessage(Message{Text: "search! Lambda"})
-	require.Equal(t, `[Радио-Т #0](http://example.com) _01 Jan 01_
+	require.Equal(t, `[Радио\-Т \#0](http://example.com) _01 Jan 01_
 ●  Lambda
 
 `, resp.Text)
@@ -67,9 +67,9 @@ func TestPodcasts_OnMessage(t *testing.T) {
 
 	require.Equal(
 		t,
-		Response{Text: `[Радио-Т #123](http://example.com) _31 Jan 20_
-●  ALB сможет вызвать Lambda - 00:54:45.
-●  Слои общего кода в AWS Lambda - 01:15:46.
+		Response{Text: `[Радио\-Т \#123](http://example.com) _31 Jan 20_
+●  ALB сможет вызвать Lambda \- 00:54:45\.
+●  Слои общего кода в AWS Lambda \- 01:15:46\.
 
 `, Send: true},
 		d.OnMessage(Message{Text: "search! Lambda"}),
@@ -107,8 +107,8 @@ func TestPodcasts_OnMessageWithLinks(t *testing.T) {
 
 	require.Equal(
 		t,
-		Response{Text: `[Радио-Т #123](http://example.com) _31 Jan 20_
-●  [Mongo в облаке — чем это хорошо.](https://www.mongodb.com/cloud)
+		Response{Text: `[Радио\-Т \#123](http://example.com) _31 Jan 20_
+●  [Mongo в облаке — чем это хорошо\.](https://www.mongodb.com/cloud)
 ○  [xxxx в облаке — чем это хорошо](https://www.mongodb.com/cloud)
 
 `, Send: true},
@@ -133,7 +133,9 @@ func TestPodcasts_OnMessageFailed(t *testing.T) {
 	client := http.Client{Timeout: time.Second}
 	d := NewPodcasts(&client, ts.URL, 5)
 
-	require.Equal(t, Response{}, d.OnMessage(Message{Text: "/search something"}))
+	resp := d.OnMessage(Message{Text: "/search something"})
+	require.False(t, resp.Send)
+	require.EqualError(t, resp.Error, "request "+ts.URL+"/search?limit=5&q=something returned 400 Bad Request")
 }
 
 func TestPodcasts_notesWithLinks(t *testing.T) {
@@ -182,3 +184,33 @@ func TestPodcasts_notesWithLinks2(t *testing.T) {
 	}
 	assert.Equal(t, exp, r)
 }
+
+func TestPodcastBotNextPage(t *testing.T) {
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		sr := []siteAPIResp{
+			{URL: "http://example.com/1", ShowNotes: "mongo 1", ShowNum: 1},
+			{URL: "http://example.com/2", ShowNotes: "mongo 2", ShowNum: 2},
+		}
+		if r.URL.Query().Get("skip") != "" {
+			sr = sr[:1]
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(sr))
+	}))
+	defer ts.Close()
+
+	d := NewPodcasts(&http.Client{Timeout: time.Second}, ts.URL, 2)
+
+	resp := d.OnMessage(Message{Text: "search! mongo"})
+	require.True(t, resp.Send)
+	assert.Equal(t, [][]Button{{{Text: "дальше", Data: "2:mongo"}}}, resp.Buttons)
+
+	resp = d.OnMessage(Message{ID: 7, Callback: &Callback{ID: "1", Data: "2:mongo"}})
+	assert.Equal(t, "[Радио\\-Т \\#1](http://example.com/1) _01 Jan 01_\n●  mongo 1\n\n", resp.Text)
+	assert.Equal(t, 7, resp.EditID, "next page replaces the previous one")
+	assert.Nil(t, resp.Buttons, "no more results")
+
+	assert.Equal(t, Response{}, d.OnMessage(Message{Callback: &Callback{ID: "1", Data: "bad"}}))
+	assert.Equal(t, []string{"limit=2&q=mongo", "limit=2&q=mongo&skip=2"}, queries)
+}
@@ -1,11 +1,14 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // PrepPost bot notifies on new prep topic on the site
@@ -13,6 +16,7 @@ type PrepPost struct {
 	client        HTTPClient
 	siteAPI       string
 	checkDuration time.Duration
+	store         KVStore
 
 	last struct {
 		prepPost postInfo
@@ -28,16 +32,30 @@ type postInfo struct {
 
 var errNotPost = fmt.Errorf("not prep post")
 
-// NewPrepPost makes new PrepPost bot sending and pinning message "Начался сбор тем"
-func NewPrepPost(client HTTPClient, api string, d time.Duration) *PrepPost {
+const prepPostBucket = "preppost"
+
+// NewPrepPost makes new PrepPost bot sending and pinning message "Начался сбор тем".
+// The last seen prep post restored from the store, if any.
+func NewPrepPost(client HTTPClient, api string, d time.Duration, store KVStore) *PrepPost {
 	log.Printf("[INFO] prep-post bot with api %s", api)
-	return &PrepPost{client: client, siteAPI: api, checkDuration: d}
+	p := &PrepPost{client: client, siteAPI: api, checkDuration: d, store: store}
+	if store != nil {
+		if _, err := store.Load(prepPostBucket, "last", &p.last.prepPost); err != nil {
+			log.Printf("[WARN] failed to load last prep post, %v", err)
+		}
+	}
+	return p
 }
 
 // OnMessage reacts on any message and, from time to time (every checkDuration) hits site api
 // and gets the latest prep article. In case if article's url changed returns pinned response.
-// Skips the first check to avoid false-positive on restart
-func (p *PrepPost) OnMessage(Message) (response Response) {
+// Skips the first check to avoid false-positive on restart, unless the last post restored from the store
+func (p *PrepPost) OnMessage(msg Message) (response Response) {
+	return p.OnMessageContext(context.Background(), msg)
+}
+
+// OnMessageContext is OnMessage with site api request canceled with ctx
+func (p *PrepPost) OnMessageContext(ctx context.Context, _ Message) (response Response) {
 
 	if time.Since(p.last.checked) < p.checkDuration {
 		return Response{}
@@ -47,7 +65,7 @@ func (p *PrepPost) OnMessage(Message) (response Response) {
 		p.last.checked = time.Now()
 	}()
 
-	pi, err := p.recentPrepPost()
+	pi, err := p.recentPrepPost(ctx)
 	if err != nil {
 		if err != errNotPost {
 			log.Printf("[WARN] failed to check for new post, %v", err)
@@ -56,20 +74,25 @@ func (p *PrepPost) OnMessage(Message) (response Response) {
 	}
 
 	defer func() {
+		if p.store != nil && pi.URL != p.last.prepPost.URL {
+			if err := p.store.Save(prepPostBucket, "last", pi); err != nil {
+				log.Printf("[WARN] failed to store last prep post, %v", err)
+			}
+		}
 		p.last.prepPost = pi
 	}()
 
 	if p.last.prepPost.URL != "" && pi.URL != p.last.prepPost.URL {
 		log.Printf("[INFO] detected new prep topic %s", pi.URL)
-		return Response{Send: true, Pin: true, Text: fmt.Sprintf("Сбор тем начался - %s", pi.URL)}
+		return Response{Send: true, Pin: true, Text: format.Markdown(format.Text("Сбор тем начался - " + pi.URL))}
 	}
 	return Response{}
 }
 
-func (p *PrepPost) recentPrepPost() (pi postInfo, err error) {
+func (p *PrepPost) recentPrepPost(ctx context.Context) (pi postInfo, err error) {
 
 	reqURL := fmt.Sprintf("%s/last/1?categories=prep", p.siteAPI)
-	req, err := http.NewRequest("GET", reqURL, http.NoBody)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, http.NoBody)
 	if err != nil {
 		return pi, fmt.Errorf("failed to make request %s: %w", reqURL, err)
 	}
@@ -4,14 +4,17 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/radio-t/super-bot/app/bot/mocks"
+	"github.com/radio-t/super-bot/app/storage"
 )
 
 func TestPrepPost_OnMessage(t *testing.T) {
@@ -41,7 +44,7 @@ func TestPrepPost_OnMessage(t *testing.T) {
 		},
 		{
 			`[{"url":"https://radio-t.com/p/2020/02/11/prep-690/","title":"Темы для 690","date":"2020-02-11T23:04:21Z","categories":["prep"]}]`,
-			nil, 200, Response{Text: "Сбор тем начался - https://radio-t.com/p/2020/02/11/prep-690/", Send: true, Pin: true, Preview: false},
+			nil, 200, Response{Text: "Сбор тем начался \\- https://radio\\-t\\.com/p/2020/02/11/prep\\-690/", Send: true, Pin: true, Preview: false},
 		},
 		{
 			`[{"url":"https://radio-t.com/p/2020/02/11/prep-690/","title":"Темы для 690","date":"2020-02-11T23:04:21Z","categories":["prep"]}]`,
@@ -50,7 +53,7 @@ func TestPrepPost_OnMessage(t *testing.T) {
 	}
 
 	mockHTTP := &mocks.HTTPClient{}
-	pp := NewPrepPost(mockHTTP, "http://example.com", time.Millisecond*10)
+	pp := NewPrepPost(mockHTTP, "http://example.com", time.Millisecond*10, nil)
 
 	for i, tt := range tbl {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
@@ -83,7 +86,7 @@ func TestPrepPost_checkDuration(t *testing.T) {
 			StatusCode: 200,
 		}, nil
 	}}
-	pp := NewPrepPost(mockHTTP, "http://example.com", time.Millisecond*50)
+	pp := NewPrepPost(mockHTTP, "http://example.com", time.Millisecond*50, nil)
 
 	for i := 0; i < 10; i++ {
 		pp.OnMessage(Message{})
@@ -92,3 +95,27 @@ func TestPrepPost_checkDuration(t *testing.T) {
 
 	assert.Equal(t, 2, len(mockHTTP.DoCalls()))
 }
+
+func TestPrepPost_OnMessageRestored(t *testing.T) {
+	url := "blah1"
+	mockHTTP := &mocks.HTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Body:       io.NopCloser(strings.NewReader(`[{"url":"` + url + `","title":"Темы","categories":["prep"]}]`)),
+			StatusCode: 200,
+		}, nil
+	}}
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	pp := NewPrepPost(mockHTTP, "http://example.com", time.Millisecond, store)
+	assert.Equal(t, Response{}, pp.OnMessage(Message{}), "first check skipped")
+
+	url = "blah2"
+	pp = NewPrepPost(mockHTTP, "http://example.com", time.Millisecond, store) // restart
+	assert.Equal(t, Response{Text: "Сбор тем начался \\- blah2", Send: true, Pin: true}, pp.OnMessage(Message{}),
+		"new post detected after restart")
+
+	pp = NewPrepPost(mockHTTP, "http://example.com", time.Millisecond, store) // restart
+	assert.Equal(t, Response{}, pp.OnMessage(Message{}), "same post after restart")
+}
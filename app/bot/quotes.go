@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
+)
+
+// Quotes bot keeps the quote book of the chat. "quote!" in reply saves the message replied to, alone returns
+// a random quote, "quote! @user" a random quote of the user and "quote! search text" finds quotes with the text.
+// The same text of the same author saved once.
+type Quotes struct {
+	store KVStore
+
+	mu     sync.Mutex
+	quotes map[string]quote // by key of author and normalized text
+}
+
+// quote is a message saved to the quote book
+type quote struct {
+	Author  User
+	Text    string
+	Sent    time.Time
+	SavedBy string
+	Saved   time.Time
+}
+
+const (
+	quotesBucket   = "quotes"
+	quotesMaxFound = 5 // search results shown
+)
+
+// NewQuotes makes quotes bot with the quote book restored from the store, kept in memory only if store is nil
+func NewQuotes(store KVStore) *Quotes {
+	q := &Quotes{store: store, quotes: map[string]quote{}}
+	q.load()
+	log.Printf("[INFO] quotes bot with %d quotes", len(q.quotes))
+	return q
+}
+
+// Commands returns quote command
+func (q *Quotes) Commands() Commands {
+	return Commands{{Triggers: []string{"quote!", "цитата!"},
+		Description: "цитатник: ответом на сообщение сохранить, без аргументов случайная цитата, @user – цитата автора, " +
+			"search текст – поиск", Args: true}}
+}
+
+// Help returns help message
+func (q *Quotes) Help() string {
+	return q.Commands().Help()
+}
+
+// ReactOn keys
+func (q *Quotes) ReactOn() []string {
+	return q.Commands().ReactOn()
+}
+
+// OnMessage saves the message replied to, or returns quotes
+func (q *Quotes) OnMessage(msg Message) (response Response) {
+	cmd, ok := q.Commands().Match(msg.Text)
+	if !ok {
+		return Response{}
+	}
+	italic := func(text string) Response {
+		return Response{Text: format.Markdown(format.Italic(format.Text(text))), Send: true}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch {
+	case cmd.Args == "" && msg.ReplyTo.Text != "":
+		author := msg.ReplyTo.From
+		if author.ID == 0 && msg.ReplyTo.SenderChat.ID != 0 { // message of channel
+			author = User{ID: msg.ReplyTo.SenderChat.ID, Username: msg.ReplyTo.SenderChat.UserName}
+		}
+		key := quoteKey(author, msg.ReplyTo.Text)
+		if _, found := q.quotes[key]; found {
+			return italic("эта цитата уже есть")
+		}
+		qt := quote{Author: author, Text: msg.ReplyTo.Text, Sent: msg.ReplyTo.Sent, SavedBy: msg.From.Username,
+			Saved: time.Now()}
+		q.quotes[key] = qt
+		q.save(key, qt)
+		log.Printf("[INFO] quote of %+v saved by %s: %q", author, msg.From.Username, qt.Text)
+		return Response{Text: format.Markdown(format.Text("цитата " + qt.author() + " сохранена")), Send: true}
+
+	case cmd.Args == "":
+		all := q.find(func(quote) bool { return true })
+		if len(all) == 0 {
+			return italic("цитатник пуст, ответь на сообщение quote! чтобы сохранить его")
+		}
+		return Response{Text: all[rand.Intn(len(all))].String(), Send: true} // nolint
+
+	case strings.HasPrefix(cmd.Args, "@"):
+		name := strings.TrimPrefix(strings.Fields(cmd.Args)[0], "@")
+		found := q.find(func(qt quote) bool {
+			return strings.EqualFold(qt.Author.Username, name) || strings.EqualFold(qt.Author.DisplayName, name)
+		})
+		if len(found) == 0 {
+			return italic("нет цитат @" + name)
+		}
+		return Response{Text: found[rand.Intn(len(found))].String(), Send: true} // nolint
+	}
+
+	words := strings.Fields(strings.ToLower(cmd.Args))
+	if words[0] == "search" {
+		words = words[1:]
+	}
+	text := strings.Join(words, " ")
+	if text == "" {
+		return italic("что искать? quote! search текст")
+	}
+	found := q.find(func(qt quote) bool {
+		return strings.Contains(strings.ToLower(strings.Join(strings.Fields(qt.Text), " ")), text)
+	})
+	if len(found) == 0 {
+		return italic("ничего не найдено")
+	}
+	if len(found) > quotesMaxFound {
+		found = found[:quotesMaxFound]
+	}
+	sb := strings.Builder{}
+	for _, qt := range found {
+		_, _ = sb.WriteString(qt.String())
+	}
+	return Response{Text: sb.String(), Send: true}
+}
+
+// find returns quotes accepted by the filter, the recently saved first, called under lock
+func (q *Quotes) find(accept func(quote) bool) []quote {
+	res := []quote{}
+	for _, qt := range q.quotes {
+		if accept(qt) {
+			res = append(res, qt)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Saved.After(res[j].Saved) })
+	return res
+}
+
+// load restores quotes from the store
+func (q *Quotes) load() {
+	if q.store == nil {
+		return
+	}
+	keys, err := q.store.Keys(quotesBucket)
+	if err != nil {
+		log.Printf("[WARN] failed to load quotes, %v", err)
+		return
+	}
+	for _, k := range keys {
+		var qt quote
+		if _, err := q.store.Load(quotesBucket, k, &qt); err != nil {
+			log.Printf("[WARN] failed to load quote %s, %v", k, err)
+			continue
+		}
+		q.quotes[k] = qt
+	}
+}
+
+func (q *Quotes) save(key string, qt quote) {
+	if q.store == nil {
+		return
+	}
+	if err := q.store.Save(quotesBucket, key, qt); err != nil {
+		log.Printf("[WARN] failed to store quote %s, %v", key, err)
+	}
+}
+
+// String returns quote as a markdown line with author and date
+func (qt quote) String() string {
+	return format.Markdown(format.Italic(format.Text(qt.Text)),
+		format.Text(fmt.Sprintf(" – %s, %s\n", qt.author(), qt.Sent.Format("02.01.2006"))))
+}
+
+func (qt quote) author() string {
+	if qt.Author.Username != "" {
+		return "@" + qt.Author.Username
+	}
+	return qt.Author.DisplayName
+}
+
+// quoteKey makes key of the quote, the same for texts different in case and spaces only
+func quoteKey(author User, text string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strings.ToLower(strings.Join(strings.Fields(text), " "))))
+	return fmt.Sprintf("%d:%x", author.ID, h.Sum64())
+}
@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+func quoteReply(text string, author User, sent time.Time) Message {
+	msg := Message{Text: "quote!", From: User{Username: "saver"}}
+	msg.ReplyTo.From, msg.ReplyTo.Text, msg.ReplyTo.Sent = author, text, sent
+	return msg
+}
+
+func TestQuotes_OnMessage(t *testing.T) {
+	q := NewQuotes(nil)
+	user, other := User{ID: 1, Username: "user"}, User{ID: 2, DisplayName: "Other"}
+	sent := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, Response{Text: "_цитатник пуст, ответь на сообщение quote\\! чтобы сохранить его_", Send: true},
+		q.OnMessage(Message{Text: "quote!"}))
+
+	assert.Equal(t, Response{Text: "цитата @user сохранена", Send: true}, q.OnMessage(quoteReply("Все тлен", user, sent)))
+	assert.Equal(t, Response{Text: "_эта цитата уже есть_", Send: true}, q.OnMessage(quoteReply(" все  ТЛЕН ", user, sent)))
+	assert.Equal(t, Response{Text: "цитата Other сохранена", Send: true}, q.OnMessage(quoteReply("все тлен", other, sent)),
+		"the same text of another author")
+	assert.Equal(t, Response{Text: "цитата Other сохранена", Send: true},
+		q.OnMessage(quoteReply("Go - лучший язык", other, sent.Add(time.Hour))))
+	assert.Len(t, q.quotes, 3)
+
+	assert.Contains(t, []string{"_Все тлен_ – @user, 01\\.05\\.2023\n", "_все тлен_ – Other, 01\\.05\\.2023\n",
+		"_Go \\- лучший язык_ – Other, 01\\.05\\.2023\n"}, q.OnMessage(Message{Text: "quote!"}).Text)
+	assert.Equal(t, Response{Text: "_Все тлен_ – @user, 01\\.05\\.2023\n", Send: true}, q.OnMessage(Message{Text: "quote! @User"}))
+	assert.Equal(t, Response{Text: "_нет цитат @nobody_", Send: true}, q.OnMessage(Message{Text: "/quote @nobody"}))
+
+	assert.Equal(t, Response{Text: "_Go \\- лучший язык_ – Other, 01\\.05\\.2023\n_все тлен_ – Other, 01\\.05\\.2023\n" +
+		"_Все тлен_ – @user, 01\\.05\\.2023\n", Send: true}, q.OnMessage(Message{Text: "quote! search Л"}))
+	assert.Equal(t, Response{Text: "_Go \\- лучший язык_ – Other, 01\\.05\\.2023\n", Send: true},
+		q.OnMessage(Message{Text: "цитата! лучший  ЯЗЫК"}))
+	assert.Equal(t, Response{Text: "_ничего не найдено_", Send: true}, q.OnMessage(Message{Text: "quote! search rust"}))
+	assert.Equal(t, Response{Text: "_что искать? quote\\! search текст_", Send: true},
+		q.OnMessage(Message{Text: "quote! search"}))
+	assert.Equal(t, Response{}, q.OnMessage(Message{Text: "quotes"}))
+}
+
+func TestQuotes_searchLimit(t *testing.T) {
+	q := NewQuotes(nil)
+	for i := 0; i < 10; i++ {
+		q.OnMessage(quoteReply(string(rune('a'+i))+" quote", User{ID: 1, Username: "user"}, time.Now()))
+	}
+	resp := q.OnMessage(Message{Text: "quote! search quote"})
+	assert.Equal(t, quotesMaxFound, strings.Count(resp.Text, "\n"))
+	assert.True(t, strings.HasPrefix(resp.Text, "_j quote_"), "the recent first")
+}
+
+func TestQuotes_restored(t *testing.T) {
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	q := NewQuotes(store)
+	q.OnMessage(quoteReply("все тлен", User{ID: 1, Username: "user"}, time.Now()))
+
+	// restart
+	q = NewQuotes(store)
+	require.Len(t, q.quotes, 1)
+	assert.Equal(t, Response{Text: "_эта цитата уже есть_", Send: true},
+		q.OnMessage(quoteReply("все тлен", User{ID: 1, Username: "user"}, time.Now())))
+	assert.Contains(t, q.OnMessage(Message{Text: "quote! @user"}).Text, "все тлен")
+}
@@ -0,0 +1,380 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/radio-t/super-bot/app/bot/format"
+)
+
+// Spam bot checks the first messages of users joined the chat after the bot started tracking, long-time members
+// are never checked. Messages scored by links, forwarding from channels, stop words, similarity to known spam
+// samples and stop words disguised with look-alike letters. Spam removed and the sender banned, in dry-run mode
+// spam is kept for superusers, listed by "spam!" command, nothing is sent to the chat.
+type Spam struct {
+	SpamParams
+	stopWords *ConfusableMatcher
+	samples   []map[string]bool // skeleton words of spam samples
+
+	mu       sync.Mutex
+	users    map[int64]spamUser
+	suspects []spamSuspect // recent spam found in dry-run mode, the last one first
+}
+
+// SpamParams defines parameters of spam bot
+type SpamParams struct {
+	Messages     int           // first messages of a user checked
+	Threshold    float64       // message with score reaching the threshold is spam
+	BanDuration  time.Duration // spammer banned for
+	DryRun       bool          // keep spam for superusers' "spam!" instead of removing it
+	MaxUsers     int           // users tracked, the least recent forgotten over the limit
+	SuperUser    SuperUser     // never checked, the only ones allowed to list spam of dry-run
+	DataLocation string        // directory with spam_stopwords.data and spam_samples.data, both optional
+	Store        KVStore       // keeps checked users across restarts, optional
+}
+
+// spamUser is a user joined the chat with messages checked so far
+type spamUser struct {
+	Checked int
+	Seen    time.Time
+}
+
+// spamSuspect is spam found in dry-run mode
+type spamSuspect struct {
+	user    User
+	text    string
+	score   float64
+	reasons []string
+	at      time.Time
+}
+
+const (
+	spamBucket      = "spam"
+	spamMaxSuspects = 10 // suspects kept in dry-run mode
+)
+
+// score of spam signs
+const (
+	spamLinkScore      = 1.0 // each link, up to spamMaxLinks
+	spamMaxLinks       = 3
+	spamForwardScore   = 2.0 // forwarded from channel
+	spamStopWordScore  = 1.0 // each stop word or phrase
+	spamSampleScore    = 3.0 // multiplied by similarity to the closest sample
+	spamMinSimilarity  = 0.5 // lower similarity ignored
+	spamHomoglyphScore = 1.0 // each stop word or phrase written with look-alike letters or separators
+)
+
+// NewSpam makes spam bot with stop words and spam samples loaded from data location.
+// Users checked before restored from the store, if any.
+func NewSpam(params SpamParams) (*Spam, error) {
+	log.Printf("[INFO] spam bot, first %d messages checked, threshold %.1f, dry-run %v", params.Messages,
+		params.Threshold, params.DryRun)
+	s := &Spam{SpamParams: params, users: map[int64]spamUser{}}
+
+	stopWords, err := readOptionalLines(filepath.Join(params.DataLocation, "spam_stopwords.data"))
+	if err != nil {
+		return nil, err
+	}
+	s.stopWords = NewConfusableMatcher(stopWords...)
+
+	samples, err := readOptionalLines(filepath.Join(params.DataLocation, "spam_samples.data"))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range samples {
+		if set := wordSet(skeletonWords(line)); len(set) > 0 {
+			s.samples = append(s.samples, set)
+		}
+	}
+	log.Printf("[DEBUG] loaded %d spam stop words and %d samples", s.stopWords.Len(), len(s.samples))
+
+	s.load()
+	return s, nil
+}
+
+// Commands returns command listing spam found in dry-run mode, hidden from menu as superusers only
+func (s *Spam) Commands() Commands {
+	return Commands{{Triggers: []string{"spam!"}, Description: "найденный спам в режиме dry-run (только для админов)",
+		Hidden: true}}
+}
+
+// OnMessage checks the first messages of the joined user, removes spam and bans the sender,
+// or keeps spam for superusers in dry-run mode
+func (s *Spam) OnMessage(msg Message) (response Response) {
+	if _, ok := s.Commands().Match(msg.Text); ok && s.SuperUser.IsSuper(msg.From.Username) {
+		return Response{Text: s.report(), Send: true}
+	}
+	if len(msg.Joined) > 0 {
+		s.join(msg.Joined)
+		return Response{}
+	}
+	if msg.From.ID == 0 || s.SuperUser.IsSuper(msg.From.Username) || !s.track(msg) {
+		return Response{}
+	}
+
+	text, entities := msg.Text, msg.Entities
+	if msg.Image != nil {
+		text, entities = msg.Image.Caption, msg.Image.Entities
+	}
+	score, reasons := s.score(text, entities, msg.Forwarded)
+	if score < s.Threshold {
+		return Response{}
+	}
+	log.Printf("[INFO] spam from %+v, score %.1f (%s): %q", msg.From, score, strings.Join(reasons, ", "), text)
+
+	if s.DryRun { // not shown in the chat, neither to spammer nor to others
+		s.mu.Lock()
+		s.suspects = append([]spamSuspect{{user: msg.From, text: text, score: score, reasons: reasons, at: time.Now()}},
+			s.suspects...)
+		if len(s.suspects) > spamMaxSuspects {
+			s.suspects = s.suspects[:spamMaxSuspects]
+		}
+		s.mu.Unlock()
+		return Response{}
+	}
+
+	mention := "@" + msg.From.Username
+	if msg.From.Username == "" {
+		mention = msg.From.DisplayName
+	}
+	return Response{
+		Text:        format.Markdown(format.Text(fmt.Sprintf("%s получает бан за спам", mention))),
+		Send:        true,
+		DeleteID:    msg.ID,
+		BanInterval: s.BanDuration,
+		BanReason:   "спам",
+		User:        msg.From,
+	}
+}
+
+// ChecksEdits returns true, links edited into the first messages are spam as well
+func (s *Spam) ChecksEdits() bool {
+	return true
+}
+
+// ReactOn keys
+func (s *Spam) ReactOn() []string {
+	return s.Commands().ReactOn()
+}
+
+// Help returns help message
+func (s *Spam) Help() string {
+	return s.Commands().Help()
+}
+
+// join starts tracking of users joined the chat, superusers skipped
+func (s *Spam) join(users []User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range users {
+		if user.ID == 0 || s.SuperUser.IsSuper(user.Username) {
+			continue
+		}
+		u := spamUser{Seen: time.Now()}
+		s.users[user.ID] = u
+		s.save(user.ID, u)
+		log.Printf("[DEBUG] spam check of joined %+v started", user)
+	}
+	if s.MaxUsers > 0 && len(s.users) > s.MaxUsers {
+		s.cleanup()
+	}
+}
+
+// track counts checked messages of the user and returns false for users not joined while tracked
+// or passed all the checks. Edited messages checked, but not counted.
+func (s *Spam) track(msg Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[msg.From.ID]
+	if !ok || u.Checked >= s.Messages {
+		return false
+	}
+	if !msg.Edited {
+		u.Checked++
+	}
+	u.Seen = time.Now()
+	s.users[msg.From.ID] = u
+	s.save(msg.From.ID, u)
+	return true
+}
+
+// report lists spam found in dry-run mode
+func (s *Spam) report() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.suspects) == 0 {
+		if !s.DryRun {
+			return format.Markdown(format.Italic(format.Text("спам удаляется, режим dry-run выключен")))
+		}
+		return format.Markdown(format.Italic(format.Text("спам не найден")))
+	}
+	sb := strings.Builder{}
+	_, _ = sb.WriteString(format.Markdown(format.Bold(format.Text("похоже на спам:")), format.Text("\n")))
+	for _, sp := range s.suspects {
+		name := "@" + sp.user.Username
+		if sp.user.Username == "" {
+			name = sp.user.DisplayName
+		}
+		_, _ = sb.WriteString(format.Markdown(format.Text(fmt.Sprintf("%s %s, оценка %.1f (%s): ", sp.at.Format("02.01 15:04"),
+			name, sp.score, strings.Join(sp.reasons, ", "))), format.Italic(format.Text(sp.text)), format.Text("\n")))
+	}
+	return sb.String()
+}
+
+// score returns spam score of the message with reasons of it
+func (s *Spam) score(text string, entities *[]Entity, forwarded *SenderChat) (score float64, reasons []string) {
+	links := 0
+	if entities != nil {
+		for _, e := range *entities {
+			if e.Type == "url" || e.Type == "text_link" {
+				links++
+			}
+		}
+	}
+	if links > spamMaxLinks {
+		links = spamMaxLinks
+	}
+	if links > 0 {
+		score += spamLinkScore * float64(links)
+		reasons = append(reasons, fmt.Sprintf("ссылки (%d)", links))
+	}
+
+	if forwarded != nil && forwarded.ID != 0 {
+		score += spamForwardScore
+		reasons = append(reasons, "переслано из канала")
+	}
+
+	if found := s.stopWords.MatchAll(text); len(found) > 0 {
+		plain, tricks := plainWords(text), 0
+		for _, phrase := range found {
+			if !containsWords(plain, plainWords(phrase)) { // matched with look-alikes only
+				tricks++
+			}
+		}
+		if tricks > 0 {
+			score += spamHomoglyphScore * float64(tricks)
+			reasons = append(reasons, fmt.Sprintf("подмена букв (%d)", tricks))
+		}
+		score += spamStopWordScore * float64(len(found))
+		reasons = append(reasons, "стоп-слова: "+strings.Join(found, ", "))
+	}
+
+	set := wordSet(skeletonWords(text))
+	similarity := 0.0
+	for _, sample := range s.samples {
+		if sim := jaccard(set, sample); sim > similarity {
+			similarity = sim
+		}
+	}
+	if similarity >= spamMinSimilarity {
+		score += spamSampleScore * similarity
+		reasons = append(reasons, fmt.Sprintf("похоже на образец спама (%.0f%%)", similarity*100))
+	}
+
+	return score, reasons
+}
+
+// cleanup removes 10% of the least recent users, called under lock
+func (s *Spam) cleanup() {
+	ids := make([]int64, 0, len(s.users))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return s.users[ids[i]].Seen.Before(s.users[ids[j]].Seen) })
+	for _, id := range ids[:len(ids)/10+1] {
+		delete(s.users, id)
+		if s.Store != nil {
+			if err := s.Store.Delete(spamBucket, strconv.FormatInt(id, 10)); err != nil {
+				log.Printf("[WARN] failed to remove spam check of user %d, %v", id, err)
+			}
+		}
+	}
+}
+
+// load restores checked users from the store
+func (s *Spam) load() {
+	if s.Store == nil {
+		return
+	}
+	keys, err := s.Store.Keys(spamBucket)
+	if err != nil {
+		log.Printf("[WARN] failed to load spam checks, %v", err)
+		return
+	}
+	for _, k := range keys {
+		id, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			log.Printf("[WARN] bad user id %s in spam checks, %v", k, err)
+			continue
+		}
+		var u spamUser
+		if _, err := s.Store.Load(spamBucket, k, &u); err != nil {
+			log.Printf("[WARN] failed to load spam check of user %s, %v", k, err)
+			continue
+		}
+		s.users[id] = u
+	}
+	log.Printf("[INFO] loaded %d users checked for spam", len(s.users))
+}
+
+func (s *Spam) save(id int64, u spamUser) {
+	if s.Store == nil {
+		return
+	}
+	if err := s.Store.Save(spamBucket, strconv.FormatInt(id, 10), u); err != nil {
+		log.Printf("[WARN] failed to store spam check of user %d, %v", id, err)
+	}
+}
+
+// wordSet makes set of words, short ones skipped as too common
+func wordSet(words []string) map[string]bool {
+	res := map[string]bool{}
+	for _, w := range words {
+		if utf8.RuneCountInString(w) > 2 {
+			res[w] = true
+		}
+	}
+	return res
+}
+
+// jaccard returns similarity of word sets, from 0 to 1
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// readOptionalLines reads lines of the data file, skipping empty ones. Missing file is not an error.
+func readOptionalLines(path string) ([]string, error) {
+	lines, err := readLines(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("[INFO] no %s, skipped", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			res = append(res, l)
+		}
+	}
+	return res, nil
+}
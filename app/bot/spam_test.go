@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+func newTestSpam(t *testing.T, params SpamParams) *Spam {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "spam_stopwords.data"),
+		[]byte("заработок\nпишите в лс\n\nказино\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "spam_samples.data"),
+		[]byte("Нужны люди для удаленной работы, доход от 500$ в неделю, пишите в личные сообщения\n"), 0o600))
+	params.DataLocation = dir
+	if params.SuperUser == nil {
+		params.SuperUser = &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return false }}
+	}
+	s, err := NewSpam(params)
+	require.NoError(t, err)
+	return s
+}
+
+func TestSpam_OnMessage(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	s := newTestSpam(t, SpamParams{Messages: 2, Threshold: 3, BanDuration: time.Hour, SuperUser: su})
+	user, admin, other := User{ID: 1, Username: "user"}, User{ID: 2, Username: "admin"}, User{ID: 3, DisplayName: "Other"}
+	links := &[]Entity{{Type: "url"}, {Type: "text_link"}}
+
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 7, From: User{ID: 5}, Text: "быстрый заработок тут", Entities: links}),
+		"long-time member not checked")
+	assert.Equal(t, Response{}, s.OnMessage(Message{From: user, Joined: []User{user, admin, other, {ID: 4}}}))
+	assert.Len(t, s.users, 3, "superuser not tracked")
+
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 1, From: user, Text: "привет всем"}))
+	assert.Equal(t, Response{Text: "@user получает бан за спам", Send: true, DeleteID: 2, BanInterval: time.Hour,
+		BanReason: "спам", User: user},
+		s.OnMessage(Message{ID: 2, From: user, Text: "быстрый заработок тут", Entities: links}))
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 3, From: user, Text: "быстрый заработок тут", Entities: links}),
+		"the first messages checked only")
+
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 4, From: admin, Text: "быстрый заработок тут", Entities: links}),
+		"superuser not checked")
+	_, tracked := s.users[2]
+	assert.False(t, tracked)
+
+	resp := s.OnMessage(Message{ID: 5, From: other, Image: &Image{Caption: "казино", Entities: links}})
+	assert.Equal(t, "Other получает бан за спам", resp.Text, "image caption checked")
+
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 6, From: User{ID: 4}, Text: "ссылка", Entities: links}),
+		"below threshold")
+}
+
+func TestSpam_OnMessageEdited(t *testing.T) {
+	s := newTestSpam(t, SpamParams{Messages: 1, Threshold: 3, BanDuration: time.Hour})
+	user, other := User{ID: 1, Username: "user"}, User{ID: 2, Username: "other"}
+	links := &[]Entity{{Type: "url"}, {Type: "url"}}
+	s.OnMessage(Message{From: user, Joined: []User{user, other}})
+
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 1, From: user, Text: "привет", Edited: true}))
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 1, From: user, Text: "привет"}))
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 1, From: user, Text: "заработок", Entities: links, Edited: true}),
+		"edit of checked message ignored after the first messages")
+
+	resp := s.OnMessage(Message{ID: 2, From: other, Text: "заработок", Entities: links, Edited: true})
+	assert.Equal(t, 2, resp.DeleteID, "spam edited in")
+	assert.True(t, s.ChecksEdits())
+}
+
+func TestSpam_OnMessageDryRun(t *testing.T) {
+	s := newTestSpam(t, SpamParams{Messages: 2, Threshold: 3, BanDuration: time.Hour, DryRun: true,
+		SuperUser: &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" || userName == "boss" }}})
+	user := User{ID: 1, Username: "user"}
+	assert.Equal(t, Response{Text: "_спам не найден_", Send: true}, s.OnMessage(Message{Text: "spam!", From: User{Username: "boss"}}))
+
+	s.OnMessage(Message{From: user, Joined: []User{user}})
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 1, From: user, Text: "заработок, пишите в ЛС",
+		Forwarded: &SenderChat{ID: 100}}), "nothing sent to chat")
+
+	assert.Equal(t, Response{}, s.OnMessage(Message{Text: "spam!", From: user}), "not super")
+	resp := s.OnMessage(Message{Text: "spam!", From: User{Username: "admin"}})
+	assert.True(t, resp.Send)
+	assert.Equal(t, 0, resp.ReplyTo)
+	assert.Regexp(t, `^\*похоже на спам:\*\n\d\d\\\.\d\d \d\d:\d\d @user, оценка 4\\\.0 \\\(переслано из канала, `+
+		`стоп\\\-слова: заработок, пишите в лс\\\): _заработок, пишите в ЛС_\n$`, resp.Text)
+
+	for i := 0; i < 20; i++ {
+		s.OnMessage(Message{ID: 2 + i, From: user, Joined: []User{{ID: int64(10 + i), Username: "spammer"}}})
+		s.OnMessage(Message{ID: 2 + i, From: User{ID: int64(10 + i), Username: "spammer"}, Text: "казино, заработок",
+			Forwarded: &SenderChat{ID: 100}})
+	}
+	assert.Len(t, s.suspects, spamMaxSuspects)
+	assert.Equal(t, int64(29), s.suspects[0].user.ID, "the last first")
+}
+
+func TestSpam_report(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	s := newTestSpam(t, SpamParams{Messages: 2, Threshold: 3, BanDuration: time.Hour, SuperUser: su})
+	assert.Equal(t, Response{Text: "_спам удаляется, режим dry\\-run выключен_", Send: true},
+		s.OnMessage(Message{Text: "spam!", From: User{Username: "admin"}}))
+}
+
+func TestSpam_score(t *testing.T) {
+	s := newTestSpam(t, SpamParams{})
+
+	tbl := []struct {
+		text      string
+		entities  *[]Entity
+		forwarded *SenderChat
+		score     float64
+		reasons   []string
+	}{
+		{"обычное сообщение про подкаст", nil, nil, 0, nil},
+		{"", &[]Entity{{Type: "url"}, {Type: "mention"}, {Type: "url"}, {Type: "text_link"}, {Type: "url"}}, nil,
+			3, []string{"ссылки (3)"}},
+		{"смотри", nil, &SenderChat{ID: 1}, 2, []string{"переслано из канала"}},
+		{"быстрый зaрaботок", nil, nil, 2, []string{"подмена букв (1)", "стоп-слова: заработок"}},
+		{"зарабoтoк пишитe в лс", nil, nil, 4, []string{"подмена букв (2)", "стоп-слова: заработок, пишите в лс"}},
+		{"кaзинo кaзинo кaзинo кaзинo", nil, nil, 2, []string{"подмена букв (1)", "стоп-слова: казино"}},
+		{"казино и заработок", nil, nil, 2, []string{"стоп-слова: заработок, казино"}},
+		{"к-а-з-и-н-о", nil, nil, 2, []string{"подмена букв (1)", "стоп-слова: казино"}},
+		{"𝓦eb dеsign", nil, nil, 0, nil},
+		{"прuвет, это pаypal", nil, nil, 0, nil},
+		{"пишите в лсс", nil, nil, 0, nil},
+		{"Нужны люди для удалённой работы, доход от 1000$ в неделю, пишите в личку", nil, nil,
+			spamSampleScore * 8 / 13, []string{"похоже на образец спама (62%)"}},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			score, reasons := s.score(tt.text, tt.entities, tt.forwarded)
+			assert.InDelta(t, tt.score, score, 0.001)
+			assert.Equal(t, tt.reasons, reasons)
+		})
+	}
+}
+
+func TestSpam_restored(t *testing.T) {
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	s := newTestSpam(t, SpamParams{Messages: 1, Threshold: 3, BanDuration: time.Hour, Store: store})
+	user := User{ID: 1, Username: "user"}
+	s.OnMessage(Message{From: user, Joined: []User{user, {ID: 2}}})
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 1, From: user, Text: "привет"}))
+
+	// restart
+	s = newTestSpam(t, SpamParams{Messages: 1, Threshold: 3, BanDuration: time.Hour, Store: store})
+	assert.Equal(t, Response{}, s.OnMessage(Message{ID: 2, From: user, Text: "заработок, казино", Forwarded: &SenderChat{ID: 1}}),
+		"user checked before restart")
+	assert.NotEqual(t, Response{}, s.OnMessage(Message{ID: 3, From: User{ID: 2}, Text: "заработок, казино",
+		Forwarded: &SenderChat{ID: 1}}))
+}
+
+func TestSpam_maxUsers(t *testing.T) {
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	s := newTestSpam(t, SpamParams{Messages: 1, Threshold: 3, BanDuration: time.Hour, MaxUsers: 10, Store: store})
+	for i := 1; i <= 100; i++ {
+		s.OnMessage(Message{ID: i, From: User{ID: int64(i)}, Joined: []User{{ID: int64(i)}}})
+		assert.LessOrEqual(t, len(s.users), 10)
+	}
+	assert.Contains(t, s.users, int64(100), "recent user kept")
+	assert.NotContains(t, s.users, int64(1), "old user forgotten")
+	keys, err := store.Keys(spamBucket)
+	require.NoError(t, err)
+	assert.Len(t, keys, len(s.users))
+}
+
+func TestSpam_missingData(t *testing.T) {
+	s, err := NewSpam(SpamParams{DataLocation: t.TempDir()})
+	require.NoError(t, err)
+	assert.Equal(t, 0, s.stopWords.Len())
+	assert.Empty(t, s.samples)
+	assert.Equal(t, "spam\\! _– найденный спам в режиме dry\\-run \\(только для админов\\)_\n", s.Help())
+	assert.Equal(t, []string{"spam!"}, s.ReactOn())
+}
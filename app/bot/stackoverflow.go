@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -8,6 +9,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // StackOverflow bot, returns from "https://api.stackexchange.com/2.2/questions?order=desc&sort=activity&site=stackoverflow"
@@ -31,19 +34,29 @@ func NewStackOverflow() *StackOverflow {
 
 // Help returns help message
 func (s StackOverflow) Help() string {
-	return GenHelpMsg(s.ReactOn(), "1 случайный вопрос со StackOverflow")
+	return s.Commands().Help()
+}
+
+// Commands returns so command
+func (s StackOverflow) Commands() Commands {
+	return Commands{{Triggers: []string{"so!"}, Description: "1 случайный вопрос со StackOverflow"}}
 }
 
 // OnMessage returns one entry
 func (s StackOverflow) OnMessage(msg Message) (response Response) {
-	if !contains(s.ReactOn(), msg.Text) {
+	return s.OnMessageContext(context.Background(), msg)
+}
+
+// OnMessageContext returns one entry, request canceled with ctx
+func (s StackOverflow) OnMessageContext(ctx context.Context, msg Message) (response Response) {
+	if _, ok := s.Commands().Match(msg.Text); !ok {
 		return Response{}
 	}
 
 	reqURL := "https://api.stackexchange.com/2.2/questions?order=desc&sort=activity&site=stackoverflow"
 	client := http.Client{Timeout: 5 * time.Second}
 
-	req, err := makeHTTPRequest(reqURL)
+	req, err := makeHTTPRequest(ctx, reqURL)
 	if err != nil {
 		log.Printf("[WARN] failed to prep request %s, error=%v", reqURL, err)
 		return Response{}
@@ -51,7 +64,7 @@ func (s StackOverflow) OnMessage(msg Message) (response Response) {
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("[WARN] failed to send request %s, error=%v", reqURL, err)
-		return Response{}
+		return Response{Error: fmt.Errorf("failed to send request %s: %w", reqURL, err)}
 	}
 	defer resp.Body.Close() // nolint
 
@@ -59,7 +72,7 @@ func (s StackOverflow) OnMessage(msg Message) (response Response) {
 
 	if err := json.NewDecoder(resp.Body).Decode(&soRecs); err != nil {
 		log.Printf("[WARN] failed to parse response, error %v", err)
-		return Response{}
+		return Response{Error: fmt.Errorf("failed to parse response: %w", err)}
 	}
 	if len(soRecs.Items) == 0 {
 		return Response{}
@@ -67,12 +80,12 @@ func (s StackOverflow) OnMessage(msg Message) (response Response) {
 
 	r := soRecs.Items[rand.Intn(len(soRecs.Items))] // nolint
 	return Response{
-		Text: fmt.Sprintf("[%s](%s) %s", r.Title, r.Link, strings.Join(r.Tags, ",")),
+		Text: format.Markdown(format.Link(r.Link, format.Text(r.Title)), format.Text(" "+strings.Join(r.Tags, ","))),
 		Send: true,
 	}
 }
 
 // ReactOn keys
 func (s StackOverflow) ReactOn() []string {
-	return []string{"so!"}
+	return s.Commands().ReactOn()
 }
@@ -2,69 +2,128 @@ package bot
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // Sys implements basic bot function to respond on ping and others from basic.data file.
-// also, reacts on say! with keys/values from say.data file
+// also, reacts on say! with keys/values from say.data file. Data reloaded by "reload!" admin command.
+// Superusers add, change and delete commands and say! quotes from the chat with "cmd!", these changes kept
+// in the store and applied over the data files.
 type Sys struct {
-	say          []string
 	dataLocation string
-	commands     []sysCommand
+	superUser    SuperUser
+	store        KVStore
+
+	mu       sync.RWMutex
+	say      []string
+	commands []sysCommand
+	custom   map[string]sysCustom // commands managed from the chat, by the first trigger in lower case
+	sayEdits map[string]sayEdit   // say! quotes added or removed from the chat
 }
 
 // sysCommand hold one type triggers from basic.data
 type sysCommand struct {
-	triggers    []string
-	description string
-	message     string
+	Command
+	message string
 }
 
-// NewSys makes new sys bot and load data to []say and basic map
-func NewSys(dataLocation string) (*Sys, error) {
+// NewSys makes new sys bot and load data to []say and basic map. Changes made from the chat restored from the store.
+// Without superUser commands can't be managed from the chat.
+func NewSys(dataLocation string, superUser SuperUser, store KVStore) (*Sys, error) {
 	log.Printf("[INFO] created sys bot, data location=%s", dataLocation)
-	res := Sys{dataLocation: dataLocation}
-	if err := res.loadBasicData(); err != nil {
+	res := Sys{dataLocation: dataLocation, superUser: superUser, store: store,
+		custom: map[string]sysCustom{}, sayEdits: map[string]sayEdit{}}
+	commands, err := res.loadBasicData()
+	if err != nil && !isBadLines(err) {
 		return nil, err
 	}
-	if err := res.loadSayData(); err != nil {
+	if err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	say, err := res.loadSayData()
+	if err != nil {
 		return nil, err
 	}
+	res.commands, res.say = commands, say
+	res.loadCustom()
 	return &res, nil
 }
 
+// Reload reads basic.data and say.data again. Data replaced only if both files are good,
+// otherwise the current data kept and errors returned.
+func (p *Sys) Reload() error {
+	commands, err := p.loadBasicData()
+	if err != nil {
+		return err
+	}
+	say, err := p.loadSayData()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.commands, p.say = commands, say
+	p.mu.Unlock()
+	log.Printf("[INFO] sys data reloaded, %d commands, %d say records", len(commands), len(say))
+	return nil
+}
+
 // Help returns help message
 func (p *Sys) Help() (line string) {
-	for _, c := range p.commands {
-		line += GenHelpMsg(c.triggers, c.description)
+	return p.Commands().Help()
+}
+
+// Commands returns commands loaded from basic.data with changes made from the chat, and command to manage them
+func (p *Sys) Commands() Commands {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	merged := p.merged()
+	res := make(Commands, 0, len(merged)+1)
+	for _, c := range merged {
+		res = append(res, c.Command)
+	}
+	if p.superUser != nil {
+		res = append(res, sysManageCommand)
 	}
-	return line
+	return res
 }
 
 // OnMessage implements bot.Interface
 func (p *Sys) OnMessage(msg Message) (response Response) {
-	if !contains(p.ReactOn(), msg.Text) {
+	cmd, ok := p.Commands().Match(msg.Text)
+	if !ok {
 		return Response{}
 	}
+	if cmd.Trigger == sysManageCommand.Triggers[0] {
+		return p.manage(msg.From.Username, cmd.Args)
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
-	if strings.EqualFold(msg.Text, "say!") {
-		if p.say != nil && len(p.say) > 0 {
+	if strings.EqualFold(cmd.Trigger, "say!") {
+		if say := p.quotes(); len(say) > 0 {
 			return Response{
-				Text: fmt.Sprintf("_%s_", EscapeMarkDownV1Text(p.say[rand.Intn(len(p.say))])), // nolint
+				Text: format.Markdown(format.Italic(format.Text(say[rand.Intn(len(say))]))), // nolint
 				Send: true,
 			}
 		}
 		return Response{}
 	}
 
-	for _, bot := range p.commands {
-		if found := contains(bot.triggers, strings.ToLower(msg.Text)); found {
-			return Response{Text: bot.message, Send: true}
+	for _, c := range p.merged() {
+		if containsFold(c.Triggers, cmd.Trigger) {
+			return Response{Text: c.message, Send: true, ParseMode: tbapi.ModeMarkdown} // messages in data file use legacy markdown
 		}
 	}
 
@@ -73,44 +132,71 @@ func (p *Sys) OnMessage(msg Message) (response Response) {
 
 // ReactOn keys
 func (p *Sys) ReactOn() []string {
-	res := make([]string, 0)
-	for _, bot := range p.commands {
-		res = append(bot.triggers, res...)
-	}
-	return res
+	return p.Commands().ReactOn()
 }
 
-func (p *Sys) loadBasicData() error {
+// loadBasicData returns commands from basic.data. Commands of good lines returned with *badLinesError as well.
+func (p *Sys) loadBasicData() ([]sysCommand, error) {
 	bdata, err := readLines(filepath.Join(p.dataLocation, "basic.data"))
 	if err != nil {
-		return fmt.Errorf("can't load basic.data: %w", err)
+		return nil, fmt.Errorf("can't load basic.data: %w", err)
 	}
 
-	for _, line := range bdata {
+	res := []sysCommand{}
+	bad := badLinesError{file: "basic.data"}
+	for i, line := range bdata {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
 		elems := strings.Split(line, "|")
 		if len(elems) != 3 {
-			log.Printf("[DEBUG] bad format %s, ignored", line)
+			bad.add(i, "expected triggers|description|message")
+			continue
+		}
+		if strings.TrimSpace(elems[0]) == "" || strings.TrimSpace(elems[2]) == "" {
+			bad.add(i, "empty triggers or message")
 			continue
 		}
 		cmd := sysCommand{
-			description: elems[1],
-			message:     elems[2],
-			triggers:    strings.Split(elems[0], ";"),
+			Command: Command{Triggers: strings.Split(elems[0], ";"), Description: elems[1]},
+			message: elems[2],
 		}
-		p.commands = append(p.commands, cmd)
-		log.Printf("[DEBUG] loaded basic response, %v, %s", cmd.triggers, cmd.message)
+		res = append(res, cmd)
+		log.Printf("[DEBUG] loaded basic response, %v, %s", cmd.Triggers, cmd.message)
 	}
-	return nil
+	if len(bad.lines) > 0 {
+		return res, &bad
+	}
+	return res, nil
 }
 
-func (p *Sys) loadSayData() error {
+func (p *Sys) loadSayData() ([]string, error) {
 	say, err := readLines(filepath.Join(p.dataLocation, "say.data"))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	p.say = say
 	log.Printf("[DEBUG] loaded say.data, %d records", len(say))
-	return nil
+	return say, nil
+}
+
+// badLinesError lists bad lines of data file, with line numbers
+type badLinesError struct {
+	file  string
+	lines []string
+}
+
+func (e *badLinesError) add(idx int, problem string) {
+	e.lines = append(e.lines, fmt.Sprintf("line %d: %s", idx+1, problem))
+}
+
+func (e *badLinesError) Error() string {
+	return fmt.Sprintf("bad lines in %s: %s", e.file, strings.Join(e.lines, "; "))
+}
+
+// isBadLines checks if error is about bad lines only, the rest of data is usable
+func isBadLines(err error) bool {
+	var bad *badLinesError
+	return errors.As(err, &bad)
 }
 
 func readLines(path string) ([]string, error) {
@@ -0,0 +1,332 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
+)
+
+// sysCustom is a command of sys bot added or changed from the chat. Command with the first trigger of basic.data
+// command replaces it, deleted one hides it.
+type sysCustom struct {
+	Triggers    []string
+	Description string
+	Message     string
+	Deleted     bool
+	Author      string
+	Updated     time.Time
+}
+
+// sayEdit is a say! quote added or removed from the chat
+type sayEdit struct {
+	Removed bool
+	Author  string
+	Updated time.Time
+}
+
+const (
+	sysCommandsBucket = "sys_commands"
+	sysSayBucket      = "sys_say"
+)
+
+var sysManageCommand = Command{Triggers: []string{"cmd!"},
+	Description: "команды и цитаты: add, edit, del, list, say add, say del (только для админов)", Args: true, Hidden: true}
+
+const sysManageUsage = "используй: cmd! add триггер;триггер | описание | сообщение, cmd! edit триггер | описание | " +
+	"сообщение, cmd! del триггер, cmd! list, cmd! say add цитата, cmd! say del цитата"
+
+// manage runs "cmd!" requested by superuser
+func (p *Sys) manage(userName, args string) Response {
+	if p.superUser == nil || !p.superUser.IsSuper(userName) {
+		return Response{}
+	}
+	italic := func(text string) Response {
+		return Response{Text: format.Markdown(format.Italic(format.Text(text))), Send: true}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	action, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+	switch strings.ToLower(action) {
+	case "list":
+		return Response{Text: p.listCustom(), Send: true}
+
+	case "add", "edit":
+		c, err := parseSysCustom(rest)
+		if err != nil {
+			return italic(err.Error())
+		}
+		c.Author, c.Updated = userName, time.Now()
+		edit := strings.EqualFold(action, "edit")
+		key, state := strings.ToLower(c.Triggers[0]), "добавлена"
+		if edit {
+			found, ok := p.find(c.Triggers[0])
+			if !ok {
+				return italic("нет такой команды: " + c.Triggers[0])
+			}
+			key, state = found, "изменена"
+		}
+		for _, t := range c.Triggers {
+			if other, ok := p.find(t); ok && (!edit || other != key) {
+				return italic("уже есть команда " + t)
+			}
+			if strings.EqualFold(t, sysManageCommand.Triggers[0]) {
+				return italic("нельзя использовать " + t)
+			}
+		}
+		p.custom[key] = c
+		p.save(sysCommandsBucket, key, c)
+		log.Printf("[INFO] sys command %v %s by %s", c.Triggers, state, userName)
+		return Response{Text: format.Markdown(format.Text(fmt.Sprintf("команда %s %s", c.Triggers[0], state))), Send: true}
+
+	case "del":
+		if rest == "" {
+			return italic(sysManageUsage)
+		}
+		key, ok := p.find(rest)
+		if !ok {
+			return italic("нет такой команды: " + rest)
+		}
+		if p.isFileCommand(key) {
+			c := sysCustom{Deleted: true, Author: userName, Updated: time.Now()}
+			p.custom[key] = c
+			p.save(sysCommandsBucket, key, c)
+		} else {
+			delete(p.custom, key)
+			p.remove(sysCommandsBucket, key)
+		}
+		log.Printf("[INFO] sys command %s deleted by %s", rest, userName)
+		return Response{Text: format.Markdown(format.Text("команда " + rest + " удалена")), Send: true}
+
+	case "say":
+		op, quote, _ := strings.Cut(rest, " ")
+		quote = strings.TrimSpace(quote)
+		if quote == "" || (!strings.EqualFold(op, "add") && !strings.EqualFold(op, "del")) {
+			return italic(sysManageUsage)
+		}
+		return italic(p.editSay(strings.EqualFold(op, "add"), quote, userName))
+	}
+	return italic(sysManageUsage)
+}
+
+// editSay adds or removes say! quote and returns the result, called under lock
+func (p *Sys) editSay(add bool, quote, userName string) string {
+	exists, inFile := false, contains(p.say, quote)
+	for _, q := range p.quotes() {
+		if q == quote {
+			exists = true
+			break
+		}
+	}
+	switch {
+	case add && exists:
+		return "такая цитата уже есть"
+	case !add && !exists:
+		return "нет такой цитаты"
+	case add == inFile: // back to say.data state, i.e. removed quote of the file added again
+		delete(p.sayEdits, quote)
+		p.remove(sysSayBucket, quote)
+	default:
+		e := sayEdit{Removed: !add, Author: userName, Updated: time.Now()}
+		p.sayEdits[quote] = e
+		p.save(sysSayBucket, quote, e)
+	}
+	log.Printf("[INFO] say quote %q added=%v by %s", quote, add, userName)
+	if add {
+		return "цитата добавлена"
+	}
+	return "цитата удалена"
+}
+
+// merged returns commands of basic.data with changes made from the chat, called under lock
+func (p *Sys) merged() []sysCommand {
+	res := make([]sysCommand, 0, len(p.commands)+len(p.custom))
+	fileKeys := map[string]bool{}
+	for _, c := range p.commands {
+		key := strings.ToLower(c.Triggers[0])
+		fileKeys[key] = true
+		custom, ok := p.custom[key]
+		if !ok {
+			res = append(res, c)
+			continue
+		}
+		if !custom.Deleted {
+			res = append(res, custom.command())
+		}
+	}
+
+	added := []string{}
+	for key, c := range p.custom {
+		if !fileKeys[key] && !c.Deleted {
+			added = append(added, key)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool { return p.custom[added[i]].Updated.Before(p.custom[added[j]].Updated) })
+	for _, key := range added {
+		res = append(res, p.custom[key].command())
+	}
+	return res
+}
+
+// quotes returns say! quotes of say.data with changes made from the chat, called under lock
+func (p *Sys) quotes() []string {
+	res := make([]string, 0, len(p.say)+len(p.sayEdits))
+	for _, q := range p.say {
+		if e, ok := p.sayEdits[q]; !ok || !e.Removed {
+			res = append(res, q)
+		}
+	}
+	added := []string{}
+	for q, e := range p.sayEdits {
+		if !e.Removed && !contains(p.say, q) {
+			added = append(added, q)
+		}
+	}
+	sort.Strings(added)
+	return append(res, added...)
+}
+
+// find returns key of the command with the trigger, called under lock
+func (p *Sys) find(trigger string) (key string, ok bool) {
+	for _, c := range p.merged() {
+		for _, t := range c.Triggers {
+			if strings.EqualFold(t, trigger) {
+				return strings.ToLower(c.Triggers[0]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// isFileCommand checks if the key is of basic.data command, called under lock
+func (p *Sys) isFileCommand(key string) bool {
+	for _, c := range p.commands {
+		if strings.EqualFold(c.Triggers[0], key) {
+			return true
+		}
+	}
+	return false
+}
+
+// listCustom returns commands and quotes changed from the chat, called under lock
+func (p *Sys) listCustom() string {
+	keys := make([]string, 0, len(p.custom))
+	for k := range p.custom {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	sb := strings.Builder{}
+	for _, k := range keys {
+		c := p.custom[k]
+		state := "добавлена"
+		switch {
+		case c.Deleted:
+			_, _ = sb.WriteString(format.Markdown(format.Text(k+" "), format.Italic(format.Text("– удалена @"+c.Author)),
+				format.Text("\n")))
+			continue
+		case p.isFileCommand(k):
+			state = "изменена"
+		}
+		_, _ = sb.WriteString(format.Markdown(format.Text(strings.Join(c.Triggers, ", ")+" "),
+			format.Italic(format.Text(fmt.Sprintf("– %s, %s @%s", c.Description, state, c.Author))), format.Text("\n")))
+	}
+
+	added, removed := 0, 0
+	for _, e := range p.sayEdits {
+		if e.Removed {
+			removed++
+			continue
+		}
+		added++
+	}
+	if added+removed > 0 {
+		_, _ = sb.WriteString(format.Markdown(format.Text(fmt.Sprintf("say! цитат добавлено %d, удалено %d\n", added, removed))))
+	}
+
+	if sb.Len() == 0 {
+		return format.Markdown(format.Italic(format.Text("команды и цитаты из чата не менялись")))
+	}
+	return sb.String()
+}
+
+// loadCustom restores changes made from the chat
+func (p *Sys) loadCustom() {
+	if p.store == nil {
+		return
+	}
+	keys, err := p.store.Keys(sysCommandsBucket)
+	if err != nil {
+		log.Printf("[WARN] failed to load sys commands, %v", err)
+	}
+	for _, k := range keys {
+		var c sysCustom
+		if _, err := p.store.Load(sysCommandsBucket, k, &c); err != nil {
+			log.Printf("[WARN] failed to load sys command %s, %v", k, err)
+			continue
+		}
+		p.custom[k] = c
+	}
+
+	keys, err = p.store.Keys(sysSayBucket)
+	if err != nil {
+		log.Printf("[WARN] failed to load say quotes, %v", err)
+	}
+	for _, k := range keys {
+		var e sayEdit
+		if _, err := p.store.Load(sysSayBucket, k, &e); err != nil {
+			log.Printf("[WARN] failed to load say quote %q, %v", k, err)
+			continue
+		}
+		p.sayEdits[k] = e
+	}
+	log.Printf("[INFO] loaded %d sys commands and %d say quotes changed from chat", len(p.custom), len(p.sayEdits))
+}
+
+func (p *Sys) save(bucket, key string, v interface{}) {
+	if p.store == nil {
+		return
+	}
+	if err := p.store.Save(bucket, key, v); err != nil {
+		log.Printf("[WARN] failed to store %s %q, %v", bucket, key, err)
+	}
+}
+
+func (p *Sys) remove(bucket, key string) {
+	if p.store == nil {
+		return
+	}
+	if err := p.store.Delete(bucket, key); err != nil {
+		log.Printf("[WARN] failed to remove %s %q, %v", bucket, key, err)
+	}
+}
+
+// parseSysCustom parses "triggers | description | message" the same way as basic.data lines,
+// message may have "|" as well
+func parseSysCustom(text string) (sysCustom, error) {
+	elems := strings.SplitN(text, "|", 3)
+	if len(elems) != 3 {
+		return sysCustom{}, errors.New(sysManageUsage)
+	}
+	res := sysCustom{Description: strings.TrimSpace(elems[1]), Message: strings.TrimSpace(elems[2])}
+	for _, t := range strings.Split(elems[0], ";") {
+		if t = strings.TrimSpace(t); t != "" {
+			res.Triggers = append(res.Triggers, t)
+		}
+	}
+	if len(res.Triggers) == 0 || res.Message == "" {
+		return sysCustom{}, errors.New("нужны триггер и сообщение")
+	}
+	return res, nil
+}
+
+func (c sysCustom) command() sysCommand {
+	return sysCommand{Command: Command{Triggers: c.Triggers, Description: c.Description}, message: c.Message}
+}
@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+func newTestSys(t *testing.T, store KVStore) *Sys {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "basic.data"),
+		[]byte("say!|набраться мудрости|-\nping;пинг|ответит pong|_pong_\nкто?|ведущие|ведущие\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "say.data"), []byte("мудрость\n"), 0o600))
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	s, err := NewSys(dir, su, store)
+	require.NoError(t, err)
+	return s
+}
+
+func TestSys_manageCommands(t *testing.T) {
+	s := newTestSys(t, nil)
+	admin := User{Username: "admin"}
+	send := func(text string) Response { return s.OnMessage(Message{Text: text, From: admin}) }
+
+	assert.Equal(t, Response{}, s.OnMessage(Message{Text: "cmd! add hi! | привет | _hi_", From: User{Username: "user"}}),
+		"not super")
+	assert.Equal(t, Response{Text: "команда hi\\! добавлена", Send: true}, send("cmd! add hi!;привет! | привет | _hi_ | там"))
+	assert.Equal(t, Response{Text: "_hi_ | там", Send: true, ParseMode: tbapi.ModeMarkdown}, send("привет!"))
+	assert.Equal(t, Response{Text: "_уже есть команда ping_", Send: true}, send("cmd! add ping | ping | pong"))
+	assert.Equal(t, Response{Text: "_нельзя использовать cmd\\!_", Send: true}, send("cmd! add cmd! | cmd | cmd"))
+	assert.Equal(t, Response{Text: "_нужны триггер и сообщение_", Send: true}, send("cmd! add hello! | привет |"))
+
+	assert.Equal(t, Response{Text: "команда пинг изменена", Send: true}, send("cmd! edit пинг | новый ping | _понг_"))
+	assert.Equal(t, Response{Text: "_понг_", Send: true, ParseMode: tbapi.ModeMarkdown}, send("пинг"))
+	assert.Equal(t, Response{}, send("ping"), "triggers replaced")
+	assert.Equal(t, Response{Text: "_уже есть команда кто?_", Send: true}, send("cmd! edit пинг;кто? | ping | pong"))
+	assert.Equal(t, Response{Text: "_нет такой команды: blah_", Send: true}, send("cmd! edit blah | blah | blah"))
+
+	assert.Equal(t, Response{Text: "команда кто? удалена", Send: true}, send("cmd! del кто?"))
+	assert.Equal(t, Response{}, send("кто?"))
+	assert.Equal(t, Response{Text: "команда hi\\! удалена", Send: true}, send("cmd! del hi!"))
+	assert.Equal(t, Response{}, send("привет!"))
+	assert.Equal(t, Response{Text: "_нет такой команды: hi\\!_", Send: true}, send("cmd! del hi!"))
+
+	assert.Equal(t, []string{"say!", "пинг", "cmd!"}, s.ReactOn())
+	assert.Equal(t, Response{Text: "пинг _– новый ping, изменена @admin_\nкто? _– удалена @admin_\n", Send: true},
+		send("cmd! list"))
+	assert.Contains(t, send("cmd! blah").Text, "_используй: cmd\\! add")
+}
+
+func TestSys_manageSay(t *testing.T) {
+	s := newTestSys(t, nil)
+	admin := User{Username: "admin"}
+	send := func(text string) Response { return s.OnMessage(Message{Text: text, From: admin}) }
+
+	assert.Equal(t, Response{Text: "_цитата добавлена_", Send: true}, send("cmd! say add новая мудрость"))
+	assert.Equal(t, Response{Text: "_такая цитата уже есть_", Send: true}, send("cmd! say add мудрость"))
+	assert.Equal(t, Response{Text: "_цитата удалена_", Send: true}, send("cmd! say del мудрость"))
+	assert.Equal(t, Response{Text: "_нет такой цитаты_", Send: true}, send("cmd! say del мудрость"))
+	assert.Equal(t, Response{Text: "_новая мудрость_", Send: true}, send("say!"))
+	assert.Equal(t, Response{Text: "say\\! цитат добавлено 1, удалено 1\n", Send: true}, send("cmd! list"))
+
+	assert.Equal(t, Response{Text: "_цитата удалена_", Send: true}, send("cmd! say del новая мудрость"))
+	assert.Equal(t, Response{}, send("say!"), "no quotes left")
+	assert.Equal(t, Response{Text: "_цитата добавлена_", Send: true}, send("cmd! say add мудрость"))
+	assert.Empty(t, s.sayEdits, "back to say.data")
+	assert.Equal(t, Response{Text: "_команды и цитаты из чата не менялись_", Send: true}, send("cmd! list"))
+}
+
+func TestSys_manageRestored(t *testing.T) {
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	s := newTestSys(t, store)
+	admin := User{Username: "admin"}
+	s.OnMessage(Message{Text: "cmd! add hi! | привет | _hi_", From: admin})
+	s.OnMessage(Message{Text: "cmd! del кто?", From: admin})
+	s.OnMessage(Message{Text: "cmd! say del мудрость", From: admin})
+	s.OnMessage(Message{Text: "cmd! say add новая мудрость", From: admin})
+
+	// restart
+	s = newTestSys(t, store)
+	assert.Equal(t, []string{"say!", "ping", "пинг", "hi!", "cmd!"}, s.ReactOn())
+	assert.Equal(t, Response{Text: "_новая мудрость_", Send: true}, s.OnMessage(Message{Text: "say!"}))
+
+	require.NoError(t, s.Reload())
+	assert.Equal(t, []string{"say!", "ping", "пинг", "hi!", "cmd!"}, s.ReactOn(), "changes kept on reload")
+}
@@ -2,36 +2,64 @@ package bot
 
 import (
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestSys_OnMessage(t *testing.T) {
-	bot, err := NewSys("./../../data")
+	bot, err := NewSys("./../../data", nil, nil)
 	require.NoError(t, err)
 	rand.Seed(0) // nolint
-	assert.Equal(t, Response{Text: "_никто не знает. пока не надоест_", Send: true}, bot.OnMessage(Message{Text: "доколе?"}))
-	assert.Equal(t, Response{Text: "_понг_", Send: true}, bot.OnMessage(Message{Text: "пинг"}))
-	assert.Equal(t, Response{Text: "_pong_", Send: true}, bot.OnMessage(Message{Text: "ping"}))
-	assert.Equal(t, Response{Text: "_ Каждый французский солдат носит в своем ранце маршальский жезл._", Send: true}, bot.OnMessage(Message{Text: "Say!"}))
+	assert.Equal(t, Response{Text: "_никто не знает. пока не надоест_", Send: true, ParseMode: tbapi.ModeMarkdown}, bot.OnMessage(Message{Text: "доколе?"}))
+	assert.Equal(t, Response{Text: "_понг_", Send: true, ParseMode: tbapi.ModeMarkdown}, bot.OnMessage(Message{Text: "пинг"}))
+	assert.Equal(t, Response{Text: "_pong_", Send: true, ParseMode: tbapi.ModeMarkdown}, bot.OnMessage(Message{Text: "ping"}))
+	assert.Equal(t, Response{Text: "_ Каждый французский солдат носит в своем ранце маршальский жезл\\._", Send: true}, bot.OnMessage(Message{Text: "Say!"}))
 }
 
 func TestSys_Help(t *testing.T) {
-	bot, err := NewSys("./../../data")
+	bot, err := NewSys("./../../data", nil, nil)
 	require.NoError(t, err)
-	assert.Equal(t, "say! _– набраться мудрости_\n"+
+	assert.Equal(t, "say\\! _– набраться мудрости_\n"+
 		"ping _– ответит pong_\n"+
 		"пинг _– ответит понг_\n"+
-		"кто?, who? _– ведущие Радио-Т_\n"+
-		"как?, how? _– online вещание Радио-Т_\n"+
-		"доколе? _– день закрытия Радио-Т_\n"+
+		"кто?, who? _– ведущие Радио\\-Т_\n"+
+		"как?, how? _– online вещание Радио\\-Т_\n"+
+		"доколе? _– день закрытия Радио\\-Т_\n"+
 		"правила, rules?, правила? _– правила общения в чате_\n",
 		bot.Help())
 }
 
+func TestSys_Reload(t *testing.T) {
+	dir := t.TempDir()
+	basic, say := filepath.Join(dir, "basic.data"), filepath.Join(dir, "say.data")
+	require.NoError(t, os.WriteFile(basic, []byte("say!|мудрость|-\nbad line\n"), 0o600))
+	require.NoError(t, os.WriteFile(say, []byte("мудрость\n"), 0o600))
+	bot, err := NewSys(dir, nil, nil)
+	require.NoError(t, err, "bad lines skipped on start")
+	assert.Equal(t, []string{"say!"}, bot.ReactOn())
+
+	require.NoError(t, os.WriteFile(basic, []byte("say!|мудрость|-\npong|ответит ping|_ping_\n"), 0o600))
+	require.NoError(t, bot.Reload())
+	assert.Equal(t, []string{"say!", "pong"}, bot.ReactOn())
+	assert.Equal(t, Response{Text: "_ping_", Send: true, ParseMode: tbapi.ModeMarkdown}, bot.OnMessage(Message{Text: "pong"}))
+
+	require.NoError(t, os.WriteFile(basic, []byte("say!|мудрость|-\n|пусто|\nping|ответит pong\n"), 0o600))
+	err = bot.Reload()
+	require.EqualError(t, err, "bad lines in basic.data: line 2: empty triggers or message; "+
+		"line 3: expected triggers|description|message")
+	assert.Equal(t, []string{"say!", "pong"}, bot.ReactOn(), "previous data kept")
+
+	require.NoError(t, os.Remove(say))
+	require.Error(t, bot.Reload())
+	assert.Equal(t, Response{Text: "_мудрость_", Send: true}, bot.OnMessage(Message{Text: "say!"}), "previous data kept")
+}
+
 func TestSys_Failed(t *testing.T) {
-	_, err := NewSys("/tmp/no-such-place")
+	_, err := NewSys("/tmp/no-such-place", nil, nil)
 	require.Error(t, err)
 }
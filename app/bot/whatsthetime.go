@@ -5,12 +5,18 @@ import (
 	"log"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // WhatsTheTime answers which time is on hosts timezones
-// uses whatsthetime.data file as configuration
+// uses whatsthetime.data file as configuration, reloaded by "reload!" admin command
 type WhatsTheTime struct {
+	dataLocation string
+
+	mu    sync.RWMutex
 	hosts []Host
 }
 
@@ -23,41 +29,74 @@ type Host struct {
 // NewWhatsTheTime makes new What's The Time bot and load data to []hosts
 func NewWhatsTheTime(dataLocation string) (*WhatsTheTime, error) {
 	log.Printf("[INFO] created WhatstTheTime bot, data location=%s", dataLocation)
-	res := WhatsTheTime{}
-	if err := res.loadTimeData(dataLocation); err != nil {
+	res := WhatsTheTime{dataLocation: dataLocation}
+	hosts, err := res.loadTimeData()
+	if err != nil && !isBadLines(err) {
 		return nil, err
 	}
+	if err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	res.hosts = hosts
 	return &res, nil
 }
 
-func (w *WhatsTheTime) loadTimeData(dataLocation string) error {
-	data, err := readLines(filepath.Join(dataLocation, "whatsthetime.data"))
+// Reload reads whatsthetime.data again, hosts replaced only if all lines are good
+func (w *WhatsTheTime) Reload() error {
+	hosts, err := w.loadTimeData()
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.hosts = hosts
+	w.mu.Unlock()
+	log.Printf("[INFO] whatsthetime data reloaded, %d hosts", len(hosts))
+	return nil
+}
+
+// loadTimeData returns hosts from whatsthetime.data. Hosts of good lines returned with *badLinesError as well.
+func (w *WhatsTheTime) loadTimeData() ([]Host, error) {
+	data, err := readLines(filepath.Join(w.dataLocation, "whatsthetime.data"))
 	if err != nil {
-		return fmt.Errorf("can't load whatsthetime.data: %w", err)
+		return nil, fmt.Errorf("can't load whatsthetime.data: %w", err)
 	}
 
-	for _, line := range data {
+	res := []Host{}
+	bad := badLinesError{file: "whatsthetime.data"}
+	for i, line := range data {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
 		elems := strings.Split(line, "|")
 		if len(elems) != 2 {
-			log.Printf("[DEBUG] bad format %s, ignored", line)
+			bad.add(i, "expected name|timezone")
 			continue
 		}
 		host := Host{
 			Name:     elems[0],
 			Timezone: elems[1],
 		}
-		w.hosts = append(w.hosts, host)
+		if _, err := time.LoadLocation(host.Timezone); err != nil {
+			bad.add(i, fmt.Sprintf("unknown timezone %q", host.Timezone))
+			continue
+		}
+		res = append(res, host)
 		log.Printf("[DEBUG] loaded basic response, %s, %s", host.Name, host.Timezone)
 	}
-	return nil
+	if len(bad.lines) > 0 {
+		return res, &bad
+	}
+	return res, nil
 }
 
 // OnMessage returns one entry
 func (w *WhatsTheTime) OnMessage(msg Message) (response Response) {
-	if !contains(w.ReactOn(), msg.Text) {
+	if _, ok := w.Commands().Match(msg.Text); !ok {
 		return Response{}
 	}
 
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 	return Response{
 		Text: buildResponseText(time.Now(), w.hosts),
 		Send: true,
@@ -72,17 +111,22 @@ func buildResponseText(now time.Time, hosts []Host) string {
 			log.Printf("[DEBUG] can't load location for %s: %s", host.Timezone, err)
 			continue
 		}
-		responseString += fmt.Sprintf("У %s сейчас %s\n", host.Name, now.In(location).Format("15:04"))
+		responseString += format.Markdown(format.Text(fmt.Sprintf("У %s сейчас %s\n", host.Name, now.In(location).Format("15:04"))))
 	}
 	return responseString
 }
 
 // ReactOn returns reaction keys
 func (w *WhatsTheTime) ReactOn() []string {
-	return []string{"время!", "time!", "который час?"}
+	return w.Commands().ReactOn()
 }
 
 // Help returns help message
 func (w *WhatsTheTime) Help() (line string) {
-	return GenHelpMsg(w.ReactOn(), "подcкажет время у ведущих")
+	return w.Commands().Help()
+}
+
+// Commands returns time command
+func (w *WhatsTheTime) Commands() Commands {
+	return Commands{{Triggers: []string{"время!", "time!", "который час?"}, Description: "подcкажет время у ведущих"}}
 }
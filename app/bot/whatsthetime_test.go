@@ -1,6 +1,8 @@
 package bot
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -33,7 +35,7 @@ func TestWhatsTheTime_buildResponseText(t *testing.T) {
 		},
 		{
 			in:  Host{Name: "Alek.sys", Timezone: "Europe/London"},
-			exp: "У Alek.sys сейчас 21:20\n",
+			exp: "У Alek\\.sys сейчас 21:20\n",
 		},
 	}
 
@@ -49,5 +51,23 @@ func TestWhatsTheTime_buildResponseText(t *testing.T) {
 func TestWhatsTheTime_Help(t *testing.T) {
 	b, err := NewWhatsTheTime("./../../data")
 	require.NoError(t, err)
-	require.Equal(t, "время!, time!, который час? _– подcкажет время у ведущих_\n", b.Help())
+	require.Equal(t, "время\\!, time\\!, который час? _– подcкажет время у ведущих_\n", b.Help())
+}
+
+func TestWhatsTheTime_Reload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "whatsthetime.data")
+	require.NoError(t, os.WriteFile(file, []byte("Umputun|America/Chicago\nBobuk|Mars/Olympus\n"), 0o600))
+	b, err := NewWhatsTheTime(dir)
+	require.NoError(t, err, "bad lines skipped on start")
+	assert.Equal(t, []Host{{Name: "Umputun", Timezone: "America/Chicago"}}, b.hosts)
+
+	require.NoError(t, os.WriteFile(file, []byte("Umputun|America/Chicago\nBobuk|Europe/Kiev\n"), 0o600))
+	require.NoError(t, b.Reload())
+	assert.Len(t, b.hosts, 2)
+
+	require.NoError(t, os.WriteFile(file, []byte("Umputun|America/Chicago\nGray\nBobuk|Mars/Olympus\n"), 0o600))
+	assert.EqualError(t, b.Reload(), "bad lines in whatsthetime.data: line 2: expected name|timezone; "+
+		"line 3: unknown timezone \"Mars/Olympus\"")
+	assert.Len(t, b.hosts, 2, "previous hosts kept")
 }
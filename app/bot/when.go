@@ -3,11 +3,24 @@ package bot
 import (
 	"fmt"
 	"log"
+	"sync"
 	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // When bot is answer on question "when the stream is started".
-type When struct{}
+// Countdown of the last answer updated on idle for whenUpdatePeriod.
+type When struct {
+	mu    sync.Mutex
+	asked time.Time // time of the last answer
+	last  string    // text of the last answer
+}
+
+const (
+	whenUpdatePeriod = 15 * time.Minute
+	whenKey          = "countdown"
+)
 
 // NewWhen makes a new When bot.
 func NewWhen() *When {
@@ -18,29 +31,55 @@ func NewWhen() *When {
 
 // Help returns help message
 func (w *When) Help() string {
-	return GenHelpMsg(w.ReactOn(), "расписание эфиров Радио-Т")
+	return w.Commands().Help()
 }
 
-// OnMessage returns one entry
+// Commands returns when command
+func (w *When) Commands() Commands {
+	return Commands{{Triggers: []string{"когда?", "when?"}, Description: "расписание эфиров Радио-Т"}}
+}
+
+// OnMessage returns one entry, on idle updates countdown of the last answer
 func (w *When) OnMessage(msg Message) Response {
-	if !contains(w.ReactOn(), msg.Text) {
+	if msg.Text == "idle" {
+		return w.update(time.Now())
+	}
+	if _, ok := w.Commands().Match(msg.Text); !ok {
 		return Response{}
 	}
 
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.asked, w.last = time.Now(), when(time.Now())
 	return Response{
-		Text: when(time.Now()),
+		Text: w.last,
 		Send: true,
+		Key:  whenKey,
+	}
+}
+
+// update edits the last answer if it was recent and its countdown changed
+func (w *When) update(now time.Time) Response {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.asked.IsZero() || now.Sub(w.asked) > whenUpdatePeriod {
+		return Response{}
+	}
+	text := when(now)
+	if text == w.last {
+		return Response{}
 	}
+	w.last = text
+	return Response{Text: text, Send: true, Key: whenKey, Edit: true}
 }
 
 // ReactOn keys
 func (w *When) ReactOn() []string {
-	return []string{"когда?", "when?"}
+	return w.Commands().ReactOn()
 }
 
 func when(now time.Time) string {
 	const avgDuration = 2 * time.Hour
-	const whenPrefix = "[каждую субботу, 20:00 UTC](https://radio-t.com/online/)"
 
 	now = now.UTC()
 	prevStream, nextStream := closestPrevNextShows(now)
@@ -61,7 +100,8 @@ func when(now time.Time) string {
 		)
 	}
 
-	return whenPrefix + whenCountdown
+	return format.Markdown(format.Link("https://radio-t.com/online/", format.Text("каждую субботу, 20:00 UTC")),
+		format.Text(whenCountdown))
 }
 
 // closestPrevNextShows returns closest next `weekday` at `hour`:`minute` after `t`.
@@ -17,10 +17,24 @@ func TestWhenBot(t *testing.T) {
 	})
 
 	t.Run("help", func(t *testing.T) {
-		assert.Equal(t, "когда?, when? _– расписание эфиров Радио-Т_\n", b.Help())
+		assert.Equal(t, "когда?, when? _– расписание эфиров Радио\\-Т_\n", b.Help())
 	})
 }
 
+func TestWhenBot_update(t *testing.T) {
+	b := NewWhen()
+	assert.Equal(t, Response{}, b.OnMessage(Message{Text: "idle"}), "nothing asked")
+
+	resp := b.OnMessage(Message{Text: "when?"})
+	assert.Equal(t, Response{Text: when(time.Now()), Send: true, Key: whenKey}, resp)
+	assert.Equal(t, Response{}, b.OnMessage(Message{Text: "idle"}), "countdown not changed")
+
+	now := b.asked.Add(5 * time.Minute)
+	assert.Equal(t, Response{Text: when(now), Send: true, Key: whenKey, Edit: true}, b.update(now))
+	assert.Equal(t, Response{}, b.update(now), "already updated")
+	assert.Equal(t, Response{}, b.update(b.asked.Add(whenUpdatePeriod+time.Minute)), "too late to update")
+}
+
 func TestWhenBot_when(t *testing.T) {
 	t.Parallel()
 
@@ -38,7 +52,7 @@ func TestWhenBot_when(t *testing.T) {
 		},
 		{
 			in:  time.Date(2022, 1, 1, 20, 1, 0, 0, time.UTC),
-			exp: "[каждую субботу, 20:00 UTC](https://radio-t.com/online/)\nНачался 1мин назад. \nСкорее всего еще идет. \nСледующий через 6дн 23ч 59мин",
+			exp: "[каждую субботу, 20:00 UTC](https://radio-t.com/online/)\nНачался 1мин назад\\. \nСкорее всего еще идет\\. \nСледующий через 6дн 23ч 59мин",
 		},
 		{
 			in:  time.Date(2022, 1, 1, 22, 1, 0, 0, time.UTC),
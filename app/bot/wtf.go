@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"sync"
 	"time"
+
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
 // WTF bot bans user for random interval
@@ -13,14 +16,26 @@ type WTF struct {
 	minDuration time.Duration
 	maxDuration time.Duration
 	rand        func(n int64) int64 // tests may change it
-	lastWtf     time.Time
-	tooSoon     time.Duration // tests may change it
+	tooSoon     time.Duration       // tests may change it
+	store       KVStore
+
+	mu      sync.Mutex
+	lastWtf time.Time
 }
 
-// NewWTF makes a random ban bot
-func NewWTF(minDuration, maxDuration time.Duration, superUser SuperUser) *WTF {
+const wtfBucket = "wtf"
+
+// NewWTF makes a random ban bot, time of the last wtf restored from the store, if any
+func NewWTF(minDuration, maxDuration time.Duration, superUser SuperUser, store KVStore) *WTF {
 	log.Printf("[INFO] WTF bot with %v-%v interval", minDuration, maxDuration)
-	return &WTF{minDuration: minDuration, maxDuration: maxDuration, rand: rand.Int63n, superUser: superUser, tooSoon: time.Minute}
+	w := &WTF{minDuration: minDuration, maxDuration: maxDuration, rand: rand.Int63n, superUser: superUser,
+		tooSoon: time.Minute, store: store}
+	if store != nil {
+		if _, err := store.Load(wtfBucket, "last", &w.lastWtf); err != nil {
+			log.Printf("[WARN] failed to load last wtf time, %v", err)
+		}
+	}
+	return w
 }
 
 // OnMessage sets duration of ban randomly
@@ -36,7 +51,8 @@ func (w *WTF) OnMessage(msg Message) (response Response) {
 	wtfUser := msg.From
 	var wtfChannelID int64
 	var wtfChannelUsername string
-	if w.superUser.IsSuper(msg.From.Username) {
+	fromSuper := w.superUser.IsSuper(msg.From.Username)
+	if fromSuper {
 		if msg.ReplyTo.From.ID == 0 { // not reply, ignore for supers
 			return Response{}
 		}
@@ -69,6 +85,9 @@ func (w *WTF) OnMessage(msg Message) (response Response) {
 		mention = "@" + wtfChannelUsername
 	}
 
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	banDuration := w.minDuration + time.Second*time.Duration(w.rand(int64(w.maxDuration.Seconds()-w.minDuration.Seconds())))
 	if time.Since(w.lastWtf) < w.tooSoon { // if last wtf was less than 1 minute ago, add more time to ban duration
 		increase := time.Hour * 5 * time.Duration(w.tooSoon.Seconds()-time.Since(w.lastWtf).Seconds())
@@ -82,19 +101,34 @@ func (w *WTF) OnMessage(msg Message) (response Response) {
 		banDuration = time.Minute*77 + time.Second*7
 	}
 	w.lastWtf = time.Now()
+	if w.store != nil {
+		if err := w.store.Save(wtfBucket, "last", w.lastWtf); err != nil {
+			log.Printf("[WARN] failed to store last wtf time, %v", err)
+		}
+	}
 
 	durationString := HumanizeDuration(banDuration)
 	if wtfChannelID != 0 {
 		durationString = "навсегда"
 	}
 
-	return Response{
-		Text:        fmt.Sprintf("%s получает бан на %v", EscapeMarkDownV1Text(mention), durationString),
+	response = Response{
+		Text:        format.Markdown(format.Text(fmt.Sprintf("%s получает бан на %v", mention, durationString))),
 		Send:        true,
 		BanInterval: banDuration,
+		BanReason:   "wtf!",
 		User:        wtfUser,
 		ChannelID:   wtfChannelID,
 	}
+	if !fromSuper {
+		response.DeleteID = msg.ID // wtf attempt removed, supers' wtf kept to show the reason of ban
+	}
+	return response
+}
+
+// ChecksEdits returns true, wtf edited in after the fact bans as well
+func (w *WTF) ChecksEdits() bool {
+	return true
 }
 
 // ReactOn keys
@@ -19,7 +19,7 @@ func TestWTF_OnMessage(t *testing.T) {
 	}}
 	min := time.Hour * 24
 	max := 7 * time.Hour * 24
-	b := NewWTF(min, max, su)
+	b := NewWTF(min, max, su, nil)
 	b.rand = func(n int64) int64 { return 10 }
 
 	t.Run("not a wtf message", func(t *testing.T) {
@@ -28,9 +28,10 @@ func TestWTF_OnMessage(t *testing.T) {
 	})
 
 	t.Run("regular user, first wtf", func(t *testing.T) {
-		resp := b.OnMessage(Message{Text: "WTF!", From: User{Username: "user_with_underscores", ID: 1}})
+		resp := b.OnMessage(Message{ID: 11, Text: "WTF!", From: User{Username: "user_with_underscores", ID: 1}})
 		require.Equal(t, "@user\\_with\\_underscores получает бан на 1дн 10сек", resp.Text)
 		require.True(t, resp.Send)
+		assert.Equal(t, 11, resp.DeleteID, "wtf attempt deleted")
 		require.Equal(t, min+10*time.Second, resp.BanInterval)
 		assert.Equal(t, User{Username: "user_with_underscores", ID: 1}, resp.User)
 	})
@@ -67,11 +68,12 @@ func TestWTF_OnMessage(t *testing.T) {
 	})
 
 	t.Run("admin, reply wtf", func(t *testing.T) {
-		msg := Message{Text: "WTF!", From: User{Username: "super"}}
+		msg := Message{ID: 12, Text: "WTF!", From: User{Username: "super"}}
 		msg.ReplyTo.From = User{Username: "user", ID: 1, DisplayName: "User"}
 		resp := b.OnMessage(msg)
 		assert.Equal(t, "@user получает бан на 13дн 7ч 10сек", resp.Text)
 		assert.True(t, resp.Send)
+		assert.Equal(t, 0, resp.DeleteID, "super's wtf kept")
 		assert.Equal(t, min+10*time.Second+5*59*time.Hour, resp.BanInterval)
 	})
 
@@ -95,7 +97,7 @@ func TestWTF_OnMessage(t *testing.T) {
 	t.Run("regular user, magic wtf duration #1", func(t *testing.T) {
 		b.rand = func(n int64) int64 { return 1 }
 		resp := b.OnMessage(Message{Text: "WTF!", From: User{Username: "user"}})
-		require.Equal(t, "@user получает бан на 27дн 18ч (666 часов)", resp.Text)
+		require.Equal(t, "@user получает бан на 27дн 18ч \\(666 часов\\)", resp.Text)
 		require.True(t, resp.Send)
 		require.Equal(t, time.Hour*666, resp.BanInterval)
 	})
@@ -111,5 +113,5 @@ func TestWTF_OnMessage(t *testing.T) {
 }
 
 func TestWTF_Help(t *testing.T) {
-	require.Equal(t, "wtf!, wtf? _– если не повезет, блокирует пользователя на какое-то время_\n", (&WTF{}).Help())
+	require.Equal(t, "wtf\\!, wtf? _– если не повезет, блокирует пользователя на какое\\-то время_\n", (&WTF{}).Help())
 }
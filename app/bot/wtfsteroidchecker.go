@@ -3,10 +3,6 @@ package bot
 import (
 	"strings"
 	"unicode"
-
-	"golang.org/x/text/runes"
-	"golang.org/x/text/transform"
-	"golang.org/x/text/unicode/norm"
 )
 
 // WTFSteroidChecker check if command wtf{!,?} is written with additional characters
@@ -450,13 +446,9 @@ func (w *WTFSteroidChecker) WTFUnicodeLibrary() map[string][]string {
 }
 
 // removeDiacritic smart remove diacritic marks
-// isMn check rune is in Unicode Mn category nonspacing marks
 // Example ẃŧḟ! -> wtf!
-// https://blog.golang.org/normalization#TOC_10.
-// https://pkg.go.dev/golang.org/x/text/runes#Remove
 func (w *WTFSteroidChecker) removeDiacritic() {
-	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
-	w.Message, _, _ = transform.String(t, w.Message)
+	w.Message = removeDiacritics(w.Message)
 }
 
 // removeUnicodeAnalog replace characters that looks like "w","t","f","!", "?" with their ASCII representation
@@ -519,7 +511,7 @@ func (w *WTFSteroidChecker) Contains() bool {
 	w.CleanUp()
 
 	// Straight and reverse order
-	return contains([]string{"wtf!", "wtf?"}, w.Message) || contains([]string{"!ftw", "?ftw"}, w.Message)
+	return containsFold([]string{"wtf!", "wtf?"}, w.Message) || containsFold([]string{"!ftw", "?ftw"}, w.Message)
 
 }
 
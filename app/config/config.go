@@ -0,0 +1,273 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config defines bots configuration, loaded from yaml (or json) file.
+// All the missing parameters set to defaults, matching the Radio-T setup.
+type Config struct {
+	Bots        Bots        `yaml:"bots"`
+	Terminators Terminators `yaml:"terminators"`
+	Chats       []Chat      `yaml:"chats"` // additional chats, the main one set with --telegram.group
+}
+
+// Chat defines an additional chat served by the same bot, with its own bots, logs, superusers and moderation.
+// Missing bots and terminators parameters set to defaults, not to the main chat's ones.
+type Chat struct {
+	Group       string      `yaml:"group"`       // id or public group username, without "@"
+	Logs        string      `yaml:"logs"`        // logs directory, chat's subdirectory of the main logs if not set
+	SuperUsers  []string    `yaml:"super_users"` // main superusers if not set
+	Bots        Bots        `yaml:"bots"`
+	Terminators Terminators `yaml:"terminators"`
+}
+
+// Terminators defines activity limits, user warned and then banned for sending more than Messages in any Window
+type Terminators struct {
+	All         Terminator `yaml:"all"`          // all messages of a user
+	Bots        Terminator `yaml:"bots"`         // messages of a user answered by bots
+	BotsOverall Terminator `yaml:"bots_overall"` // messages of all users answered by bots
+}
+
+// Terminator defines parameters of activity limit
+type Terminator struct {
+	Messages     int             `yaml:"messages"`      // messages allowed in the window
+	Window       time.Duration   `yaml:"window"`        // sliding window of activity
+	Warnings     int             `yaml:"warnings"`      // warnings before ban
+	BanDurations []time.Duration `yaml:"ban_durations"` // escalating for repeat offenders, the last one repeated
+	Forgive      time.Duration   `yaml:"forgive"`       // warnings and bans forgotten after that time, never if 0
+	MaxUsers     int             `yaml:"max_users"`     // users tracked, the least active forgotten over the limit
+}
+
+// Bots lists configuration of all bots, each can be disabled
+type Bots struct {
+	Broadcast     Broadcast `yaml:"broadcast"`
+	News          News      `yaml:"news"`
+	Anecdote      Bot       `yaml:"anecdote"`
+	StackOverflow Bot       `yaml:"stackoverflow"`
+	Duck          Bot       `yaml:"duck"`
+	Podcasts      Podcasts  `yaml:"podcasts"`
+	PrepPost      PrepPost  `yaml:"preppost"`
+	WTF           WTF       `yaml:"wtf"`
+	Banhammer     Banhammer `yaml:"banhammer"`
+	Spam          Spam      `yaml:"spam"`
+	Moderation    Bot       `yaml:"moderation"`
+	When          Bot       `yaml:"when"`
+	OpenAI        Bot       `yaml:"openai"`
+	Sys           Bot       `yaml:"sys"`
+	Quotes        Bot       `yaml:"quotes"`
+	WhatsTheTime  Bot       `yaml:"whatsthetime"`
+}
+
+// Bot defines parameters common for all bots
+type Bot struct {
+	Enabled  bool          `yaml:"enabled"`
+	Triggers []string      `yaml:"triggers"` // replace default triggers, for bots with a single command only
+	TTL      time.Duration `yaml:"ttl"`      // answers deleted with messages triggered them after ttl, kept if 0
+	Timeout  time.Duration `yaml:"timeout"`  // max time to answer, replaces --bot-timeout if set
+}
+
+// Broadcast defines parameters of broadcast status bot
+type Broadcast struct {
+	Bot          `yaml:",inline"`
+	URL          string        `yaml:"url"`
+	PingInterval time.Duration `yaml:"ping_interval"`
+	DelayToOff   time.Duration `yaml:"delay_to_off"`
+}
+
+// News defines parameters of news bot
+type News struct {
+	Bot         `yaml:",inline"`
+	API         string `yaml:"api"`
+	MaxArticles int    `yaml:"max_articles"`
+}
+
+// Podcasts defines parameters of podcasts search bot
+type Podcasts struct {
+	Bot        `yaml:",inline"`
+	API        string `yaml:"api"`
+	MaxResults int    `yaml:"max_results"`
+}
+
+// PrepPost defines parameters of prep topics bot
+type PrepPost struct {
+	Bot           `yaml:",inline"`
+	API           string        `yaml:"api"`
+	CheckInterval time.Duration `yaml:"check_interval"`
+}
+
+// WTF defines parameters of random ban bot
+type WTF struct {
+	Bot         `yaml:",inline"`
+	MinDuration time.Duration `yaml:"min_duration"`
+	MaxDuration time.Duration `yaml:"max_duration"`
+}
+
+// Banhammer defines parameters of ban/unban bot
+type Banhammer struct {
+	Bot            `yaml:",inline"`
+	MaxRecentUsers int `yaml:"max_recent_users"`
+}
+
+// Spam defines parameters of anti-spam bot checking the first messages of new users
+type Spam struct {
+	Bot         `yaml:",inline"`
+	Messages    int           `yaml:"messages"`     // first messages of a user checked
+	Threshold   float64       `yaml:"threshold"`    // message with score reaching the threshold is spam
+	BanDuration time.Duration `yaml:"ban_duration"` // spammer banned for
+	DryRun      bool          `yaml:"dry_run"`      // keep spam for superusers' "spam!" instead of removing it
+	MaxUsers    int           `yaml:"max_users"`    // users tracked, the least recent forgotten over the limit
+}
+
+// Default returns configuration with bots enabled and set the same way as for Radio-T chat.
+// Spam bot is disabled, to be turned on explicitly after its stop words and samples are ready.
+func Default() Config {
+	enabled := Bot{Enabled: true}
+	return Config{
+		Bots: Bots{
+			Broadcast: Broadcast{Bot: enabled, URL: "https://stream.radio-t.com", PingInterval: 10 * time.Second,
+				DelayToOff: time.Minute},
+			News:          News{Bot: enabled, API: "https://news.radio-t.com/api", MaxArticles: 5},
+			Anecdote:      enabled,
+			StackOverflow: enabled,
+			Duck:          enabled,
+			Podcasts:      Podcasts{Bot: enabled, API: "https://radio-t.com/site-api", MaxResults: 5},
+			PrepPost:      PrepPost{Bot: enabled, API: "https://radio-t.com/site-api", CheckInterval: 5 * time.Minute},
+			WTF:           WTF{Bot: enabled, MinDuration: 24 * time.Hour, MaxDuration: 7 * 24 * time.Hour},
+			Banhammer:     Banhammer{Bot: enabled, MaxRecentUsers: 5000},
+			Spam:          Spam{Messages: 3, Threshold: 3, BanDuration: 30 * 24 * time.Hour, DryRun: true, MaxUsers: 10000},
+			Moderation:    enabled,
+			When:          enabled,
+			OpenAI:        enabled,
+			Sys:           enabled,
+			Quotes:        enabled,
+			WhatsTheTime:  enabled,
+		},
+		Terminators: Terminators{
+			All: Terminator{Messages: 10, Window: time.Minute, Warnings: 1,
+				BanDurations: []time.Duration{5 * time.Minute, 30 * time.Minute, 2 * time.Hour},
+				Forgive:      24 * time.Hour, MaxUsers: 10000},
+			Bots: Terminator{Messages: 3, Window: 5 * time.Minute, Warnings: 1,
+				BanDurations: []time.Duration{15 * time.Minute, time.Hour, 6 * time.Hour},
+				Forgive:      24 * time.Hour, MaxUsers: 10000},
+			// the limit for all users, warning would go to whoever is the last and escalation would punish everyone
+			BotsOverall: Terminator{Messages: 5, Window: 5 * time.Minute, BanDurations: []time.Duration{5 * time.Minute}},
+		},
+	}
+}
+
+// UnmarshalYAML sets defaults for chat's parameters missing in file
+func (c *Chat) UnmarshalYAML(value *yaml.Node) error {
+	type plain Chat // prevents recursion
+	def := Default()
+	res := plain{Bots: def.Bots, Terminators: def.Terminators}
+	if err := value.Decode(&res); err != nil {
+		return err
+	}
+	*c = Chat(res)
+	return nil
+}
+
+// Load reads configuration from file, parameters missing in file are taken from Default
+func Load(path string) (Config, error) {
+	res := Default()
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return Config{}, fmt.Errorf("can't read config %s: %w", path, err)
+	}
+	if err = yaml.Unmarshal(data, &res); err != nil {
+		return Config{}, fmt.Errorf("can't parse config %s: %w", path, err)
+	}
+	if err = res.validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return res, nil
+}
+
+func (c Config) validate() error {
+	if err := c.Bots.validate(); err != nil {
+		return err
+	}
+	if err := c.Terminators.validate(); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, ch := range c.Chats {
+		if ch.Group == "" {
+			return fmt.Errorf("chat group is not set")
+		}
+		if seen[ch.Group] {
+			return fmt.Errorf("chat %s defined twice", ch.Group)
+		}
+		seen[ch.Group] = true
+		if err := ch.Bots.validate(); err != nil {
+			return fmt.Errorf("chat %s: %w", ch.Group, err)
+		}
+		if err := ch.Terminators.validate(); err != nil {
+			return fmt.Errorf("chat %s: %w", ch.Group, err)
+		}
+	}
+	return nil
+}
+
+func (t Terminators) validate() error {
+	terms := []struct {
+		name string
+		Terminator
+	}{{"all", t.All}, {"bots", t.Bots}, {"bots_overall", t.BotsOverall}}
+	for _, term := range terms {
+		if term.Messages <= 0 {
+			return fmt.Errorf("terminator %s messages should be positive, got %d", term.name, term.Messages)
+		}
+		if term.Window <= 0 {
+			return fmt.Errorf("terminator %s window should be positive, got %v", term.name, term.Window)
+		}
+		if term.Warnings < 0 || term.MaxUsers < 0 || term.Forgive < 0 {
+			return fmt.Errorf("terminator %s warnings, max_users and forgive can't be negative", term.name)
+		}
+		if len(term.BanDurations) == 0 {
+			return fmt.Errorf("terminator %s ban_durations are not set", term.name)
+		}
+		for _, d := range term.BanDurations {
+			if d <= 0 {
+				return fmt.Errorf("terminator %s ban_durations should be positive, got %v", term.name, d)
+			}
+		}
+	}
+	return nil
+}
+
+func (b Bots) validate() error {
+	if b.News.Enabled && b.News.MaxArticles <= 0 {
+		return fmt.Errorf("news max_articles should be positive, got %d", b.News.MaxArticles)
+	}
+	if b.Podcasts.Enabled && b.Podcasts.MaxResults <= 0 {
+		return fmt.Errorf("podcasts max_results should be positive, got %d", b.Podcasts.MaxResults)
+	}
+	if b.WTF.Enabled && b.WTF.MinDuration > b.WTF.MaxDuration {
+		return fmt.Errorf("wtf min_duration %v is greater than max_duration %v", b.WTF.MinDuration, b.WTF.MaxDuration)
+	}
+	if b.Broadcast.Enabled && b.Broadcast.PingInterval <= 0 {
+		return fmt.Errorf("broadcast ping_interval should be positive, got %v", b.Broadcast.PingInterval)
+	}
+	if b.Spam.Enabled && (b.Spam.Messages <= 0 || b.Spam.Threshold <= 0 || b.Spam.BanDuration <= 0) {
+		return fmt.Errorf("spam messages, threshold and ban_duration should be positive")
+	}
+	if b.Spam.Enabled && b.Spam.MaxUsers < 0 {
+		return fmt.Errorf("spam max_users can't be negative, got %d", b.Spam.MaxUsers)
+	}
+	for name, bc := range map[string]Bot{"news": b.News.Bot, "podcasts": b.Podcasts.Bot, "preppost": b.PrepPost.Bot,
+		"wtf": b.WTF.Bot, "banhammer": b.Banhammer.Bot, "spam": b.Spam.Bot, "broadcast": b.Broadcast.Bot,
+		"anecdote": b.Anecdote, "stackoverflow": b.StackOverflow, "duck": b.Duck, "moderation": b.Moderation,
+		"when": b.When, "openai": b.OpenAI, "sys": b.Sys, "quotes": b.Quotes, "whatsthetime": b.WhatsTheTime} {
+		if bc.Timeout < 0 {
+			return fmt.Errorf("%s timeout can't be negative, got %v", name, bc.Timeout)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	conf, err := Load("testdata/config.yml")
+	require.NoError(t, err)
+
+	exp := Default()
+	exp.Bots.News = News{Bot: Bot{Enabled: true, Triggers: []string{"новини!"}}, API: "https://news.example.com/api", MaxArticles: 3}
+	exp.Bots.Podcasts.Enabled = false
+	exp.Bots.PrepPost.CheckInterval = time.Minute
+	exp.Bots.Anecdote.Enabled = false
+	exp.Bots.WTF.MinDuration = time.Hour
+	exp.Bots.WTF.MaxDuration = 2 * time.Hour
+	assert.Equal(t, exp, conf)
+}
+
+func TestLoadJSON(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "config-*.json")
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"bots": {"when": {"enabled": false}, "banhammer": {"max_recent_users": 10}}}`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	conf, err := Load(f.Name())
+	require.NoError(t, err)
+	assert.False(t, conf.Bots.When.Enabled)
+	assert.Equal(t, 10, conf.Bots.Banhammer.MaxRecentUsers)
+	assert.True(t, conf.Bots.Banhammer.Enabled)
+	assert.Equal(t, "https://radio-t.com/site-api", conf.Bots.Podcasts.API)
+	assert.Equal(t, time.Duration(0), conf.Bots.Sys.TTL, "answers kept by default")
+	assert.False(t, conf.Bots.Spam.Enabled, "spam bot off by default")
+	assert.True(t, conf.Bots.Spam.DryRun)
+}
+
+func TestLoadFailed(t *testing.T) {
+	_, err := Load("testdata/no-such-file.yml")
+	assert.Error(t, err)
+
+	_, err = Load("testdata/bad.yml")
+	assert.EqualError(t, err, "invalid config testdata/bad.yml: wtf min_duration 3h0m0s is greater than max_duration 2h0m0s")
+
+	_, err = Load("testdata/bad-timeout.yml")
+	assert.EqualError(t, err, "invalid config testdata/bad-timeout.yml: openai timeout can't be negative, got -1s")
+}
+
+func TestLoadChats(t *testing.T) {
+	conf, err := Load("testdata/chats.yml")
+	require.NoError(t, err)
+
+	def := Default()
+	assert.Equal(t, def.Bots, conf.Bots)
+	assert.Equal(t, 20, conf.Terminators.All.Messages)
+	assert.Equal(t, def.Terminators.All.BanDurations, conf.Terminators.All.BanDurations)
+	require.Len(t, conf.Chats, 2)
+
+	chat := conf.Chats[0]
+	assert.Equal(t, "-100123", chat.Group)
+	assert.Equal(t, []string{"team_lead"}, chat.SuperUsers)
+	assert.False(t, chat.Bots.WTF.Enabled)
+	assert.Equal(t, def.Bots.WTF.MaxDuration, chat.Bots.WTF.MaxDuration)
+	assert.Equal(t, 10, chat.Bots.News.MaxArticles)
+	assert.Equal(t, def.Bots.News.API, chat.Bots.News.API)
+	assert.True(t, chat.Bots.OpenAI.Enabled)
+	assert.Equal(t, Terminator{Messages: 5, Window: time.Minute, BanDurations: []time.Duration{time.Hour, 3 * time.Hour},
+		Forgive: def.Terminators.Bots.Forgive, MaxUsers: def.Terminators.Bots.MaxUsers}, chat.Terminators.Bots)
+	assert.Equal(t, def.Terminators.All, chat.Terminators.All, "defaults, not the main chat's terminators")
+
+	assert.Equal(t, Chat{Group: "team_chat", Logs: "/srv/logs/team", Bots: def.Bots, Terminators: def.Terminators}, conf.Chats[1])
+}
+
+func TestLoadChatsFailed(t *testing.T) {
+	tbl := []struct {
+		conf string
+		err  string
+	}{
+		{`chats: [{logs: /tmp}]`, "chat group is not set"},
+		{`chats: [{group: g1}, {group: g1}]`, "chat g1 defined twice"},
+		{`chats: [{group: g1, bots: {news: {max_articles: 0}}}]`, "chat g1: news max_articles should be positive, got 0"},
+		{`chats: [{group: g1, terminators: {bots: {messages: 0}}}]`,
+			"chat g1: terminator bots messages should be positive, got 0"},
+		{`chats: [{group: g1, terminators: {all: {window: 0s}}}]`, "chat g1: terminator all window should be positive"},
+		{`chats: [{group: g1, terminators: {all: {ban_durations: []}}}]`, "chat g1: terminator all ban_durations are not set"},
+		{`chats: [{group: g1, terminators: {bots_overall: {ban_durations: [1m, 0s]}}}]`,
+			"chat g1: terminator bots_overall ban_durations should be positive, got 0s"},
+		{`terminators: {all: {warnings: -1}}`, "terminator all warnings, max_users and forgive can't be negative"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.err, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "config.yml")
+			require.NoError(t, os.WriteFile(fileName, []byte(tt.conf), 0o600))
+			_, err := Load(fileName)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/bot/format"
+)
+
+// ban history parameters
+const (
+	bansBucket       = "bans"
+	bansKeep         = 90 * bot.Day // older records forgotten
+	bansEscalation   = 30 * bot.Day // bans within this period make the next one longer
+	maxEscalatedBan  = 30 * bot.Day // escalated ban never longer, telegram treats bans over 366 days as forever anyway
+	bansReportRecent = 10           // recent bans shown by "bans!"
+)
+
+// who banned, as shown in "bans!" report, admins shown as "@admin"
+const (
+	byBot        = "бот"
+	byTerminator = "ограничение активности"
+)
+
+// banRecord is a ban made by bots, terminators or admins
+type banRecord struct {
+	ChatID    int64
+	User      bot.User
+	ChannelID int64         // banned channel, User is not set for it
+	By        string        // who banned, "@admin", byBot or byTerminator
+	Reason    string        // why, as told by bot or terminator
+	Duration  time.Duration // forever if 0
+	Kicked    bool          // user removed from the chat instead of restriction
+	At        time.Time
+	LiftedBy  string // admin unbanned the user before the end of the ban
+}
+
+func (r banRecord) key() string {
+	return fmt.Sprintf("%020d:%d:%d:%d", r.At.UnixNano(), r.ChatID, r.User.ID, r.ChannelID)
+}
+
+// active returns true if the ban is not lifted and not over
+func (r banRecord) active() bool {
+	return r.LiftedBy == "" && (r.Duration == 0 || time.Now().Before(r.At.Add(r.Duration)))
+}
+
+// same returns true for ban of the channel, if set, or of the user in the chat
+func (r banRecord) same(chatID, userID, channelID int64) bool {
+	if channelID != 0 {
+		return r.ChatID == chatID && r.ChannelID == channelID
+	}
+	return r.ChatID == chatID && r.ChannelID == 0 && r.User.ID == userID
+}
+
+// name returns the banned user or channel as shown in report
+func (r banRecord) name() string {
+	switch {
+	case r.ChannelID != 0:
+		return "канал " + strconv.FormatInt(r.ChannelID, 10)
+	case r.User.Username != "":
+		return "@" + r.User.Username
+	case r.User.DisplayName != "":
+		return r.User.DisplayName
+	}
+	return strconv.FormatInt(r.User.ID, 10)
+}
+
+// why returns the reason and who banned, as shown in report
+func (r banRecord) why() string {
+	if r.Reason == "" {
+		return r.By
+	}
+	return r.Reason + ", " + r.By
+}
+
+// banLedger keeps history of all bans for repeat offenders escalation and "bans!" report.
+// Thread safe, as the report made by admin bot.
+type banLedger struct {
+	store   bot.KVStore // keeps history across restarts, optional
+	mu      sync.Mutex
+	records []banRecord // ordered by ban time
+}
+
+// newBanLedger makes ledger with history restored from the store, outdated records removed
+func newBanLedger(store bot.KVStore) *banLedger {
+	res := &banLedger{store: store}
+	if store == nil {
+		return res
+	}
+	keys, err := store.Keys(bansBucket)
+	if err != nil {
+		log.Printf("[WARN] failed to load bans, %v", err)
+		return res
+	}
+	for _, k := range keys {
+		rec := banRecord{}
+		if _, err := store.Load(bansBucket, k, &rec); err != nil {
+			log.Printf("[WARN] failed to load ban %s, %v", k, err)
+			continue
+		}
+		if time.Since(rec.At) > bansKeep && !rec.active() {
+			if err := store.Delete(bansBucket, k); err != nil {
+				log.Printf("[WARN] failed to remove outdated ban %s, %v", k, err)
+			}
+			continue
+		}
+		res.records = append(res.records, rec)
+	}
+	sort.Slice(res.records, func(i, j int) bool { return res.records[i].At.Before(res.records[j].At) })
+	log.Printf("[INFO] loaded %d bans", len(res.records))
+	return res
+}
+
+// add records a new ban
+func (b *banLedger) add(rec banRecord) {
+	if rec.At.IsZero() {
+		rec.At = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.records) > 0 && time.Since(b.records[0].At) > bansKeep && !b.records[0].active() {
+		if b.store != nil {
+			if err := b.store.Delete(bansBucket, b.records[0].key()); err != nil {
+				log.Printf("[WARN] failed to remove outdated ban %s, %v", b.records[0].key(), err)
+			}
+		}
+		b.records = b.records[1:]
+	}
+	b.records = append(b.records, rec)
+	b.save(rec)
+}
+
+// lift marks active bans of the user or channel lifted by admin
+func (b *banLedger) lift(chatID, userID, channelID int64, by string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, rec := range b.records {
+		if rec.same(chatID, userID, channelID) && rec.active() {
+			b.records[i].LiftedBy = by
+			b.save(b.records[i])
+		}
+	}
+}
+
+// restricted returns true if the user has active ban made by restriction, not kicked from the chat
+func (b *banLedger) restricted(chatID, userID int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, rec := range b.records {
+		if rec.same(chatID, userID, 0) && rec.active() && !rec.Kicked {
+			return true
+		}
+	}
+	return false
+}
+
+// escalate returns the ban duration doubled for each ban of the user in the chat within bansEscalation period
+func (b *banLedger) escalate(chatID int64, user bot.User, channelID int64, duration time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	res := duration
+	for _, rec := range b.records {
+		if rec.same(chatID, user.ID, channelID) && time.Since(rec.At) < bansEscalation && res < maxEscalatedBan {
+			res *= 2
+		}
+	}
+	if res > maxEscalatedBan {
+		res = maxEscalatedBan
+	}
+	return res
+}
+
+// report returns active and recent bans in the chat, for "bans!" command
+func (b *banLedger) report(chatID int64) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var active, recent []format.Part
+	for i := len(b.records) - 1; i >= 0; i-- {
+		rec := b.records[i]
+		if rec.ChatID != chatID {
+			continue
+		}
+		if rec.active() {
+			until := "навсегда"
+			if rec.Duration > 0 {
+				until = "до " + rec.At.Add(rec.Duration).Format("02.01 15:04")
+			}
+			active = append(active, format.Text(fmt.Sprintf("%s %s (%s)\n", rec.name(), until, rec.why())))
+		}
+		if len(recent) < bansReportRecent {
+			duration := "навсегда"
+			if rec.Duration > 0 {
+				duration = "на " + bot.HumanizeDuration(rec.Duration)
+			}
+			line := fmt.Sprintf("%s %s %s (%s)", rec.At.Format("02.01 15:04"), rec.name(), duration, rec.why())
+			if rec.LiftedBy != "" {
+				line += ", снят " + rec.LiftedBy
+			}
+			recent = append(recent, format.Text(line+"\n"))
+		}
+	}
+
+	if len(recent) == 0 {
+		return format.Markdown(format.Italic(format.Text("банов не было")))
+	}
+	res := ""
+	if len(active) > 0 {
+		res += format.Markdown(append([]format.Part{format.Bold(format.Text("активные баны:")), format.Text("\n")}, active...)...)
+	}
+	return res + format.Markdown(append([]format.Part{format.Bold(format.Text("последние баны:")), format.Text("\n")}, recent...)...)
+}
+
+func (b *banLedger) save(rec banRecord) {
+	if b.store == nil {
+		return
+	}
+	if err := b.store.Save(bansBucket, rec.key(), rec); err != nil {
+		log.Printf("[WARN] failed to store ban %s, %v", rec.key(), err)
+	}
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+func TestBanLedger(t *testing.T) {
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	b := newBanLedger(store)
+	user := bot.User{ID: 1, Username: "user"}
+	assert.Equal(t, "_банов не было_", b.report(100))
+	assert.Equal(t, time.Hour, b.escalate(100, user, 0, time.Hour), "first offence")
+
+	at := time.Now().Add(-3 * bot.Day)
+	day := strings.ReplaceAll(at.Format("02.01 15:04"), ".", "\\.")
+	b.add(banRecord{ChatID: 100, User: user, By: "бот", Reason: "wtf!", Duration: time.Hour, At: time.Now().Add(-2 * time.Hour)})
+	b.add(banRecord{ChatID: 100, User: bot.User{ID: 2, DisplayName: "Other"}, By: "@admin", Duration: time.Hour, At: at})
+	b.add(banRecord{ChatID: 100, ChannelID: 5, By: "бот", Reason: "wtf!", At: at})
+	b.add(banRecord{ChatID: 200, User: user, By: byTerminator, Duration: time.Hour})
+
+	assert.Equal(t, 2*time.Hour, b.escalate(100, user, 0, time.Hour), "second offence in the chat")
+	assert.Equal(t, 2*time.Hour, b.escalate(200, user, 0, time.Hour), "second offence in another chat")
+	assert.Equal(t, 4*time.Hour, b.escalate(100, user, 0, 2*time.Hour))
+	assert.Equal(t, maxEscalatedBan, b.escalate(100, user, 0, 20*bot.Day), "capped")
+
+	b.add(banRecord{ChatID: 100, User: user, By: "бот", Reason: "chatgpt", Duration: 2 * time.Hour})
+	b.lift(100, 1, 0, "@admin")
+	b.add(banRecord{ChatID: 100, User: user, By: "бот", Duration: time.Hour, At: time.Now().Add(-100 * bot.Day)})
+
+	// restart
+	b = newBanLedger(store)
+	assert.Equal(t, 4*time.Hour, b.escalate(100, user, 0, time.Hour), "third offence")
+	report := b.report(100)
+	assert.Contains(t, report, "*активные баны:*\nканал 5 навсегда \\(wtf\\!, бот\\)\n*последние баны:*")
+	assert.NotContains(t, report, "@user до", "lifted ban not active")
+	assert.Contains(t, report, "*последние баны:*\n")
+	assert.Contains(t, report, "@user на 2ч \\(chatgpt, бот\\), снят @admin\n")
+	assert.Contains(t, report, day+" Other на 1ч \\(@admin\\)\n")
+	assert.Contains(t, report, day+" канал 5 навсегда \\(wtf\\!, бот\\)\n")
+	assert.NotContains(t, report, byTerminator, "other chat")
+	assert.Equal(t, 7, strings.Count(report, "\n"), "outdated ban not loaded")
+}
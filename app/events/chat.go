@@ -0,0 +1,83 @@
+package events
+
+import (
+	"fmt"
+	"log"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+// Chat is an additional chat served by TelegramListener with its own bots, logs, superusers and moderation.
+// The main chat defined by TelegramListener's own fields.
+type Chat struct {
+	Group                  string // can be int64 or public group username (without "@" prefix)
+	MsgLogger              msgLogger
+	Bots                   bot.Interface
+	SuperUsers             SuperUser
+	AllActivityTerm        Terminator // all activity for given user
+	BotsActivityTerm       Terminator // bot-only activity for given user
+	OverallBotActivityTerm Terminator // bot-only activity for all users
+	chatID                 int64
+	main                   bool
+}
+
+// setupChats resolves chat IDs of the main and additional chats and sets commands menu for each of them
+func (l *TelegramListener) setupChats() error {
+	l.main = &Chat{Group: l.Group, MsgLogger: l.MsgLogger, Bots: l.Bots, SuperUsers: l.SuperUsers,
+		AllActivityTerm: l.AllActivityTerm, BotsActivityTerm: l.BotsActivityTerm,
+		OverallBotActivityTerm: l.OverallBotActivityTerm, main: true}
+	l.chats = map[int64]*Chat{}
+	for _, c := range l.allChats() {
+		chatID, err := l.getChatID(c.Group)
+		if err != nil {
+			return fmt.Errorf("failed to get chat ID for group %q: %w", c.Group, err)
+		}
+		if _, found := l.chats[chatID]; found {
+			return fmt.Errorf("chat %q (%d) defined twice", c.Group, chatID)
+		}
+		c.chatID = chatID
+		l.chats[chatID] = c
+		l.refreshCommandsMenu(c)
+	}
+	return nil
+}
+
+// refreshCommandsMenu sets commands menu of the chat made of its bots' commands, i.e. after bot turned on or off
+func (l *TelegramListener) refreshCommandsMenu(c *Chat) {
+	if m, ok := c.Bots.(commandsMenu); ok {
+		l.setCommandsMenu(c, m.BotCommands())
+	}
+}
+
+// allChats returns the main chat followed by additional chats
+func (l *TelegramListener) allChats() []*Chat {
+	return append([]*Chat{l.main}, l.Chats...)
+}
+
+// chat returns managed chat by id. Messages from other chats handled by the main chat's bots
+// without logging and moderation, managed is false for them.
+func (l *TelegramListener) chat(chatID int64) (c *Chat, managed bool) {
+	if c, ok := l.chats[chatID]; ok {
+		return c, true
+	}
+	return l.main, false
+}
+
+// setCommandsMenu sets list of commands shown by telegram clients, failure is not critical.
+// Menu of the main chat set as default, additional chats get their own menus.
+func (l *TelegramListener) setCommandsMenu(c *Chat, cmds []tbapi.BotCommand) {
+	if len(cmds) == 0 {
+		return
+	}
+	req := tbapi.NewSetMyCommands(cmds...)
+	if !c.main {
+		req = tbapi.NewSetMyCommandsWithScope(tbapi.NewBotCommandScopeChat(c.chatID), cmds...)
+	}
+	if _, err := l.TbAPI.Request(req); err != nil {
+		log.Printf("[WARN] can't set commands menu for %q, %v", c.Group, err)
+		return
+	}
+	log.Printf("[INFO] commands menu for %q set, %d commands", c.Group, len(cmds))
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cleanupInterval is how often messages with expired TTL deleted
+const cleanupInterval = 10 * time.Second
+
+// cleanupBucket keeps pending deletions in the store
+const cleanupBucket = "pending_deletions"
+
+// pendingDeletion is a message to be deleted at the given time
+type pendingDeletion struct {
+	ChatID    int64
+	MessageID int
+	At        time.Time
+}
+
+func (p pendingDeletion) key() string {
+	return fmt.Sprintf("%d:%d", p.ChatID, p.MessageID)
+}
+
+// deleteLater schedules deletion of the message after ttl, the schedule kept in the store to survive restarts
+func (l *TelegramListener) deleteLater(chatID int64, msgID int, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending == nil {
+		l.pending = map[string]pendingDeletion{}
+	}
+	p := pendingDeletion{ChatID: chatID, MessageID: msgID, At: time.Now().Add(ttl)}
+	l.pending[p.key()] = p
+	if l.Store != nil {
+		if err := l.Store.Save(cleanupBucket, p.key(), p); err != nil {
+			log.Printf("[WARN] failed to store pending deletion of %s, %v", p.key(), err)
+		}
+	}
+}
+
+// deleteExpired deletes messages with expired TTL in background. Failed deletions not repeated on the next run,
+// as the message could be deleted already by admins. Keys of deleted messages forgotten, so they are not edited.
+func (l *TelegramListener) deleteExpired(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, p := range l.pending {
+		if p.At.After(time.Now()) {
+			continue
+		}
+		l.out.RequestAsync(ctx, tbapi.NewDeleteMessage(p.ChatID, p.MessageID), "delete expired message "+k)
+		delete(l.pending, k)
+		l.forgetSent(p.ChatID, p.MessageID)
+		if l.Store != nil {
+			if err := l.Store.Delete(cleanupBucket, k); err != nil {
+				log.Printf("[WARN] failed to remove pending deletion of %s, %v", k, err)
+			}
+		}
+	}
+}
+
+// forgetSent forgets the key of bot's message, i.e. deleted one. The next response with the key sent as a new message.
+// Called under lock.
+func (l *TelegramListener) forgetSent(chatID int64, msgID int) {
+	for key, id := range l.sent[chatID] {
+		if id == msgID {
+			delete(l.sent[chatID], key)
+		}
+	}
+}
+
+// loadPending restores deletions scheduled before restart
+func (l *TelegramListener) loadPending() {
+	if l.Store == nil {
+		return
+	}
+	keys, err := l.Store.Keys(cleanupBucket)
+	if err != nil {
+		log.Printf("[WARN] failed to load pending deletions, %v", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = map[string]pendingDeletion{}
+	for _, k := range keys {
+		var p pendingDeletion
+		if _, err := l.Store.Load(cleanupBucket, k, &p); err != nil {
+			log.Printf("[WARN] failed to load pending deletion of %s, %v", k, err)
+			continue
+		}
+		l.pending[k] = p
+	}
+	log.Printf("[INFO] loaded %d pending deletions", len(l.pending))
+}
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/events/mocks"
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+func TestTelegramListener_DeleteExpired(t *testing.T) {
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{MessageID: 100, Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "bot"}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		switch msg.Text {
+		case "ping":
+			return bot.Response{Send: true, Text: "pong", TTL: time.Minute, DeleteTrigger: true}
+		case "time":
+			return bot.Response{Send: true, Text: "12:00", TTL: time.Hour}
+		}
+		return bot.Response{}
+	}}
+	newListener := func(updates ...tbapi.Update) *TelegramListener {
+		updChan := make(chan tbapi.Update, len(updates))
+		for _, u := range updates {
+			updChan <- u
+		}
+		close(updChan)
+		tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+		return &TelegramListener{
+			MsgLogger:              &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}},
+			TbAPI:                  tbAPI,
+			Bots:                   bots,
+			Group:                  "gr",
+			Store:                  store,
+			AllActivityTerm:        Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+			BotsActivityTerm:       Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+			OverallBotActivityTerm: Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+		}
+	}
+
+	l := newListener(
+		tbapi.Update{Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123}, Text: "ping", From: &tbapi.User{UserName: "u1"}}},
+		tbapi.Update{Message: &tbapi.Message{MessageID: 2, Chat: &tbapi.Chat{ID: 123}, Text: "time", From: &tbapi.User{UserName: "u2"}}},
+	)
+	err = l.Do(context.Background())
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Len(t, l.pending, 2, "bot's answer and ping command, answer to time kept under the same id")
+	assert.WithinDuration(t, time.Now().Add(time.Minute), l.pending["123:1"].At, time.Second)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), l.pending["123:100"].At, time.Second)
+
+	l.deleteExpired(context.Background())
+	assert.Empty(t, tbAPI.RequestCalls(), "nothing expired yet")
+
+	// restart, pending deletions restored
+	l = newListener()
+	err = l.Do(context.Background())
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Len(t, l.pending, 2)
+
+	p := l.pending["123:1"]
+	p.At = time.Now().Add(-time.Second)
+	l.pending["123:1"] = p
+	l.deleteExpired(context.Background())
+	l.out.Wait()
+	require.Len(t, tbAPI.RequestCalls(), 1)
+	assert.Equal(t, tbapi.NewDeleteMessage(123, 1), tbAPI.RequestCalls()[0].C)
+	assert.Len(t, l.pending, 1)
+
+	keys, err := store.Keys(cleanupBucket)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"123:100"}, keys)
+
+	// countdown deleted by TTL is not edited anymore
+	l.sent = map[int64]map[string]int{123: {"when:countdown": 100, "news:more": 200}}
+	p = l.pending["123:100"]
+	p.At = time.Now().Add(-time.Second)
+	l.pending["123:100"] = p
+	l.deleteExpired(context.Background())
+	assert.Equal(t, map[int64]map[string]int{123: {"news:more": 200}}, l.sent)
+	_, err = l.sendAs(context.Background(), bot.Response{Text: "1:00", Send: true, Key: "when:countdown", Edit: true}, 123, "")
+	require.NoError(t, err)
+	require.Len(t, tbAPI.SendCalls(), 3)
+	assert.IsType(t, tbapi.MessageConfig{}, tbAPI.SendCalls()[2].C, "sent as a new message, not edit of deleted one")
+}
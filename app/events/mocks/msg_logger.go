@@ -1,33 +1,29 @@
 // Code generated by moq; DO NOT EDIT.
 // github.com/matryer/moq
 
-package events
+package mocks
 
 import (
 	bot "github.com/radio-t/super-bot/app/bot"
 	"sync"
 )
 
-// Ensure, that msgLoggerMock does implement msgLogger.
-// If this is not the case, regenerate this file with moq.
-var _ msgLogger = &msgLoggerMock{}
-
-// msgLoggerMock is a mock implementation of msgLogger.
+// MsgLogger is a mock implementation of events.msgLogger.
 //
 //	func TestSomethingThatUsesmsgLogger(t *testing.T) {
 //
-//		// make and configure a mocked msgLogger
-//		mockedmsgLogger := &msgLoggerMock{
+//		// make and configure a mocked events.msgLogger
+//		mockedmsgLogger := &MsgLogger{
 //			SaveFunc: func(msg *bot.Message)  {
 //				panic("mock out the Save method")
 //			},
 //		}
 //
-//		// use mockedmsgLogger in code that requires msgLogger
+//		// use mockedmsgLogger in code that requires events.msgLogger
 //		// and then make assertions.
 //
 //	}
-type msgLoggerMock struct {
+type MsgLogger struct {
 	// SaveFunc mocks the Save method.
 	SaveFunc func(msg *bot.Message)
 
@@ -43,9 +39,9 @@ type msgLoggerMock struct {
 }
 
 // Save calls SaveFunc.
-func (mock *msgLoggerMock) Save(msg *bot.Message) {
+func (mock *MsgLogger) Save(msg *bot.Message) {
 	if mock.SaveFunc == nil {
-		panic("msgLoggerMock.SaveFunc: method is nil but msgLogger.Save was just called")
+		panic("MsgLogger.SaveFunc: method is nil but msgLogger.Save was just called")
 	}
 	callInfo := struct {
 		Msg *bot.Message
@@ -62,7 +58,7 @@ func (mock *msgLoggerMock) Save(msg *bot.Message) {
 // Check the length with:
 //
 //	len(mockedmsgLogger.SaveCalls())
-func (mock *msgLoggerMock) SaveCalls() []struct {
+func (mock *MsgLogger) SaveCalls() []struct {
 	Msg *bot.Message
 } {
 	var calls []struct {
@@ -1,29 +1,28 @@
 // Code generated by moq; DO NOT EDIT.
 // github.com/matryer/moq
 
-package events
+package mocks
 
 import (
 	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"sync"
 )
 
-// Ensure, that tbAPIMock does implement tbAPI.
-// If this is not the case, regenerate this file with moq.
-var _ tbAPI = &tbAPIMock{}
-
-// tbAPIMock is a mock implementation of tbAPI.
+// TbAPI is a mock implementation of events.tbAPI.
 //
 //	func TestSomethingThatUsestbAPI(t *testing.T) {
 //
-//		// make and configure a mocked tbAPI
-//		mockedtbAPI := &tbAPIMock{
+//		// make and configure a mocked events.tbAPI
+//		mockedtbAPI := &TbAPI{
 //			GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 //				panic("mock out the GetChat method")
 //			},
 //			GetUpdatesChanFunc: func(config tbapi.UpdateConfig) tbapi.UpdatesChannel {
 //				panic("mock out the GetUpdatesChan method")
 //			},
+//			MakeRequestFunc: func(endpoint string, params tbapi.Params) (*tbapi.APIResponse, error) {
+//				panic("mock out the MakeRequest method")
+//			},
 //			RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
 //				panic("mock out the Request method")
 //			},
@@ -32,17 +31,20 @@ var _ tbAPI = &tbAPIMock{}
 //			},
 //		}
 //
-//		// use mockedtbAPI in code that requires tbAPI
+//		// use mockedtbAPI in code that requires events.tbAPI
 //		// and then make assertions.
 //
 //	}
-type tbAPIMock struct {
+type TbAPI struct {
 	// GetChatFunc mocks the GetChat method.
 	GetChatFunc func(config tbapi.ChatInfoConfig) (tbapi.Chat, error)
 
 	// GetUpdatesChanFunc mocks the GetUpdatesChan method.
 	GetUpdatesChanFunc func(config tbapi.UpdateConfig) tbapi.UpdatesChannel
 
+	// MakeRequestFunc mocks the MakeRequest method.
+	MakeRequestFunc func(endpoint string, params tbapi.Params) (*tbapi.APIResponse, error)
+
 	// RequestFunc mocks the Request method.
 	RequestFunc func(c tbapi.Chattable) (*tbapi.APIResponse, error)
 
@@ -61,6 +63,13 @@ type tbAPIMock struct {
 			// Config is the config argument value.
 			Config tbapi.UpdateConfig
 		}
+		// MakeRequest holds details about calls to the MakeRequest method.
+		MakeRequest []struct {
+			// Endpoint is the endpoint argument value.
+			Endpoint string
+			// Params is the params argument value.
+			Params tbapi.Params
+		}
 		// Request holds details about calls to the Request method.
 		Request []struct {
 			// C is the c argument value.
@@ -74,14 +83,15 @@ type tbAPIMock struct {
 	}
 	lockGetChat        sync.RWMutex
 	lockGetUpdatesChan sync.RWMutex
+	lockMakeRequest    sync.RWMutex
 	lockRequest        sync.RWMutex
 	lockSend           sync.RWMutex
 }
 
 // GetChat calls GetChatFunc.
-func (mock *tbAPIMock) GetChat(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+func (mock *TbAPI) GetChat(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 	if mock.GetChatFunc == nil {
-		panic("tbAPIMock.GetChatFunc: method is nil but tbAPI.GetChat was just called")
+		panic("TbAPI.GetChatFunc: method is nil but tbAPI.GetChat was just called")
 	}
 	callInfo := struct {
 		Config tbapi.ChatInfoConfig
@@ -98,7 +108,7 @@ func (mock *tbAPIMock) GetChat(config tbapi.ChatInfoConfig) (tbapi.Chat, error)
 // Check the length with:
 //
 //	len(mockedtbAPI.GetChatCalls())
-func (mock *tbAPIMock) GetChatCalls() []struct {
+func (mock *TbAPI) GetChatCalls() []struct {
 	Config tbapi.ChatInfoConfig
 } {
 	var calls []struct {
@@ -111,9 +121,9 @@ func (mock *tbAPIMock) GetChatCalls() []struct {
 }
 
 // GetUpdatesChan calls GetUpdatesChanFunc.
-func (mock *tbAPIMock) GetUpdatesChan(config tbapi.UpdateConfig) tbapi.UpdatesChannel {
+func (mock *TbAPI) GetUpdatesChan(config tbapi.UpdateConfig) tbapi.UpdatesChannel {
 	if mock.GetUpdatesChanFunc == nil {
-		panic("tbAPIMock.GetUpdatesChanFunc: method is nil but tbAPI.GetUpdatesChan was just called")
+		panic("TbAPI.GetUpdatesChanFunc: method is nil but tbAPI.GetUpdatesChan was just called")
 	}
 	callInfo := struct {
 		Config tbapi.UpdateConfig
@@ -130,7 +140,7 @@ func (mock *tbAPIMock) GetUpdatesChan(config tbapi.UpdateConfig) tbapi.UpdatesCh
 // Check the length with:
 //
 //	len(mockedtbAPI.GetUpdatesChanCalls())
-func (mock *tbAPIMock) GetUpdatesChanCalls() []struct {
+func (mock *TbAPI) GetUpdatesChanCalls() []struct {
 	Config tbapi.UpdateConfig
 } {
 	var calls []struct {
@@ -142,10 +152,46 @@ func (mock *tbAPIMock) GetUpdatesChanCalls() []struct {
 	return calls
 }
 
+// MakeRequest calls MakeRequestFunc.
+func (mock *TbAPI) MakeRequest(endpoint string, params tbapi.Params) (*tbapi.APIResponse, error) {
+	if mock.MakeRequestFunc == nil {
+		panic("TbAPI.MakeRequestFunc: method is nil but tbAPI.MakeRequest was just called")
+	}
+	callInfo := struct {
+		Endpoint string
+		Params   tbapi.Params
+	}{
+		Endpoint: endpoint,
+		Params:   params,
+	}
+	mock.lockMakeRequest.Lock()
+	mock.calls.MakeRequest = append(mock.calls.MakeRequest, callInfo)
+	mock.lockMakeRequest.Unlock()
+	return mock.MakeRequestFunc(endpoint, params)
+}
+
+// MakeRequestCalls gets all the calls that were made to MakeRequest.
+// Check the length with:
+//
+//	len(mockedtbAPI.MakeRequestCalls())
+func (mock *TbAPI) MakeRequestCalls() []struct {
+	Endpoint string
+	Params   tbapi.Params
+} {
+	var calls []struct {
+		Endpoint string
+		Params   tbapi.Params
+	}
+	mock.lockMakeRequest.RLock()
+	calls = mock.calls.MakeRequest
+	mock.lockMakeRequest.RUnlock()
+	return calls
+}
+
 // Request calls RequestFunc.
-func (mock *tbAPIMock) Request(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+func (mock *TbAPI) Request(c tbapi.Chattable) (*tbapi.APIResponse, error) {
 	if mock.RequestFunc == nil {
-		panic("tbAPIMock.RequestFunc: method is nil but tbAPI.Request was just called")
+		panic("TbAPI.RequestFunc: method is nil but tbAPI.Request was just called")
 	}
 	callInfo := struct {
 		C tbapi.Chattable
@@ -162,7 +208,7 @@ func (mock *tbAPIMock) Request(c tbapi.Chattable) (*tbapi.APIResponse, error) {
 // Check the length with:
 //
 //	len(mockedtbAPI.RequestCalls())
-func (mock *tbAPIMock) RequestCalls() []struct {
+func (mock *TbAPI) RequestCalls() []struct {
 	C tbapi.Chattable
 } {
 	var calls []struct {
@@ -175,9 +221,9 @@ func (mock *tbAPIMock) RequestCalls() []struct {
 }
 
 // Send calls SendFunc.
-func (mock *tbAPIMock) Send(c tbapi.Chattable) (tbapi.Message, error) {
+func (mock *TbAPI) Send(c tbapi.Chattable) (tbapi.Message, error) {
 	if mock.SendFunc == nil {
-		panic("tbAPIMock.SendFunc: method is nil but tbAPI.Send was just called")
+		panic("TbAPI.SendFunc: method is nil but tbAPI.Send was just called")
 	}
 	callInfo := struct {
 		C tbapi.Chattable
@@ -194,7 +240,7 @@ func (mock *tbAPIMock) Send(c tbapi.Chattable) (tbapi.Message, error) {
 // Check the length with:
 //
 //	len(mockedtbAPI.SendCalls())
-func (mock *tbAPIMock) SendCalls() []struct {
+func (mock *TbAPI) SendCalls() []struct {
 	C tbapi.Chattable
 } {
 	var calls []struct {
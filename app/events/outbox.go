@@ -0,0 +1,214 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/time/rate"
+)
+
+// telegram limits for bots, see https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+const (
+	globalRate    = rate.Limit(30) // messages per second to all chats
+	chatRate      = rate.Limit(1.0 / 3)
+	chatBurst     = 20 // no more than 20 messages per minute to the same group
+	sendAttempts  = 3  // attempts to send before giving up on transient failures
+	sendBackoff   = time.Second
+	maxRetryAfter = time.Minute // longer waits asked by telegram are not honoured, the message dropped
+)
+
+// outbox is the single way out to telegram for messages of all senders: bots, rtjc, idle responses and summaries.
+// Sending runs in per-chat queues, so the caller never waits for telegram limits: jobs of a chat done one by one
+// in order of arrival, different chats don't wait for each other. Messages wait their turn for per-chat and
+// global limits, messages rejected with 429 repeated after retry_after. Other failures of sending not repeated,
+// as the message could be posted already, while requests like delete or pin retried with backoff on transient
+// failures. Messages not sent reported as dropped with the last failure, except ones rejected for broken formatting.
+// Thread safe.
+type outbox struct {
+	api     tbAPI
+	global  *rate.Limiter
+	backoff time.Duration // base delay between attempts on transient failures
+
+	mu      sync.Mutex
+	chats   map[int64]*chatQueue
+	wg      sync.WaitGroup // running queues and requests
+	dropped int64
+	lastErr struct {
+		err error
+		ts  time.Time
+	}
+}
+
+// chatQueue is a queue of jobs sending to the chat, with the chat's limit.
+// The first job kept in the queue while running.
+type chatQueue struct {
+	limiter *rate.Limiter
+	jobs    []func()
+}
+
+func newOutbox(api tbAPI) *outbox {
+	return &outbox{api: api, global: rate.NewLimiter(globalRate, int(globalRate)), backoff: sendBackoff,
+		chats: map[int64]*chatQueue{}}
+}
+
+// Go queues the job to the chat's queue and returns immediately. The job runs after all jobs queued to the chat
+// before, i.e. sends a message and pins it, without blocking jobs of other chats.
+func (o *outbox) Go(chatID int64, job func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	q := o.chat(chatID)
+	q.jobs = append(q.jobs, job)
+	if len(q.jobs) > 1 { // runs already
+		return
+	}
+	o.wg.Add(1)
+	go o.run(q)
+}
+
+// RequestAsync makes request in background, failure logged with the description of the request
+func (o *outbox) RequestAsync(ctx context.Context, c tbapi.Chattable, descr string) {
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		if _, err := o.Request(ctx, c); err != nil {
+			log.Printf("[WARN] can't %s, %v", descr, err)
+		}
+	}()
+}
+
+// Wait blocks till all queued jobs and requests done
+func (o *outbox) Wait() {
+	o.wg.Wait()
+}
+
+// Send sends a new message or edits one in the chat, waiting for chat's and global limits.
+// Blocking call, used by jobs of chat's queue.
+func (o *outbox) Send(ctx context.Context, chatID int64, c tbapi.Chattable) (res tbapi.Message, err error) {
+	if err = o.wait(ctx, chatID); err == nil {
+		err = o.retry(ctx, false, func() (e error) {
+			res, e = o.api.Send(c)
+			return e
+		})
+	}
+	if err != nil && !isParseError(err) { // sent again as plain text by the caller
+		atomic.AddInt64(&o.dropped, 1)
+		o.mu.Lock()
+		o.lastErr.err, o.lastErr.ts = err, time.Now()
+		o.mu.Unlock()
+		log.Printf("[WARN] dropped message %T to chat %d, %v", c, chatID, err)
+	}
+	return res, err
+}
+
+// Request makes a request not counted as a message by telegram, i.e. pin or delete, retried on transient failures
+func (o *outbox) Request(ctx context.Context, c tbapi.Chattable) (res *tbapi.APIResponse, err error) {
+	err = o.retry(ctx, true, func() (e error) {
+		res, e = o.api.Request(c)
+		return e
+	})
+	return res, err
+}
+
+// Dropped returns the number of messages not sent
+func (o *outbox) Dropped() int64 {
+	return atomic.LoadInt64(&o.dropped)
+}
+
+// LastError returns the failure of the last dropped message with its time, nil if nothing dropped
+func (o *outbox) LastError() (err error, ts time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.lastErr.err, o.lastErr.ts
+}
+
+// run does jobs of the queue till it is empty
+func (o *outbox) run(q *chatQueue) {
+	defer o.wg.Done()
+	for {
+		o.mu.Lock()
+		job := q.jobs[0]
+		o.mu.Unlock()
+
+		job()
+
+		o.mu.Lock()
+		q.jobs = q.jobs[1:]
+		done := len(q.jobs) == 0
+		o.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// chat returns queue of the chat, made on the first use, called under lock
+func (o *outbox) chat(chatID int64) *chatQueue {
+	q, ok := o.chats[chatID]
+	if !ok {
+		q = &chatQueue{limiter: rate.NewLimiter(chatRate, chatBurst)}
+		o.chats[chatID] = q
+	}
+	return q
+}
+
+// wait blocks till the message can be sent to the chat without hitting telegram limits
+func (o *outbox) wait(ctx context.Context, chatID int64) error {
+	o.mu.Lock()
+	limiter := o.chat(chatID).limiter
+	o.mu.Unlock()
+
+	if err := limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("chat limit: %w", err)
+	}
+	if err := o.global.Wait(ctx); err != nil {
+		return fmt.Errorf("global limit: %w", err)
+	}
+	return nil
+}
+
+// retry calls fn till success, permanent error or the last attempt. Waits for retry_after on 429.
+// Idempotent requests retried on network and server errors as well, with growing backoff.
+func (o *outbox) retry(ctx context.Context, idempotent bool, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		delay, retryable := o.delay(err, attempt, idempotent)
+		if !retryable || attempt >= sendAttempts {
+			return err
+		}
+		log.Printf("[DEBUG] attempt %d failed, retry in %v, %v", attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %w", err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// delay returns time to wait before the next attempt and false if the request should not be repeated,
+// i.e. bad request or failed message possibly posted already
+func (o *outbox) delay(err error, attempt int, idempotent bool) (time.Duration, bool) {
+	var tbErr *tbapi.Error
+	if !errors.As(err, &tbErr) {
+		return o.backoff * time.Duration(attempt), idempotent // network failure
+	}
+	switch {
+	case tbErr.Code == http.StatusTooManyRequests && tbErr.RetryAfter > 0:
+		retryAfter := time.Duration(tbErr.RetryAfter) * time.Second
+		return retryAfter, retryAfter <= maxRetryAfter
+	case tbErr.Code == http.StatusTooManyRequests:
+		return o.backoff * time.Duration(attempt), true
+	case tbErr.Code >= http.StatusInternalServerError:
+		return o.backoff * time.Duration(attempt), idempotent
+	}
+	return 0, false
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/radio-t/super-bot/app/events/mocks"
+)
+
+func TestOutbox_SendRetries(t *testing.T) {
+	var errs []error
+	tbAPI := &mocks.TbAPI{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+		if len(errs) > 0 {
+			err := errs[0]
+			errs = errs[1:]
+			return tbapi.Message{}, err
+		}
+		return tbapi.Message{MessageID: 1}, nil
+	}}
+	o := newOutbox(tbAPI)
+	o.backoff = time.Millisecond
+
+	tbl := []struct {
+		name  string
+		errs  []error
+		calls int
+		err   string
+	}{
+		{"sent", nil, 1, ""},
+		{"network failure not repeated", []error{errors.New("timeout")}, 1, "timeout"},
+		{"server error not repeated", []error{&tbapi.Error{Code: 502, Message: "bad gateway"}}, 1, "bad gateway"},
+		{"too many requests", []error{&tbapi.Error{Code: 429, Message: "too many",
+			ResponseParameters: tbapi.ResponseParameters{RetryAfter: 1}}}, 2, ""},
+		{"bad request", []error{&tbapi.Error{Code: 400, Message: "bad request"}}, 1, "bad request"},
+		{"too long to wait", []error{&tbapi.Error{Code: 429, Message: "too many",
+			ResponseParameters: tbapi.ResponseParameters{RetryAfter: 3600}}}, 1, "too many"},
+		{"all attempts failed", []error{&tbapi.Error{Code: 429, Message: "e1"}, &tbapi.Error{Code: 429, Message: "e2"},
+			&tbapi.Error{Code: 429, Message: "e3"}}, 3, "e3"},
+	}
+
+	var dropped int64
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			errs = tt.errs
+			calls := len(tbAPI.SendCalls())
+			st := time.Now()
+			res, err := o.Send(context.Background(), 123, tbapi.NewMessage(123, "text"))
+			assert.Equal(t, tt.calls, len(tbAPI.SendCalls())-calls)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				dropped++
+				assert.Equal(t, dropped, o.Dropped())
+				lastErr, ts := o.LastError()
+				assert.Equal(t, err, lastErr)
+				assert.WithinDuration(t, time.Now(), ts, time.Second)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, res.MessageID)
+			if tt.name == "too many requests" {
+				assert.GreaterOrEqual(t, time.Since(st), time.Second, "retry_after honoured")
+			}
+		})
+	}
+}
+
+func TestOutbox_Limits(t *testing.T) {
+	tbAPI := &mocks.TbAPI{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil }}
+	o := newOutbox(tbAPI)
+	o.global = rate.NewLimiter(rate.Every(10*time.Millisecond), 1)
+
+	// the chat's burst used up by the first message, the second one waits too long
+	o.chats[1] = &chatQueue{limiter: rate.NewLimiter(chatRate, 1)}
+	_, err := o.Send(context.Background(), 1, tbapi.NewMessage(1, "first"))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = o.Send(ctx, 1, tbapi.NewMessage(1, "second"))
+	assert.Error(t, err, "chat limit exceeded")
+	assert.Equal(t, 1, len(tbAPI.SendCalls()))
+	assert.Equal(t, int64(1), o.Dropped())
+
+	// other chats limited by global rate only
+	st := time.Now()
+	for i := int64(2); i < 7; i++ {
+		_, err = o.Send(context.Background(), i, tbapi.NewMessage(i, "text"))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 6, len(tbAPI.SendCalls()))
+	assert.GreaterOrEqual(t, time.Since(st), 40*time.Millisecond)
+}
+
+func TestOutbox_RequestRetries(t *testing.T) {
+	errs := []error{errors.New("timeout"), &tbapi.Error{Code: 502, Message: "bad gateway"}}
+	tbAPI := &mocks.TbAPI{RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+		if len(errs) > 0 {
+			err := errs[0]
+			errs = errs[1:]
+			return nil, err
+		}
+		return &tbapi.APIResponse{Ok: true}, nil
+	}}
+	o := newOutbox(tbAPI)
+	o.backoff = time.Millisecond
+
+	_, err := o.Request(context.Background(), tbapi.NewDeleteMessage(1, 2))
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(tbAPI.RequestCalls()), "idempotent request repeated on transient failures")
+}
+
+func TestOutbox_Go(t *testing.T) {
+	tbAPI := &mocks.TbAPI{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil }}
+	o := newOutbox(tbAPI)
+	o.chats[1] = &chatQueue{limiter: rate.NewLimiter(rate.Every(50*time.Millisecond), 1)}
+	require.True(t, o.chats[1].limiter.Allow(), "burst of the chat used up")
+
+	var mu sync.Mutex
+	var res []string
+	send := func(chatID int64, text string) func() {
+		return func() {
+			_, err := o.Send(context.Background(), chatID, tbapi.NewMessage(chatID, text))
+			require.NoError(t, err)
+			mu.Lock()
+			res = append(res, text)
+			mu.Unlock()
+		}
+	}
+
+	st := time.Now()
+	for i := 1; i <= 3; i++ {
+		o.Go(1, send(1, fmt.Sprintf("slow %d", i)))
+	}
+	o.Go(2, send(2, "other chat"))
+	assert.Less(t, time.Since(st), 10*time.Millisecond, "queued without waiting for limits")
+
+	o.Wait()
+	assert.GreaterOrEqual(t, time.Since(st), 150*time.Millisecond)
+	assert.Equal(t, []string{"other chat", "slow 1", "slow 2", "slow 3"}, res,
+		"jobs of the chat done in order, other chat doesn't wait for them")
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+	mdLinkRe  = regexp.MustCompile(`\[([^\]]*)\]\(((?:\\.|[^)\\])*)\)`)
+	mdEscRe   = regexp.MustCompile("\\\\([_*`\\[])") // legacy markdown escapes
+	mdV2EscRe = regexp.MustCompile(`\\([[:punct:]])`)
+)
+
+// isParseError returns true if telegram rejected the message for broken formatting, i.e. unbalanced "_"
+func isParseError(err error) bool {
+	var tbErr *tbapi.Error
+	return errors.As(err, &tbErr) && tbErr.Code == http.StatusBadRequest && strings.Contains(tbErr.Message, "can't parse entities")
+}
+
+// plainText renders formatted text as plain one, to be sent without parse mode.
+// Links keep urls in parentheses, markdown markers left as is, as they can be just a part of the text.
+func plainText(text, parseMode string) string {
+	if parseMode == tbapi.ModeHTML {
+		text = strings.ReplaceAll(text, "<br>", "\n")
+		return html.UnescapeString(htmlTagRe.ReplaceAllString(text, ""))
+	}
+	text = mdLinkRe.ReplaceAllString(text, "$1 ($2)")
+	if parseMode == tbapi.ModeMarkdownV2 {
+		return mdV2EscRe.ReplaceAllString(text, "$1")
+	}
+	return mdEscRe.ReplaceAllString(text, "$1")
+}
@@ -0,0 +1,32 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_plainText(t *testing.T) {
+	tbl := []struct {
+		text, parseMode, res string
+	}{
+		{`*bold* \_text_ [link](https://example.com) and snake_case`, tbapi.ModeMarkdown,
+			"*bold* _text_ link (https://example.com) and snake_case"},
+		{`*bold* \_text\_ [link](https://example.com/a_(b\)) 1\.5 and \\`, tbapi.ModeMarkdownV2,
+			`*bold* _text_ link (https://example.com/a_(b)) 1.5 and \`},
+		{`<b>bold</b> &lt;text&gt;<br><a href="https://example.com">link</a>`, tbapi.ModeHTML, "bold <text>\nlink"},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.res, plainText(tt.text, tt.parseMode))
+	}
+
+	assert.True(t, isParseError(&tbapi.Error{Code: 400,
+		Message: "Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 5"}))
+	assert.True(t, isParseError(fmt.Errorf("wrapped: %w", &tbapi.Error{Code: 400, Message: "can't parse entities"})))
+	assert.False(t, isParseError(&tbapi.Error{Code: 400, Message: "Bad Request: message is not modified"}))
+	assert.False(t, isParseError(errors.New("can't parse entities")))
+	assert.False(t, isParseError(nil))
+}
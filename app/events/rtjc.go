@@ -90,8 +90,8 @@ func (l Rtjc) sendSummary(ctx context.Context, msg string) {
 		return
 	}
 
-	// By default, rate limit to 15 messages per 2 minutes (1 per 8 sec)
-	// Telegram asks 30 sec of waiting after sending 20 messages
+	// By default, rate limit to 15 messages per 2 minutes (1 per 8 sec), so a long summary
+	// doesn't take the whole chat's limit of the listener's outbox
 	rl := rate.NewLimiter(l.SubmitRateLimit, l.SubmitRateBurst)
 	for i, sumMsg := range summaryMsgs {
 		if sumMsg == "" {
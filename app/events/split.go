@@ -0,0 +1,307 @@
+package events
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+// maxMessageLen is the limit of telegram message text, in utf-16 code units
+const maxMessageLen = 4096
+
+// splitResponse splits the response with long text to several ones, each fitting telegram's message.
+// Only the first part is pinned, edits the message and replies, only the last one has buttons.
+func splitResponse(resp bot.Response) []bot.Response {
+	parseMode := defaultParseMode
+	if resp.ParseMode != "" {
+		parseMode = resp.ParseMode
+	}
+	texts := splitText(resp.Text, parseMode, maxMessageLen)
+	if len(texts) == 1 {
+		return []bot.Response{resp}
+	}
+
+	res := make([]bot.Response, 0, len(texts))
+	for i, text := range texts {
+		part := resp
+		part.Text = text
+		if i > 0 {
+			part.Pin, part.ReplyTo, part.Key, part.Edit, part.EditID = false, 0, "", false, 0
+		}
+		if i < len(texts)-1 {
+			part.Buttons, part.Unpin = nil, false
+		}
+		res = append(res, part)
+	}
+	return res
+}
+
+// splitText breaks formatted text to parts not longer than limit. Parts cut on paragraph, line or word boundaries
+// outside of formatting entities, if possible. Entity too long to fit is closed at the end of the part
+// and reopened in the next one, links, tags and html escapes never cut.
+func splitText(text, parseMode string, limit int) []string {
+	var res []string
+	for textLen(text) > limit {
+		head, tail := cutText([]rune(text), parseMode, limit)
+		res = append(res, head)
+		text = tail
+	}
+	return append(res, text)
+}
+
+// cutText returns the head of the text fitting the limit and the rest of it
+func cutText(rs []rune, parseMode string, limit int) (head, tail string) {
+	var para, line, space int // the last cut positions of each kind outside entities
+	type forcedCut struct {
+		pos             int
+		closing, reopen string
+	}
+	var forced, forcedWord forcedCut // the last positions inside entities, anywhere and on word boundary
+	st := splitState{mode: parseMode}
+	size := 0
+	for i := 0; i < len(rs); {
+		if size > limit {
+			break
+		}
+		if st.balanced() && i > 0 {
+			switch {
+			case rs[i] == '\n' && i+1 < len(rs) && rs[i+1] == '\n':
+				para = i
+				line = i
+			case rs[i] == '\n':
+				line = i
+			case rs[i] == ' ':
+				space = i
+			}
+		}
+		// reopened entities should not make the rest longer than the text
+		if st.cuttable() && i > len([]rune(st.reopen())) && size+textLen(st.closing()) <= limit {
+			forced = forcedCut{pos: i, closing: st.closing(), reopen: st.reopen()}
+			if rs[i] == ' ' || rs[i] == '\n' {
+				forcedWord = forced
+			}
+		}
+		n := st.next(rs[i:])
+		size += textLen(string(rs[i : i+n]))
+		i += n
+	}
+
+	for _, pos := range []int{para, line, space} {
+		if pos >= limit/2 {
+			return strings.TrimRight(string(rs[:pos]), " \n"), strings.TrimLeft(string(rs[pos:]), " \n")
+		}
+	}
+	pos := line // line is never before para
+	if space > pos {
+		pos = space
+	}
+	if pos > 0 {
+		return strings.TrimRight(string(rs[:pos]), " \n"), strings.TrimLeft(string(rs[pos:]), " \n")
+	}
+	if forcedWord.pos >= limit/2 {
+		forced = forcedWord
+	}
+	if forced.pos > 0 {
+		return string(rs[:forced.pos]) + forced.closing, forced.reopen + string(rs[forced.pos:])
+	}
+
+	// no place to cut safely, i.e. huge link
+	pos = 0
+	for size := 0; pos < len(rs) && size+textLen(string(rs[pos])) <= limit; pos++ {
+		size += textLen(string(rs[pos]))
+	}
+	return string(rs[:pos]), string(rs[pos:])
+}
+
+// splitState tracks formatting entities open at the current position of the text
+type splitState struct {
+	mode string
+
+	markers []string // markdown: open entity markers, i.e. "*" or "```", nested in MarkdownV2 only
+	link    int      // markdown: 1 inside link text, 2 inside link url
+
+	amp  bool     // html: inside of escape, i.e. "&amp;"
+	tags []string // html: open tags as written
+}
+
+// next moves over the token at the start of rs, returns its length in runes
+func (s *splitState) next(rs []rune) int {
+	switch s.mode {
+	case tbapi.ModeHTML:
+		return s.nextHTML(rs)
+	case tbapi.ModeMarkdownV2:
+		return s.nextMarkdownV2(rs)
+	}
+	return s.nextMarkdown(rs)
+}
+
+func (s *splitState) nextMarkdown(rs []rune) int {
+	r, pre := rs[0], len(rs) >= 3 && string(rs[:3]) == "```"
+	switch top := s.top(); {
+	case top == "```":
+		if pre {
+			s.markers = nil
+			return 3
+		}
+	case top != "":
+		if string(r) == top {
+			s.markers = nil
+		}
+	case s.link == 1:
+		if r == ']' {
+			s.link = 0
+			if len(rs) > 1 && rs[1] == '(' {
+				s.link = 2
+				return 2
+			}
+		}
+	case s.link == 2:
+		if r == ')' {
+			s.link = 0
+		}
+	case r == '\\' && len(rs) > 1:
+		return 2
+	case pre:
+		s.markers = []string{"```"}
+		return 3
+	case r == '*' || r == '_' || r == '`':
+		s.markers = []string{string(r)}
+	case r == '[':
+		s.link = 1
+	}
+	return 1
+}
+
+// nextMarkdownV2 handles MarkdownV2, where any character can be escaped and entities nest
+func (s *splitState) nextMarkdownV2(rs []rune) int {
+	r, top := rs[0], s.top()
+	code := top == "`" || top == "```"
+	switch {
+	case r == '\\' && len(rs) > 1:
+		return 2
+	case s.link == 2:
+		if r == ')' {
+			s.link = 0
+		}
+		return 1
+	case code:
+		if hasPrefix(rs, top) {
+			s.markers = s.markers[:len(s.markers)-1]
+			return len([]rune(top))
+		}
+		return 1
+	case s.link == 1 && r == ']':
+		s.link = 0
+		if len(rs) > 1 && rs[1] == '(' {
+			s.link = 2
+			return 2
+		}
+		return 1
+	}
+
+	for _, m := range []string{"```", "||", "__", "*", "_", "~", "`"} {
+		if m == "__" && top == "_" { // closing italic, not opening underline
+			continue
+		}
+		if !hasPrefix(rs, m) {
+			continue
+		}
+		if m == top {
+			s.markers = s.markers[:len(s.markers)-1]
+		} else {
+			s.markers = append(s.markers, m)
+		}
+		return len(m)
+	}
+	if r == '[' {
+		s.link = 1
+	}
+	return 1
+}
+
+func (s *splitState) nextHTML(rs []rune) int {
+	switch r := rs[0]; {
+	case r == '<': // the whole tag taken at once
+		end := 0
+		for end < len(rs) && rs[end] != '>' {
+			end++
+		}
+		if end == len(rs) { // not a tag, telegram rejects it anyway
+			return 1
+		}
+		tag := string(rs[:end+1])
+		switch {
+		case strings.HasPrefix(tag, "</"):
+			if len(s.tags) > 0 {
+				s.tags = s.tags[:len(s.tags)-1]
+			}
+		case !strings.HasSuffix(tag, "/>"):
+			s.tags = append(s.tags, tag)
+		}
+		return end + 1
+	case r == '&':
+		s.amp = true
+	case s.amp && (r == ';' || r == ' '):
+		s.amp = false
+	}
+	return 1
+}
+
+// balanced returns true outside of any entity
+func (s *splitState) balanced() bool {
+	return len(s.markers) == 0 && s.link == 0 && !s.amp && len(s.tags) == 0
+}
+
+// cuttable returns true if open entities can be closed and reopened at the position
+func (s *splitState) cuttable() bool {
+	return s.link == 0 && !s.amp
+}
+
+// closing returns markup closing all open entities
+func (s *splitState) closing() string {
+	res := ""
+	if s.mode != tbapi.ModeHTML {
+		for i := len(s.markers) - 1; i >= 0; i-- {
+			res += s.markers[i]
+		}
+		return res
+	}
+	for i := len(s.tags) - 1; i >= 0; i-- {
+		name := strings.TrimPrefix(s.tags[i], "<")
+		if n := strings.IndexAny(name, " >"); n >= 0 {
+			name = name[:n]
+		}
+		res += "</" + name + ">"
+	}
+	return res
+}
+
+// reopen returns markup opening entities closed by closing
+func (s *splitState) reopen() string {
+	if s.mode != tbapi.ModeHTML {
+		return strings.Join(s.markers, "")
+	}
+	return strings.Join(s.tags, "")
+}
+
+// top returns the innermost open markdown marker
+func (s *splitState) top() string {
+	if len(s.markers) == 0 {
+		return ""
+	}
+	return s.markers[len(s.markers)-1]
+}
+
+// textLen returns length of the text as counted by telegram
+func textLen(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// hasPrefix returns true if rs starts with the prefix
+func hasPrefix(rs []rune, prefix string) bool {
+	p := []rune(prefix)
+	return len(rs) >= len(p) && string(rs[:len(p)]) == prefix
+}
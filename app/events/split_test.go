@@ -0,0 +1,87 @@
+package events
+
+import (
+	"strings"
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+func Test_splitText(t *testing.T) {
+	tbl := []struct {
+		name      string
+		text      string
+		parseMode string
+		limit     int
+		res       []string
+	}{
+		{"short", "some *text*", tbapi.ModeMarkdown, 20, []string{"some *text*"}},
+		{"paragraphs", "first paragraph\n\nsecond one\nline", tbapi.ModeMarkdown, 30,
+			[]string{"first paragraph", "second one\nline"}},
+		{"lines", "first line\nsecond line\nthird line", tbapi.ModeMarkdown, 25,
+			[]string{"first line\nsecond line", "third line"}},
+		{"words", "one two three four five six", tbapi.ModeMarkdown, 15, []string{"one two three", "four five six"}},
+		{"not inside of entity", "some *bold text* and more", tbapi.ModeMarkdown, 14,
+			[]string{"some", "*bold text*", "and more"}},
+		{"escaped marker", `a \*b c\* d e f`, tbapi.ModeMarkdown, 10, []string{`a \*b c\*`, "d e f"}},
+		{"not inside of link", "see [the link](https://example.com/a b) now", tbapi.ModeMarkdown, 45,
+			[]string{"see [the link](https://example.com/a b) now"}},
+		{"link moved", "see [the link](https://example.com/a b) now", tbapi.ModeMarkdown, 38,
+			[]string{"see", "[the link](https://example.com/a b)", "now"}},
+		{"long entity reopened", "```\n" + strings.Repeat("code ", 6) + "```", tbapi.ModeMarkdown, 20,
+			[]string{"```\ncode code```", "``` code code```", "``` code code ```"}},
+		{"html tags", "<b>bold</b> text <i>italic text</i>", tbapi.ModeHTML, 20,
+			[]string{"<b>bold</b> text", "<i>italic text</i>"}},
+		{"html long tag reopened", `<a href="u">link text is long</a>`, tbapi.ModeHTML, 25,
+			[]string{`<a href="u">link text</a>`, `<a href="u"> is long</a>`}},
+		{"html escapes", "&lt;&lt;&lt;&lt;&lt;&lt;", tbapi.ModeHTML, 10, []string{"&lt;&lt;", "&lt;&lt;", "&lt;&lt;"}},
+		{"v2 escaped marker", `a \_b c\_ d e f`, tbapi.ModeMarkdownV2, 10, []string{`a \_b c\_`, "d e f"}},
+		{"v2 nested reopened", "*bold _italic text_ end*", tbapi.ModeMarkdownV2, 18,
+			[]string{"*bold _italic_*", "*_ text_ end*"}},
+		{"v2 underline and spoiler", "__under line__ ||spoiler text||", tbapi.ModeMarkdownV2, 20,
+			[]string{"__under line__", "||spoiler text||"}},
+		{"v2 code not parsed", "`a_b c_d e_f` g", tbapi.ModeMarkdownV2, 12, []string{"`a_b c_d`", "` e_f` g"}},
+		{"v2 link with escapes", `see [link](https://x.y/\)) now`, tbapi.ModeMarkdownV2, 24,
+			[]string{"see", `[link](https://x.y/\))`, "now"}},
+		{"no place to cut", "abcdefghij", tbapi.ModeMarkdown, 4, []string{"abcd", "efgh", "ij"}},
+		{"utf-16 length", "😀😀😀😀", tbapi.ModeMarkdown, 4, []string{"😀😀", "😀😀"}},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			res := splitText(tt.text, tt.parseMode, tt.limit)
+			assert.Equal(t, tt.res, res)
+			for _, r := range res {
+				assert.LessOrEqual(t, textLen(r), tt.limit)
+			}
+		})
+	}
+}
+
+func Test_splitResponse(t *testing.T) {
+	resp := bot.Response{Text: strings.Repeat("a", 4000) + "\n" + strings.Repeat("b", 200), Send: true, Pin: true,
+		Unpin: true, ReplyTo: 1, Key: "k", Edit: true, Buttons: [][]bot.Button{{{Text: "next", Data: "2"}}}}
+	res := splitResponse(resp)
+	require.Len(t, res, 2)
+
+	assert.Equal(t, strings.Repeat("a", 4000), res[0].Text)
+	assert.True(t, res[0].Pin)
+	assert.False(t, res[0].Unpin)
+	assert.Equal(t, 1, res[0].ReplyTo)
+	assert.Equal(t, "k", res[0].Key)
+	assert.Nil(t, res[0].Buttons)
+
+	assert.Equal(t, strings.Repeat("b", 200), res[1].Text)
+	assert.False(t, res[1].Pin)
+	assert.True(t, res[1].Unpin)
+	assert.Equal(t, 0, res[1].ReplyTo)
+	assert.Equal(t, "", res[1].Key)
+	assert.Equal(t, resp.Buttons, res[1].Buttons)
+
+	resp.Text = "short"
+	assert.Equal(t, []bot.Response{resp}, splitResponse(resp))
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,10 +14,11 @@ import (
 	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/bot/format"
 )
 
-//go:generate moq --out mock_tb_api.go . tbAPI
-//go:generate moq --out mock_msg_logger.go . msgLogger
+//go:generate moq --out mocks/tb_api.go --pkg mocks --skip-ensure . tbAPI:TbAPI
+//go:generate moq --out mocks/msg_logger.go --pkg mocks --skip-ensure . msgLogger:MsgLogger
 
 // TelegramListener listens to tg update, forward to bots and send back responses
 // Not thread safe
@@ -31,7 +33,21 @@ type TelegramListener struct {
 	BotsActivityTerm       Terminator // bot-only activity for given user
 	OverallBotActivityTerm Terminator // bot-only activity for all users
 	SuperUsers             SuperUser
-	chatID                 int64
+	Webhook                Webhook     // receive updates with webhook instead of long polling, if Address set
+	Chats                  []*Chat     // additional chats, with their own settings
+	Store                  bot.KVStore // keeps pending deletions of messages with TTL across restarts, optional
+
+	main  *Chat           // the main chat, made of listener's fields
+	chats map[int64]*Chat // all managed chats by id
+	out   *outbox         // throttled sending of all messages
+	bans  *banLedger      // history of bans in all chats
+
+	cleanupEvery time.Duration          // how often expired messages deleted and bans lifted, cleanupInterval if 0
+	restrictions map[string]restriction // restricted users to be unbanned at the end, by chat and user id
+
+	mu      sync.Mutex                 // guards state changed by sending in outbox queues
+	sent    map[int64]map[string]int   // ids of bot messages sent with keys, by chat id and key
+	pending map[string]pendingDeletion // messages to delete after TTL, by chat and message id
 
 	msgs struct {
 		once sync.Once
@@ -39,10 +55,20 @@ type TelegramListener struct {
 	}
 }
 
+// defaultParseMode is used for responses without parse mode set
+const defaultParseMode = tbapi.ModeMarkdownV2
+
+// warningTTL is how long warnings of terminators kept in the chat
+const warningTTL = time.Minute
+
+// unbanCallback starts data of ban message's "undo" button. Never matches bot name in data of bots' buttons
+const unbanCallback = "unban!"
+
 type tbAPI interface {
 	GetUpdatesChan(config tbapi.UpdateConfig) tbapi.UpdatesChannel
 	Send(c tbapi.Chattable) (tbapi.Message, error)
 	Request(c tbapi.Chattable) (*tbapi.APIResponse, error)
+	MakeRequest(endpoint string, params tbapi.Params) (*tbapi.APIResponse, error)
 	GetChat(config tbapi.ChatInfoConfig) (tbapi.Chat, error)
 }
 
@@ -50,13 +76,22 @@ type msgLogger interface {
 	Save(msg *bot.Message)
 }
 
+// commandsMenu is implemented by bots declaring commands for telegram menu, i.e. bot.MultiBot
+type commandsMenu interface {
+	BotCommands() []tbapi.BotCommand
+}
+
+// multiResponder is implemented by bots answering with several independent responses, i.e. bot.MultiBot
+type multiResponder interface {
+	OnMessages(ctx context.Context, msg bot.Message) []bot.Response
+}
+
 // Do process all events, blocked call
 func (l *TelegramListener) Do(ctx context.Context) error {
-	log.Printf("[INFO] start telegram listener for %q", l.Group)
+	log.Printf("[INFO] start telegram listener for %q and %d additional chats", l.Group, len(l.Chats))
 
-	var getChatErr error
-	if l.chatID, getChatErr = l.getChatID(l.Group); getChatErr != nil {
-		return fmt.Errorf("failed to get chat ID for group %q: %w", l.Group, getChatErr)
+	if err := l.setupChats(); err != nil {
+		return err
 	}
 
 	l.msgs.once.Do(func() {
@@ -66,10 +101,38 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 		}
 	})
 
-	u := tbapi.NewUpdate(0)
-	u.Timeout = 60
+	updates, err := l.updates(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get updates: %w", err)
+	}
 
-	updates := l.TbAPI.GetUpdatesChan(u)
+	if l.out == nil {
+		l.out = newOutbox(l.TbAPI)
+	}
+	defer l.out.Wait() // messages queued before the stop sent
+	if l.bans == nil {
+		l.bans = newBanLedger(l.Store)
+	}
+	l.loadPending()
+	l.loadRestrictions()
+	if l.cleanupEvery == 0 {
+		l.cleanupEvery = cleanupInterval
+	}
+	cleanup := time.NewTicker(l.cleanupEvery)
+	defer cleanup.Stop()
+
+	// idle timer restarted by updates and outside messages only, so cleanup ticks don't postpone idle forever
+	idle := time.NewTimer(l.IdleDuration)
+	defer idle.Stop()
+	resetIdle := func() {
+		if !idle.Stop() {
+			select {
+			case <-idle.C:
+			default:
+			}
+		}
+		idle.Reset(l.IdleDuration)
+	}
 
 	for {
 		select {
@@ -81,167 +144,508 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 			if !ok {
 				return fmt.Errorf("telegram update chan closed")
 			}
-
-			if update.Message == nil {
-				log.Print("[DEBUG] empty message body")
-				continue
+			resetIdle()
+
+			switch {
+			case update.Message != nil:
+				l.procMessage(ctx, update.Message)
+			case update.EditedMessage != nil:
+				l.procEditedMessage(ctx, update.EditedMessage)
+			case update.ChannelPost != nil:
+				l.procMessage(ctx, update.ChannelPost)
+			case update.EditedChannelPost != nil:
+				l.procEditedMessage(ctx, update.EditedChannelPost)
+			case update.CallbackQuery != nil:
+				l.procCallback(ctx, update.CallbackQuery)
+			default:
+				log.Print("[DEBUG] unsupported update")
 			}
 
-			msgJSON, errJSON := json.Marshal(update.Message)
-			if errJSON != nil {
-				log.Printf("[ERROR] failed to marshal update.Message to json: %v", errJSON)
-				continue
+		case resp := <-l.msgs.ch: // publish messages from outside clients
+			resetIdle()
+			l.sendBotResponse(ctx, resp, l.main.chatID)
+
+		case <-cleanup.C:
+			l.deleteExpired(ctx)
+			l.unbanExpired()
+
+		case <-idle.C: // hit bots of all chats on idle timeout
+			for _, c := range l.allChats() {
+				for _, resp := range l.botsResponses(ctx, c.Bots, bot.Message{Text: "idle"}) {
+					l.sendBotResponse(ctx, resp, c.chatID)
+				}
 			}
-			log.Printf("[DEBUG] %s", string(msgJSON))
+			idle.Reset(l.IdleDuration)
+		}
+	}
+}
 
-			if update.Message.Chat == nil {
-				log.Print("[DEBUG] ignoring message not from chat")
-				continue
+// procMessage passes a new message or channel post to bots and sends their responses.
+// Messages of managed chats are logged and moderated, channel posts are not moderated as they have no sender.
+func (l *TelegramListener) procMessage(ctx context.Context, tbMsg *tbapi.Message) {
+	msg, chat, managed, ok := l.incoming(tbMsg)
+	if !ok {
+		return
+	}
+	fromChat := tbMsg.Chat.ID
+
+	// check for all-activity ban
+	if tbMsg.From != nil {
+		b := chat.AllActivityTerm.check(msg.From, msg.SenderChat, msg.Sent, fromChat)
+		if b.active {
+			if b.new && !chat.SuperUsers.IsSuper(tbMsg.From.UserName) && managed {
+				if err := l.applyBan(ctx, *msg, b.duration, fromChat, tbMsg.From.ID, "слишком много сообщений"); err != nil {
+					log.Printf("[ERROR] can't ban for all activity, %v", err)
+				}
 			}
+			return
+		}
+		if b.warn && managed {
+			l.warn(ctx, *msg, fromChat)
+		}
+	}
 
-			fromChat := update.Message.Chat.ID
+	resps := l.botsResponses(ctx, chat.Bots, *msg)
 
-			msg := l.transform(update.Message)
-			if fromChat == l.chatID {
-				l.MsgLogger.Save(msg) // save an incoming update to report
-			}
+	if managed && tbMsg.From != nil && l.botActivityBan(ctx, chat, resps, *msg, fromChat, tbMsg.From.ID) {
+		log.Printf("[INFO] bot activity ban initiated for %+v", tbMsg.From)
+		return
+	}
 
-			log.Printf("[DEBUG] incoming msg: %+v", msg)
+	for _, resp := range resps {
+		if managed {
+			resp = l.escalateBan(chat, resp, fromChat)
+			resp = withUnbanButton(chat, resp)
+		}
+		l.sendBotResponse(ctx, resp, fromChat)
+		if resp.TTL > 0 && resp.DeleteTrigger {
+			l.deleteLater(fromChat, tbMsg.MessageID, resp.TTL)
+		}
+		if managed {
+			l.botResponseBan(chat, resp, tbMsg, fromChat)
+			l.botResponseUnban(chat, resp, tbMsg, fromChat)
+		}
+		if resp.RefreshMenu {
+			l.refreshCommandsMenu(chat)
+		}
+	}
+}
 
-			// check for all-activity ban
-			if b := l.AllActivityTerm.check(msg.From, msg.SenderChat, msg.Sent, fromChat); b.active {
-				if b.new && !l.SuperUsers.IsSuper(update.Message.From.UserName) && fromChat == l.chatID {
-					if err := l.applyBan(*msg, l.AllActivityTerm.BanDuration, fromChat, update.Message.From.ID); err != nil {
-						log.Printf("[ERROR] can't ban for all activity, %v", err)
-					}
-				}
-				continue
-			}
+// procEditedMessage logs the edited message and passes it to bots checking edits, i.e. moderation bots.
+// Edits are not counted as activity by terminators.
+func (l *TelegramListener) procEditedMessage(ctx context.Context, tbMsg *tbapi.Message) {
+	msg, chat, managed, ok := l.incoming(tbMsg)
+	if !ok {
+		return
+	}
+	for _, resp := range l.botsResponses(ctx, chat.Bots, *msg) {
+		if managed {
+			resp = withUnbanButton(chat, resp)
+		}
+		l.sendBotResponse(ctx, resp, tbMsg.Chat.ID)
+		if managed {
+			l.botResponseBan(chat, resp, tbMsg, tbMsg.Chat.ID)
+		}
+	}
+}
 
-			resp := l.Bots.OnMessage(*msg)
+// procCallback passes pressed inline keyboard button to bots and answers the query, so telegram client
+// stops showing progress. Ban's "undo" button handled by the listener itself.
+// Callbacks of inline mode messages ignored as they have no chat.
+func (l *TelegramListener) procCallback(ctx context.Context, query *tbapi.CallbackQuery) {
+	answer := "" // shown to the user pressed the button, if set
+	defer func() {
+		if _, err := l.TbAPI.Request(tbapi.NewCallback(query.ID, answer)); err != nil {
+			log.Printf("[WARN] failed to answer callback query %s, %v", query.ID, err)
+		}
+	}()
 
-			if fromChat == l.chatID && l.botActivityBan(resp, *msg, fromChat, update.Message.From.ID) {
-				log.Printf("[INFO] bot activity ban initiated for %+v", update.Message.From)
-				continue
-			}
+	if query.Message == nil || query.Message.Chat == nil {
+		log.Printf("[DEBUG] ignoring callback query %s without message", query.ID)
+		return
+	}
+	log.Printf("[DEBUG] callback query %s with %q from %+v", query.ID, query.Data, query.From)
 
-			if err := l.sendBotResponse(resp, fromChat); err != nil {
-				log.Printf("[WARN] failed to respond on update, %v", err)
-			}
+	fromChat := query.Message.Chat.ID
+	chat, managed := l.chat(fromChat)
+	if strings.HasPrefix(query.Data, unbanCallback) {
+		if managed {
+			answer = l.unbanOnCallback(chat, query)
+		}
+		return
+	}
 
-			// some bots may request direct ban for given duration
-			if resp.Send &&
-				resp.BanInterval > 0 &&
-				(!l.SuperUsers.IsSuper(resp.User.Username) || resp.ChannelID != 0) && // should not ban superusers, but should ban channels
-				fromChat == l.chatID { // ban only in the same chat
-				log.Printf("[DEBUG] ban initiated for %+v", resp)
-				banUserStr := getBanUsername(resp, update)
-
-				banSuccessMessage := fmt.Sprintf("[INFO] %s banned by bot for %v", banUserStr, resp.BanInterval)
-				if resp.ChannelID != 0 {
-					banSuccessMessage = fmt.Sprintf("[INFO] %v channel banned by bot forever", banUserStr)
-				}
+	msg := bot.Message{ID: query.Message.MessageID, ChatID: fromChat, Sent: time.Now(),
+		Callback: &bot.Callback{ID: query.ID, Data: query.Data}}
+	if query.From != nil {
+		msg.From = bot.User{ID: query.From.ID, Username: query.From.UserName,
+			DisplayName: query.From.FirstName + " " + query.From.LastName}
+	}
 
-				if err := l.banUserOrChannel(resp.BanInterval, fromChat, resp.User.ID, resp.ChannelID); err != nil {
-					log.Printf("[ERROR] can't ban %s on bot response, %v", banUserStr, err)
-				} else {
-					log.Print(banSuccessMessage)
-				}
-			}
+	for _, resp := range l.botsResponses(ctx, chat.Bots, msg) {
+		l.sendBotResponse(ctx, resp, fromChat)
+	}
+}
 
-		case resp := <-l.msgs.ch: // publish messages from outside clients
-			if err := l.sendBotResponse(resp, l.chatID); err != nil {
-				log.Printf("[WARN] failed to respond on rtjc event, %v", err)
-			}
+// incoming transforms telegram message and saves it to the log of managed chat.
+// Returns false for messages not from a chat.
+func (l *TelegramListener) incoming(tbMsg *tbapi.Message) (msg *bot.Message, chat *Chat, managed, ok bool) {
+	msgJSON, errJSON := json.Marshal(tbMsg)
+	if errJSON != nil {
+		log.Printf("[ERROR] failed to marshal update.Message to json: %v", errJSON)
+		return nil, nil, false, false
+	}
+	log.Printf("[DEBUG] %s", string(msgJSON))
+
+	if tbMsg.Chat == nil {
+		log.Print("[DEBUG] ignoring message not from chat")
+		return nil, nil, false, false
+	}
+
+	chat, managed = l.chat(tbMsg.Chat.ID)
+	msg = l.transform(tbMsg)
+	if managed {
+		chat.MsgLogger.Save(msg) // save an incoming update to report
+	}
+	log.Printf("[DEBUG] incoming msg: %+v", msg)
+	return msg, chat, managed, true
+}
+
+// updates returns channel of telegram updates, received with webhook or long polling
+func (l *TelegramListener) updates(ctx context.Context) (tbapi.UpdatesChannel, error) {
+	if !l.Webhook.enabled() {
+		u := tbapi.NewUpdate(0)
+		u.Timeout = 60
+		return l.TbAPI.GetUpdatesChan(u), nil
+	}
+
+	// telegram retries updates till the listener started, so registration goes first
+	if err := l.Webhook.register(l.TbAPI); err != nil {
+		return nil, err
+	}
+	return l.Webhook.listen(ctx)
+}
+
+// botsResponses returns all responses of bots on msg, each one to be sent separately
+func (l *TelegramListener) botsResponses(ctx context.Context, bots bot.Interface, msg bot.Message) []bot.Response {
+	if mr, ok := bots.(multiResponder); ok {
+		return mr.OnMessages(ctx, msg)
+	}
+	if resp := bot.WithContext(bots).OnMessageContext(ctx, msg); resp.Send {
+		return []bot.Response{resp}
+	}
+	return nil
+}
+
+// botResponseBan bans user or channel if bot requested direct ban for given duration
+func (l *TelegramListener) botResponseBan(chat *Chat, resp bot.Response, tbMsg *tbapi.Message, fromChat int64) {
+	if !resp.Send || resp.BanInterval <= 0 {
+		return
+	}
+	if chat.SuperUsers.IsSuper(resp.User.Username) && resp.ChannelID == 0 { // should not ban superusers, but should ban channels
+		return
+	}
+
+	log.Printf("[DEBUG] ban initiated for %+v", resp)
+	banUserStr := getBanUsername(resp, tbMsg)
+
+	kick := resp.Kick && resp.ChannelID == 0
+	banSuccessMessage := fmt.Sprintf("[INFO] %s banned by bot for %v", banUserStr, resp.BanInterval)
+	switch {
+	case resp.ChannelID != 0:
+		banSuccessMessage = fmt.Sprintf("[INFO] %v channel banned by bot forever", banUserStr)
+	case kick:
+		banSuccessMessage = fmt.Sprintf("[INFO] %s kicked by bot", banUserStr)
+	}
+
+	ban := func() error { return l.banUserOrChannel(resp.BanInterval, fromChat, resp.User.ID, resp.ChannelID) }
+	if kick {
+		ban = func() error { return l.kickUser(fromChat, resp.User.ID) }
+	}
+	if err := ban(); err != nil {
+		log.Printf("[ERROR] can't ban %s on bot response, %v", banUserStr, err)
+		return
+	}
+	log.Print(banSuccessMessage)
+
+	rec := banRecord{ChatID: fromChat, User: resp.User, ChannelID: resp.ChannelID, By: byBot, Reason: resp.BanReason,
+		Duration: resp.BanInterval, Kicked: kick}
+	if resp.ChannelID != 0 || kick {
+		rec.Duration = 0 // forever
+	}
+	if resp.ChannelID != 0 {
+		rec.User = bot.User{}
+	}
+	if tbMsg.From != nil && chat.SuperUsers.IsSuper(tbMsg.From.UserName) { // i.e. wtf as reply of admin
+		rec.By = "@" + tbMsg.From.UserName
+	}
+	l.bans.add(rec)
+}
+
+// escalateBan makes the ban requested by bot longer for repeat offenders, if the bot allows it,
+// and tells about it in the response
+func (l *TelegramListener) escalateBan(chat *Chat, resp bot.Response, chatID int64) bot.Response {
+	if !resp.Send || !resp.Escalate || resp.BanInterval <= 0 || resp.ChannelID != 0 || chat.SuperUsers.IsSuper(resp.User.Username) {
+		return resp
+	}
+	duration := l.bans.escalate(chatID, resp.User, 0, resp.BanInterval)
+	if duration == resp.BanInterval {
+		return resp
+	}
+	log.Printf("[INFO] ban of %v escalated from %v to %v for repeat offence", resp.User, resp.BanInterval, duration)
+	parseMode := defaultParseMode
+	if resp.ParseMode != "" {
+		parseMode = resp.ParseMode
+	}
+	resp.Text += format.Render(parseMode, format.Text("\n"),
+		format.Italic(format.Text("не в первый раз, бан на "+bot.HumanizeDuration(duration))))
+	resp.BanInterval = duration
+	return resp
+}
+
+// withUnbanButton adds admin's "undo" button to the bot's response banning user or channel
+func withUnbanButton(chat *Chat, resp bot.Response) bot.Response {
+	if !resp.Send || resp.BanInterval <= 0 {
+		return resp
+	}
+	if chat.SuperUsers.IsSuper(resp.User.Username) && resp.ChannelID == 0 { // not banned, see botResponseBan
+		return resp
+	}
+	resp.Buttons = append(append([][]bot.Button{}, resp.Buttons...), unbanButton(resp.User.ID, resp.ChannelID))
+	return resp
+}
+
+// unbanButton makes "undo" button for the ban message, handled by unbanOnCallback
+func unbanButton(userID, channelID int64) []bot.Button {
+	return []bot.Button{{Text: "разбанить", Data: fmt.Sprintf("%s%d:%d", unbanCallback, userID, channelID)}}
+}
+
+// unbanOnCallback lifts the ban on "undo" button pressed by superuser, returns answer to the user pressed it
+func (l *TelegramListener) unbanOnCallback(chat *Chat, query *tbapi.CallbackQuery) string {
+	if query.From == nil || !chat.SuperUsers.IsSuper(query.From.UserName) {
+		return "только для админов"
+	}
+	var userID, channelID int64
+	if _, err := fmt.Sscanf(strings.TrimPrefix(query.Data, unbanCallback), "%d:%d", &userID, &channelID); err != nil {
+		log.Printf("[WARN] unexpected unban callback %q, %v", query.Data, err)
+		return ""
+	}
+	if err := l.liftBan(chat, query.Message.Chat.ID, userID, channelID, query.From.UserName); err != nil {
+		return "не получилось разбанить"
+	}
+	return "разбанен"
+}
 
-		case <-time.After(l.IdleDuration): // hit bots on idle timeout
-			resp := l.Bots.OnMessage(bot.Message{Text: "idle"})
-			if err := l.sendBotResponse(resp, l.chatID); err != nil {
-				log.Printf("[WARN] failed to respond on idle, %v", err)
+// botResponseUnban lifts the ban if bot requested it, i.e. admin's unban command
+func (l *TelegramListener) botResponseUnban(chat *Chat, resp bot.Response, tbMsg *tbapi.Message, fromChat int64) {
+	if !resp.Send || !resp.Unban || (resp.User.ID == 0 && resp.ChannelID == 0) {
+		return
+	}
+	admin := ""
+	if tbMsg.From != nil {
+		admin = tbMsg.From.UserName
+	}
+	_ = l.liftBan(chat, fromChat, resp.User.ID, resp.ChannelID, admin) // logged by liftBan
+}
+
+// liftBan unbans user or channel and forgets the ban, so neither scheduled unban nor terminators
+// keep the user restricted. Restriction of the user lifted if known, otherwise the user is unbanned as kicked by admin
+func (l *TelegramListener) liftBan(chat *Chat, chatID, userID, channelID int64, admin string) error {
+	unban := func() error { return l.unbanUserOrChannel(chatID, userID, channelID) }
+	if channelID == 0 && !l.bans.restricted(chatID, userID) {
+		unban = func() error { return l.unkickUser(chatID, userID) }
+	}
+	if err := unban(); err != nil {
+		log.Printf("[ERROR] can't unban user %d, channel %d: %v", userID, channelID, err)
+		return err
+	}
+	log.Printf("[INFO] user %d, channel %d unbanned by %s", userID, channelID, admin)
+	l.bans.lift(chatID, userID, channelID, "@"+admin)
+	if channelID == 0 {
+		l.cancelUnban(chatID, userID)
+		for _, term := range []*Terminator{&chat.AllActivityTerm, &chat.BotsActivityTerm} {
+			term.lift(chatID, userID)
+		}
+	}
+	return nil
+}
+
+// Bans reports active and recent bans in the chat, used by admin's bans command
+func (l *TelegramListener) Bans(chatID int64) string {
+	if l.bans == nil { // not started yet
+		return ""
+	}
+	return l.bans.report(chatID)
+}
+
+// Status reports users of the chat banned by terminators or restricted, and dropped messages of all chats,
+// used by admin's status command
+func (l *TelegramListener) Status(chatID int64) string {
+	if l.main == nil { // not started yet
+		return ""
+	}
+	sb := strings.Builder{}
+	c, _ := l.chat(chatID)
+	terms := []struct {
+		name string
+		term *Terminator
+	}{{"все сообщения", &c.AllActivityTerm}, {"боты", &c.BotsActivityTerm}, {"боты для всех", &c.OverallBotActivityTerm}}
+	for _, t := range terms {
+		for _, b := range t.term.banned() {
+			if b.chatID != chatID {
+				continue
 			}
+			name := "все"
+			switch {
+			case b.user.Username != "":
+				name = "@" + b.user.Username
+			case b.user.DisplayName != "":
+				name = b.user.DisplayName
+			case b.user.ID != 0:
+				name = strconv.FormatInt(b.user.ID, 10)
+			}
+			_, _ = sb.WriteString(format.Markdown(format.Text(fmt.Sprintf("%s до %s (%s)\n", name, b.until.Format("15:04:05"), t.name))))
+		}
+	}
+	res := ""
+	if sb.Len() > 0 {
+		res = format.Markdown(format.Bold(format.Text("баны за активность:")), format.Text("\n")) + sb.String()
+	}
+	restricted := 0
+	for _, r := range l.restrictions {
+		if r.ChatID == chatID {
+			restricted++
 		}
 	}
+	if restricted > 0 {
+		res += format.Markdown(format.Bold(format.Text("ограничено пользователей:")), format.Text(fmt.Sprintf(" %d\n", restricted)))
+	}
+	if l.out != nil && l.out.Dropped() > 0 {
+		res += format.Markdown(format.Bold(format.Text("не отправлено сообщений:")), format.Text(fmt.Sprintf(" %d\n", l.out.Dropped())))
+		if err, ts := l.out.LastError(); err != nil {
+			res += format.Markdown(format.Bold(format.Text("ошибка отправки")),
+				format.Text(fmt.Sprintf(" %s назад: %s\n", bot.HumanizeDuration(time.Since(ts)), err.Error())))
+		}
+	}
+	return res
 }
 
-func getBanUsername(resp bot.Response, update tbapi.Update) string {
+func getBanUsername(resp bot.Response, tbMsg *tbapi.Message) string {
 	if resp.ChannelID == 0 {
 		return fmt.Sprintf("%v", resp.User)
 	}
 	botChat := bot.SenderChat{
 		ID: resp.ChannelID,
 	}
-	if update.Message.SenderChat != nil {
-		botChat.UserName = update.Message.SenderChat.UserName
+	if tbMsg.SenderChat != nil {
+		botChat.UserName = tbMsg.SenderChat.UserName
 	}
 	// if not set, that means the ban comes from superuser and username should be taken from ReplyToMessage
-	if botChat.UserName == "" && update.Message.ReplyToMessage.SenderChat != nil {
-		botChat.UserName = update.Message.ReplyToMessage.SenderChat.UserName
+	if botChat.UserName == "" && tbMsg.ReplyToMessage != nil && tbMsg.ReplyToMessage.SenderChat != nil {
+		botChat.UserName = tbMsg.ReplyToMessage.SenderChat.UserName
 	}
 	return fmt.Sprintf("%v", botChat)
 }
 
-func (l *TelegramListener) botActivityBan(resp bot.Response, msg bot.Message, fromChat, fromID int64) bool {
-	if !resp.Send {
+func (l *TelegramListener) botActivityBan(ctx context.Context, chat *Chat, resps []bot.Response, msg bot.Message, fromChat, fromID int64) bool {
+	if len(resps) == 0 {
 		return false
 	}
 
-	if l.SuperUsers.IsSuper(resp.User.Username) {
-		return false
+	for _, resp := range resps {
+		if chat.SuperUsers.IsSuper(resp.User.Username) {
+			return false
+		}
 	}
 
 	// check for bot-activity ban for given users
-	if b := l.BotsActivityTerm.check(msg.From, msg.SenderChat, msg.Sent, fromChat); b.active {
+	b := chat.BotsActivityTerm.check(msg.From, msg.SenderChat, msg.Sent, fromChat)
+	if b.active {
 		if b.new {
-			if err := l.applyBan(msg, l.BotsActivityTerm.BanDuration, fromChat, fromID); err != nil {
+			if err := l.applyBan(ctx, msg, b.duration, fromChat, fromID, "слишком много запросов к ботам"); err != nil {
 				log.Printf("[ERROR] can't ban on bot activity for given user, %v", err)
 			}
 		}
 		return true
 	}
+	warned := b.warn
 
 	// check for bot-activity ban for all users
-	if b := l.OverallBotActivityTerm.check(bot.User{}, bot.SenderChat{}, msg.Sent, fromChat); b.active {
+	b = chat.OverallBotActivityTerm.check(bot.User{}, bot.SenderChat{}, msg.Sent, fromChat)
+	if b.active {
 		if b.new {
-			if err := l.applyBan(msg, l.BotsActivityTerm.BanDuration, fromChat, fromID); err != nil {
+			if err := l.applyBan(ctx, msg, b.duration, fromChat, fromID, "слишком много ответов ботов"); err != nil {
 				log.Printf("[ERROR] can't ban on bot activity for all users, %v", err)
 			}
 		}
 		return true
 	}
 
+	if warned || b.warn {
+		l.warn(ctx, msg, fromChat)
+	}
 	return false
 }
 
-// sendBotResponse sends bot's answer to tg channel and saves it to log
-func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) error {
+// warn sends a warning to the user exceeded activity limit, the warning deleted after warningTTL
+func (l *TelegramListener) warn(ctx context.Context, msg bot.Message, chatID int64) {
+	mention := "@" + msg.From.Username
+	if msg.From.Username == "" {
+		mention = msg.From.DisplayName
+	}
+	resp := bot.Response{Send: true, ReplyTo: msg.ID, TTL: warningTTL,
+		Text: format.Markdown(format.Text(mention+" "), format.Italic(format.Text("не так быстро, ещё немного и бан")))}
+	l.sendBotResponse(ctx, resp, chatID)
+}
+
+// sendBotResponse queues bot's answer to the chat's outbox and returns immediately, so waiting for telegram
+// limits doesn't block processing of updates. Responses to the chat sent in order of arrival and saved to log,
+// failures logged. The message sent earlier is edited instead, if requested. Text too long for a single message
+// sent in several ones. The message to delete is deleted right away, not waiting for the queue.
+func (l *TelegramListener) sendBotResponse(ctx context.Context, resp bot.Response, chatID int64) {
 	if !resp.Send {
-		return nil
+		return
 	}
 
-	log.Printf("[DEBUG] bot response - %+v, pin: %t, reply-to:%d, parse-mode:%s", resp.Text, resp.Pin, resp.ReplyTo, resp.ParseMode)
-	tbMsg := tbapi.NewMessage(chatID, resp.Text)
-	tbMsg.ParseMode = tbapi.ModeMarkdown
-	if resp.ParseMode != "" {
-		tbMsg.ParseMode = resp.ParseMode
+	if resp.DeleteID != 0 {
+		l.out.RequestAsync(ctx, tbapi.NewDeleteMessage(chatID, resp.DeleteID), fmt.Sprintf("delete message %d", resp.DeleteID))
+		if resp.Text == "" { // deletion only
+			return
+		}
 	}
-	tbMsg.DisableWebPagePreview = !resp.Preview
-	tbMsg.ReplyToMessageID = resp.ReplyTo
-	res, err := l.TbAPI.Send(tbMsg)
+
+	l.out.Go(chatID, func() {
+		for _, part := range splitResponse(resp) {
+			if err := l.sendMessage(ctx, part, chatID); err != nil {
+				log.Printf("[WARN] failed to respond in chat %d, %v", chatID, err)
+				return
+			}
+		}
+	})
+}
+
+// sendMessage sends the response fitting a single message, pins or unpins it if requested
+func (l *TelegramListener) sendMessage(ctx context.Context, resp bot.Response, chatID int64) error {
+	log.Printf("[DEBUG] bot response - %+v, pin: %t, reply-to:%d, parse-mode:%s", resp.Text, resp.Pin, resp.ReplyTo, resp.ParseMode)
+	res, err := l.send(ctx, resp, chatID)
 	if err != nil {
 		return fmt.Errorf("can't send message to telegram %q: %w", resp.Text, err)
 	}
 
 	l.saveBotMessage(&res, chatID)
+	if resp.TTL > 0 {
+		l.deleteLater(chatID, res.MessageID, resp.TTL)
+	}
 
 	if resp.Pin {
-		_, err = l.TbAPI.Request(tbapi.PinChatMessageConfig{ChatID: chatID, MessageID: res.MessageID, DisableNotification: true})
+		_, err = l.out.Request(ctx, tbapi.PinChatMessageConfig{ChatID: chatID, MessageID: res.MessageID, DisableNotification: true})
 		if err != nil {
 			return fmt.Errorf("can't pin message to telegram: %w", err)
 		}
 	}
 
 	if resp.Unpin {
-		_, err = l.TbAPI.Request(tbapi.UnpinChatMessageConfig{ChatID: chatID})
+		_, err = l.out.Request(ctx, tbapi.UnpinChatMessageConfig{ChatID: chatID})
 		if err != nil {
 			return fmt.Errorf("can't unpin message to telegram: %w", err)
 		}
@@ -250,13 +654,75 @@ func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) erro
 	return nil
 }
 
-// bans user or a channel
-func (l *TelegramListener) applyBan(msg bot.Message, duration time.Duration, chatID, userID int64) error {
+// send sends response as a new message or edits the bot's message, if requested and known.
+// Text with formatting rejected by telegram sent again as plain text, not to lose the message.
+func (l *TelegramListener) send(ctx context.Context, resp bot.Response, chatID int64) (tbapi.Message, error) {
+	parseMode := defaultParseMode
+	if resp.ParseMode != "" {
+		parseMode = resp.ParseMode
+	}
+
+	res, err := l.sendAs(ctx, resp, chatID, parseMode)
+	if isParseError(err) {
+		log.Printf("[WARN] can't parse entities of %q, sending as plain text, %v", resp.Text, err)
+		resp.Text = plainText(resp.Text, parseMode)
+		return l.sendAs(ctx, resp, chatID, "")
+	}
+	return res, err
+}
+
+// sendAs sends response with given parse mode. Ids of messages sent with keys kept to edit them later.
+func (l *TelegramListener) sendAs(ctx context.Context, resp bot.Response, chatID int64, parseMode string) (tbapi.Message, error) {
+	editID := resp.EditID
+	if resp.Edit && resp.Key != "" {
+		l.mu.Lock()
+		editID = l.sent[chatID][resp.Key] // sent as a new message if not known, i.e. after restart
+		l.mu.Unlock()
+	}
+	if editID != 0 {
+		edit := tbapi.NewEditMessageText(chatID, editID, resp.Text)
+		edit.ParseMode = parseMode
+		edit.DisableWebPagePreview = !resp.Preview
+		if len(resp.Buttons) > 0 {
+			kb := inlineKeyboard(resp.Buttons)
+			edit.ReplyMarkup = &kb
+		}
+		return l.out.Send(ctx, chatID, edit)
+	}
+
+	tbMsg := tbapi.NewMessage(chatID, resp.Text)
+	tbMsg.ParseMode = parseMode
+	tbMsg.DisableWebPagePreview = !resp.Preview
+	tbMsg.ReplyToMessageID = resp.ReplyTo
+	if len(resp.Buttons) > 0 {
+		tbMsg.ReplyMarkup = inlineKeyboard(resp.Buttons)
+	}
+	res, err := l.out.Send(ctx, chatID, tbMsg)
+	if err != nil {
+		return res, err
+	}
+	if resp.Key != "" {
+		l.mu.Lock()
+		if l.sent == nil {
+			l.sent = map[int64]map[string]int{}
+		}
+		if l.sent[chatID] == nil {
+			l.sent[chatID] = map[string]int{}
+		}
+		l.sent[chatID][resp.Key] = res.MessageID
+		l.mu.Unlock()
+	}
+	return res, nil
+}
+
+// bans user or a channel for too much activity, the ban recorded in history with the reason
+func (l *TelegramListener) applyBan(ctx context.Context, msg bot.Message, duration time.Duration, chatID, userID int64,
+	reason string) error {
 	mention := "@" + msg.From.Username
 	if msg.From.Username == "" {
 		mention = msg.From.DisplayName
 	}
-	m := fmt.Sprintf("%s _тебя слишком много, отдохни..._", bot.EscapeMarkDownV1Text(mention))
+	m := format.Markdown(format.Text(mention+" "), format.Italic(format.Text("тебя слишком много, отдохни...")))
 	banUserStr := fmt.Sprintf("%v", msg.From)
 	var channelID int64
 	// This userID is a bot which means that message was sent on behalf of the channel
@@ -265,16 +731,24 @@ func (l *TelegramListener) applyBan(msg bot.Message, duration time.Duration, cha
 		channelID = msg.SenderChat.ID
 		mention = "@" + msg.SenderChat.UserName
 		banUserStr = fmt.Sprintf("%v", msg.SenderChat)
-		m = fmt.Sprintf("%s _пал смертью храбрых, заблокирован навечно..._", bot.EscapeMarkDownV1Text(mention))
+		m = format.Markdown(format.Text(mention+" "), format.Italic(format.Text("пал смертью храбрых, заблокирован навечно...")))
 	}
 
-	if err := l.sendBotResponse(bot.Response{Text: m, Send: true}, chatID); err != nil {
-		return fmt.Errorf("failed to send ban message for %v: %w", msg.From, err)
+	resp := bot.Response{Text: m, Send: true, Buttons: [][]bot.Button{unbanButton(userID, channelID)}}
+	if channelID == 0 {
+		resp.TTL = duration // notice is not needed after the ban
 	}
+	l.sendBotResponse(ctx, resp, chatID)
 	err := l.banUserOrChannel(duration, chatID, userID, channelID)
 	if err != nil {
 		return fmt.Errorf("failed to ban user %s: %w", banUserStr, err)
 	}
+	rec := banRecord{ChatID: chatID, User: msg.From, ChannelID: channelID, By: byTerminator, Reason: reason,
+		Duration: duration}
+	if channelID != 0 {
+		rec.User, rec.Duration = bot.User{}, 0
+	}
+	l.bans.add(rec)
 	return nil
 }
 
@@ -285,7 +759,7 @@ func (l *TelegramListener) Submit(ctx context.Context, text string, pin bool) er
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
-	case l.msgs.ch <- bot.Response{Text: text, Pin: pin, Send: true, Preview: true}:
+	case l.msgs.ch <- bot.Response{Text: text, Pin: pin, Send: true, Preview: true, ParseMode: tbapi.ModeMarkdown}: // legacy markdown of rtjc
 	}
 	return nil
 }
@@ -305,7 +779,7 @@ func (l *TelegramListener) SubmitHTML(ctx context.Context, text string, pin bool
 }
 
 func (l *TelegramListener) getChatID(group string) (int64, error) {
-	chatID, err := strconv.ParseInt(l.Group, 10, 64)
+	chatID, err := strconv.ParseInt(group, 10, 64)
 	if err == nil {
 		return chatID, nil
 	}
@@ -319,33 +793,29 @@ func (l *TelegramListener) getChatID(group string) (int64, error) {
 }
 
 func (l *TelegramListener) saveBotMessage(msg *tbapi.Message, fromChat int64) {
-	if fromChat != l.chatID {
-		return
+	if c, managed := l.chat(fromChat); managed {
+		c.MsgLogger.Save(l.transform(msg))
 	}
-	l.MsgLogger.Save(l.transform(msg))
 }
 
 // The bot must be an administrator in the supergroup for this to work
 // and must have the appropriate admin rights.
 // If channel is provided, it is banned instead of provided user, permanently.
+// User's restriction is lifted explicitly at the end, see unbanExpired.
 func (l *TelegramListener) banUserOrChannel(duration time.Duration, chatID, userID, channelID int64) error {
 	// From Telegram Bot API documentation:
 	// > If user is restricted for more than 366 days or less than 30 seconds from the current time,
 	// > they are considered to be restricted forever
 	// Because the API query uses unix timestamp rather than "ban duration",
 	// you do not want to accidentally get into this 30-second window of a lifetime ban.
-	// In practice BanDuration is equal to ten minutes,
+	// In practice ban durations are minutes or longer,
 	// so this `if` statement is unlikely to be evaluated to true.
 	if duration < 30*time.Second {
 		duration = 1 * time.Minute
 	}
 
 	if channelID != 0 {
-		resp, err := l.TbAPI.Request(tbapi.BanChatSenderChatConfig{
-			ChatID:       chatID,
-			SenderChatID: channelID,
-			UntilDate:    int(time.Now().Add(duration).Unix()),
-		})
+		resp, err := l.TbAPI.Request(tbapi.BanChatSenderChatConfig{ChatID: chatID, SenderChatID: channelID})
 		if err != nil {
 			return err
 		}
@@ -355,12 +825,13 @@ func (l *TelegramListener) banUserOrChannel(duration time.Duration, chatID, user
 		return nil
 	}
 
+	until := time.Now().Add(duration)
 	resp, err := l.TbAPI.Request(tbapi.RestrictChatMemberConfig{
 		ChatMemberConfig: tbapi.ChatMemberConfig{
 			ChatID: chatID,
 			UserID: userID,
 		},
-		UntilDate: time.Now().Add(duration).Unix(),
+		UntilDate: until.Unix(), // lifted by telegram as well, if the bot is down at the end
 		Permissions: &tbapi.ChatPermissions{
 			CanSendMessages:       false,
 			CanSendMediaMessages:  false,
@@ -374,15 +845,87 @@ func (l *TelegramListener) banUserOrChannel(duration time.Duration, chatID, user
 	if !resp.Ok {
 		return fmt.Errorf("response is not Ok: %v", string(resp.Result))
 	}
+	l.scheduleUnban(chatID, userID, until)
+	return nil
+}
 
+// kickUser bans the user in the chat till unban, the user removed from the chat and can't join it again
+func (l *TelegramListener) kickUser(chatID, userID int64) error {
+	resp, err := l.TbAPI.Request(tbapi.KickChatMemberConfig{ChatMemberConfig: tbapi.ChatMemberConfig{ChatID: chatID, UserID: userID}})
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("response is not Ok: %v", string(resp.Result))
+	}
+	return nil
+}
+
+// unkickUser lifts the ban made by kickUser, so the user can join the chat again. Does nothing for chat members
+func (l *TelegramListener) unkickUser(chatID, userID int64) error {
+	resp, err := l.TbAPI.Request(tbapi.UnbanChatMemberConfig{ChatMemberConfig: tbapi.ChatMemberConfig{ChatID: chatID, UserID: userID},
+		OnlyIfBanned: true})
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("response is not Ok: %v", string(resp.Result))
+	}
 	return nil
 }
 
+// unbanUserOrChannel lifts restrictions of the user or unbans the channel, if channelID set
+func (l *TelegramListener) unbanUserOrChannel(chatID, userID, channelID int64) error {
+	var req tbapi.Chattable = tbapi.RestrictChatMemberConfig{
+		ChatMemberConfig: tbapi.ChatMemberConfig{
+			ChatID: chatID,
+			UserID: userID,
+		},
+		Permissions: &tbapi.ChatPermissions{
+			CanSendMessages:       true,
+			CanSendMediaMessages:  true,
+			CanSendPolls:          true,
+			CanSendOtherMessages:  true,
+			CanAddWebPagePreviews: true,
+		},
+	}
+	if channelID != 0 {
+		req = tbapi.UnbanChatSenderChatConfig{ChatID: chatID, SenderChatID: channelID}
+	}
+
+	resp, err := l.TbAPI.Request(req)
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("response is not Ok: %v", string(resp.Result))
+	}
+	return nil
+}
+
+// inlineKeyboard makes telegram inline keyboard with rows of buttons
+func inlineKeyboard(buttons [][]bot.Button) tbapi.InlineKeyboardMarkup {
+	rows := make([][]tbapi.InlineKeyboardButton, 0, len(buttons))
+	for _, row := range buttons {
+		r := make([]tbapi.InlineKeyboardButton, 0, len(row))
+		for _, b := range row {
+			if b.URL != "" {
+				r = append(r, tbapi.NewInlineKeyboardButtonURL(b.Text, b.URL))
+				continue
+			}
+			r = append(r, tbapi.NewInlineKeyboardButtonData(b.Text, b.Data))
+		}
+		rows = append(rows, r)
+	}
+	return tbapi.NewInlineKeyboardMarkup(rows...)
+}
+
 func (l *TelegramListener) transform(msg *tbapi.Message) *bot.Message {
 	message := bot.Message{
-		ID:   msg.MessageID,
-		Sent: msg.Time(),
-		Text: msg.Text,
+		ID:     msg.MessageID,
+		Sent:   msg.Time(),
+		Text:   msg.Text,
+		Edited: msg.EditDate != 0,
 	}
 
 	if msg.Chat != nil {
@@ -404,6 +947,18 @@ func (l *TelegramListener) transform(msg *tbapi.Message) *bot.Message {
 		}
 	}
 
+	if msg.ForwardFromChat != nil {
+		message.Forwarded = &bot.SenderChat{
+			ID:       msg.ForwardFromChat.ID,
+			UserName: msg.ForwardFromChat.UserName,
+		}
+	}
+
+	for _, u := range msg.NewChatMembers {
+		message.Joined = append(message.Joined, bot.User{ID: u.ID, Username: u.UserName,
+			DisplayName: u.FirstName + " " + u.LastName})
+	}
+
 	switch {
 	case msg.Entities != nil && len(msg.Entities) > 0:
 		message.Entities = l.transformEntities(msg.Entities)
@@ -2,18 +2,21 @@ package events
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/events/mocks"
 )
 
 func TestTelegramListener_DoNoBots(t *testing.T) {
-	msgLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
-	tbAPI := &tbAPIMock{GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 		return tbapi.Chat{ID: 123}, nil
 	}}
 	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
@@ -63,8 +66,8 @@ func TestTelegramListener_DoNoBots(t *testing.T) {
 }
 
 func TestTelegramListener_DoWithBots(t *testing.T) {
-	msgLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
-	tbAPI := &tbAPIMock{
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
 		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 			return tbapi.Chat{ID: 123}, nil
 		},
@@ -115,8 +118,8 @@ func TestTelegramListener_DoWithBots(t *testing.T) {
 }
 
 func TestTelegramListener_DoWithRtjc(t *testing.T) {
-	msgLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
-	tbAPI := &tbAPIMock{
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
 		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 			return tbapi.Chat{ID: 123}, nil
 		},
@@ -160,10 +163,10 @@ func TestTelegramListener_DoWithRtjc(t *testing.T) {
 }
 
 func TestTelegramListener_DoWithAutoBan(t *testing.T) {
-	msgLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
 	firstReq := true
 	firstSend := true
-	tbAPI := &tbAPIMock{
+	tbAPI := &mocks.TbAPI{
 		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 			return tbapi.Chat{ID: 123}, nil
 		},
@@ -192,9 +195,9 @@ func TestTelegramListener_DoWithAutoBan(t *testing.T) {
 		Bots:      bots,
 		Group:     "gr",
 		AllActivityTerm: Terminator{
-			BanDuration:   100 * time.Millisecond,
-			BanPenalty:    3,
-			AllowedPeriod: 1 * time.Second,
+			Messages:     3,
+			Window:       1 * time.Second,
+			BanDurations: []time.Duration{100 * time.Millisecond},
 		},
 	}
 
@@ -226,14 +229,14 @@ func TestTelegramListener_DoWithAutoBan(t *testing.T) {
 		assert.EqualError(t, err, "telegram update chan closed")
 
 		assert.Equal(t, 1, len(tbAPI.SendCalls()))
-		assert.Equal(t, "@user\\_name _тебя слишком много, отдохни..._", tbAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+		assert.Equal(t, "@user\\_name _тебя слишком много, отдохни\\.\\.\\._", tbAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
 		assert.Equal(t, 1, len(tbAPI.RequestCalls()))
 		assert.Equal(t, int64(123), tbAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).ChatID)
 		assert.Equal(t, 6, len(msgLogger.SaveCalls()))
 		assert.Equal(t, "text 123", msgLogger.SaveCalls()[0].Msg.Text)
 		assert.Equal(t, "user_name", msgLogger.SaveCalls()[0].Msg.From.Username)
 		assert.Equal(t, "user_name", msgLogger.SaveCalls()[5].Msg.From.Username)
-		assert.Equal(t, "@user\\_name _тебя слишком много, отдохни..._", msgLogger.SaveCalls()[4].Msg.Text)
+		assert.Contains(t, savedTexts(msgLogger), "@user\\_name _тебя слишком много, отдохни\\.\\.\\._", "bot's message logged when sent")
 	})
 
 	t.Run("test for channel", func(t *testing.T) {
@@ -264,21 +267,20 @@ func TestTelegramListener_DoWithAutoBan(t *testing.T) {
 		assert.EqualError(t, err, "telegram update chan closed")
 
 		assert.Equal(t, 2, len(tbAPI.SendCalls()))
-		assert.Equal(t, "@test\\_bot _пал смертью храбрых, заблокирован навечно..._", tbAPI.SendCalls()[1].C.(tbapi.MessageConfig).Text)
+		assert.Equal(t, "@test\\_bot _пал смертью храбрых, заблокирован навечно\\.\\.\\._", tbAPI.SendCalls()[1].C.(tbapi.MessageConfig).Text)
 		assert.Equal(t, 2, len(tbAPI.RequestCalls()))
 		assert.Equal(t, int64(123), tbAPI.RequestCalls()[1].C.(tbapi.BanChatSenderChatConfig).ChatID)
 		assert.Equal(t, int64(12345), tbAPI.RequestCalls()[1].C.(tbapi.BanChatSenderChatConfig).SenderChatID)
 		assert.Equal(t, 12, len(msgLogger.SaveCalls()))
 		assert.Equal(t, "text 321", msgLogger.SaveCalls()[6].Msg.Text)
 		assert.Equal(t, "ChannelBot", msgLogger.SaveCalls()[6].Msg.From.Username)
-		assert.Equal(t, "user_name", msgLogger.SaveCalls()[10].Msg.From.Username)
-		assert.Equal(t, "@test\\_bot _пал смертью храбрых, заблокирован навечно..._", msgLogger.SaveCalls()[10].Msg.Text)
+		assert.Contains(t, savedTexts(msgLogger), "@test\\_bot _пал смертью храбрых, заблокирован навечно\\.\\.\\._", "bot's message logged when sent")
 	})
 }
 
 func TestTelegramListener_DoWithBotsActivityBan(t *testing.T) {
-	msgLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
-	tbAPI := &tbAPIMock{
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
 		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 			return tbapi.Chat{ID: 123}, nil
 		},
@@ -299,14 +301,14 @@ func TestTelegramListener_DoWithBotsActivityBan(t *testing.T) {
 		Bots:      bots,
 		Group:     "gr",
 		AllActivityTerm: Terminator{
-			BanDuration:   100 * time.Millisecond,
-			BanPenalty:    6,
-			AllowedPeriod: 1 * time.Second,
+			Messages:     6,
+			Window:       1 * time.Second,
+			BanDurations: []time.Duration{100 * time.Millisecond},
 		},
 		BotsActivityTerm: Terminator{
-			BanDuration:   100 * time.Millisecond,
-			BanPenalty:    3,
-			AllowedPeriod: 1 * time.Second,
+			Messages:     3,
+			Window:       1 * time.Second,
+			BanDurations: []time.Duration{100 * time.Millisecond},
 		},
 	}
 
@@ -337,20 +339,75 @@ func TestTelegramListener_DoWithBotsActivityBan(t *testing.T) {
 	assert.EqualError(t, err, "telegram update chan closed")
 
 	assert.Equal(t, 4, len(tbAPI.SendCalls()))
-	assert.Equal(t, "@user\\_name _тебя слишком много, отдохни..._", tbAPI.SendCalls()[3].C.(tbapi.MessageConfig).Text)
-	assert.Equal(t, 3, len(tbAPI.RequestCalls()))
-	assert.Equal(t, int64(123), tbAPI.RequestCalls()[2].C.(tbapi.RestrictChatMemberConfig).ChatID)
+	assert.Equal(t, "@user\\_name _тебя слишком много, отдохни\\.\\.\\._", tbAPI.SendCalls()[3].C.(tbapi.MessageConfig).Text)
+	assert.Equal(t, 1, len(tbAPI.RequestCalls()))
+	assert.Equal(t, int64(123), tbAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).ChatID)
 	assert.Equal(t, 9, len(msgLogger.SaveCalls()))
 	assert.Equal(t, "text 123", msgLogger.SaveCalls()[0].Msg.Text)
 	assert.Equal(t, "user_name", msgLogger.SaveCalls()[0].Msg.From.Username)
 	assert.Equal(t, "user_name", msgLogger.SaveCalls()[8].Msg.From.Username)
-	assert.Equal(t, "@user\\_name _тебя слишком много, отдохни..._", msgLogger.SaveCalls()[5].Msg.Text)
-	assert.Equal(t, "@user\\_name _тебя слишком много, отдохни..._", msgLogger.SaveCalls()[7].Msg.Text)
+	assert.Contains(t, savedTexts(msgLogger), "@user\\_name _тебя слишком много, отдохни\\.\\.\\._", "bot's message logged when sent")
+}
+
+func TestTelegramListener_DoWithActivityWarning(t *testing.T) {
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	msgID := 100
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			msgID++
+			return tbapi.Message{MessageID: msgID, Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "user_name", ID: 1}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		return bot.Response{}
+	}}
+
+	l := TelegramListener{
+		MsgLogger: msgLogger,
+		TbAPI:     tbAPI,
+		Bots:      bots,
+		Group:     "gr",
+		AllActivityTerm: Terminator{
+			Messages:     2,
+			Window:       time.Minute,
+			Warnings:     1,
+			BanDurations: []time.Duration{time.Minute},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 6)
+	for i := 0; i < 6; i++ {
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: i + 1, Chat: &tbapi.Chat{ID: 123}, Text: "text",
+			From: &tbapi.User{UserName: "user_name", ID: 1}, Date: int(time.Now().Unix())}}
+	}
+	close(updChan)
+	tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Equal(t, 2, len(tbAPI.SendCalls()))
+	warning := tbAPI.SendCalls()[0].C.(tbapi.MessageConfig)
+	assert.Equal(t, "@user\\_name _не так быстро, ещё немного и бан_", warning.Text)
+	assert.Equal(t, 3, warning.ReplyToMessageID)
+	assert.Equal(t, "@user\\_name _тебя слишком много, отдохни\\.\\.\\._", tbAPI.SendCalls()[1].C.(tbapi.MessageConfig).Text)
+	require.Equal(t, 1, len(tbAPI.RequestCalls()))
+	assert.Equal(t, int64(123), tbAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).ChatID)
+	assert.Len(t, l.pending, 2, "warning and ban notice deleted later")
 }
 
 func TestTelegramListener_DoWithAllActivityBan(t *testing.T) {
-	msgLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
-	tbAPI := &tbAPIMock{
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
 		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 			return tbapi.Chat{ID: 123}, nil
 		},
@@ -371,14 +428,14 @@ func TestTelegramListener_DoWithAllActivityBan(t *testing.T) {
 		Bots:      bots,
 		Group:     "gr",
 		AllActivityTerm: Terminator{
-			BanDuration:   100 * time.Millisecond,
-			BanPenalty:    6,
-			AllowedPeriod: 1 * time.Second,
+			Messages:     6,
+			Window:       1 * time.Second,
+			BanDurations: []time.Duration{100 * time.Millisecond},
 		},
 		OverallBotActivityTerm: Terminator{
-			BanDuration:   100 * time.Millisecond,
-			BanPenalty:    3,
-			AllowedPeriod: 1 * time.Second,
+			Messages:     3,
+			Window:       1 * time.Second,
+			BanDurations: []time.Duration{100 * time.Millisecond},
 		},
 	}
 
@@ -408,20 +465,119 @@ func TestTelegramListener_DoWithAllActivityBan(t *testing.T) {
 	err := l.Do(ctx)
 	assert.EqualError(t, err, "telegram update chan closed")
 
-	assert.Equal(t, 5, len(tbAPI.SendCalls()))
-	assert.Equal(t, "@user\\_name _тебя слишком много, отдохни..._", tbAPI.SendCalls()[4].C.(tbapi.MessageConfig).Text)
-	assert.Equal(t, 4, len(tbAPI.RequestCalls()))
-	assert.Equal(t, int64(123), tbAPI.RequestCalls()[3].C.(tbapi.RestrictChatMemberConfig).ChatID)
-	assert.Equal(t, 10, len(msgLogger.SaveCalls()))
+	assert.Equal(t, 4, len(tbAPI.SendCalls()))
+	assert.Equal(t, "@user\\_name _тебя слишком много, отдохни\\.\\.\\._", tbAPI.SendCalls()[3].C.(tbapi.MessageConfig).Text)
+	assert.Equal(t, 1, len(tbAPI.RequestCalls()))
+	assert.Equal(t, int64(123), tbAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).ChatID)
+	assert.Equal(t, 9, len(msgLogger.SaveCalls()))
 	assert.Equal(t, "text 123", msgLogger.SaveCalls()[0].Msg.Text)
 	assert.Equal(t, "user_name", msgLogger.SaveCalls()[0].Msg.From.Username)
-	assert.Equal(t, "user_name", msgLogger.SaveCalls()[9].Msg.From.Username)
-	assert.Equal(t, "@user\\_name _тебя слишком много, отдохни..._", msgLogger.SaveCalls()[9].Msg.Text)
+	assert.Equal(t, "user_name", msgLogger.SaveCalls()[8].Msg.From.Username)
+	assert.Contains(t, savedTexts(msgLogger), "@user\\_name _тебя слишком много, отдохни\\.\\.\\._", "bot's message logged when sent")
+}
+
+func TestTelegramListener_DoWithEscalatedBan(t *testing.T) {
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		return bot.Response{Send: true, Text: "banned", BanInterval: time.Hour, BanReason: "spam", Escalate: true,
+			User: bot.User{Username: "user", ID: 1}}
+	}}
+	l := TelegramListener{MsgLogger: msgLogger, TbAPI: tbAPI, Bots: bots, Group: "gr"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 2)
+	for i := 0; i < 2; i++ {
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: i + 1, Chat: &tbapi.Chat{ID: 123}, Text: "spam",
+			From: &tbapi.User{UserName: "user", ID: 1}, Date: int(time.Now().Unix())}}
+	}
+	close(updChan)
+	tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Equal(t, 2, len(tbAPI.SendCalls()))
+	assert.Equal(t, "banned", tbAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	assert.Equal(t, "banned\n_не в первый раз, бан на 2ч_", tbAPI.SendCalls()[1].C.(tbapi.MessageConfig).Text)
+	require.Equal(t, 2, len(tbAPI.RequestCalls()))
+	first := tbAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig)
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), first.UntilDate, 5)
+	second := tbAPI.RequestCalls()[1].C.(tbapi.RestrictChatMemberConfig)
+	assert.InDelta(t, time.Now().Add(2*time.Hour).Unix(), second.UntilDate, 5)
+
+	bans := l.Bans(123)
+	assert.Contains(t, bans, "*активные баны:*\n@user до ")
+	assert.Contains(t, bans, "@user на 2ч \\(spam, бот\\)\n")
+	assert.Contains(t, bans, "@user на 1ч \\(spam, бот\\)\n")
+}
+
+func TestTelegramListener_DoWithAdminBan(t *testing.T) {
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	su := SuperUser{"admin"}
+	l := TelegramListener{MsgLogger: &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}, TbAPI: tbAPI,
+		Bots: bot.NewBanhammer(su, 10, nil), Group: "gr", SuperUsers: su}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 3)
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123}, Text: "spam",
+		From: &tbapi.User{UserName: "user", ID: 1}, Date: int(time.Now().Unix())}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 2, Chat: &tbapi.Chat{ID: 123}, Text: "ban! user",
+		From: &tbapi.User{UserName: "admin", ID: 2}, Date: int(time.Now().Unix())}}
+	tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	go func() {
+		assert.Eventually(t, func() bool { return len(tbAPI.RequestCalls()) == 1 }, time.Second, 5*time.Millisecond)
+		assert.Equal(t, int64(1), tbAPI.RequestCalls()[0].C.(tbapi.KickChatMemberConfig).UserID, "kicked by listener")
+		assert.Contains(t, l.Bans(123), "*активные баны:*\n@user навсегда ")
+		assert.Contains(t, l.Bans(123), "\\(бан админом, @admin\\)\n", "admin's ban kept in history")
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 3, Chat: &tbapi.Chat{ID: 123}, Text: "unban! user",
+			From: &tbapi.User{UserName: "admin", ID: 2}, Date: int(time.Now().Unix())}}
+		close(updChan)
+	}()
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Equal(t, 2, len(tbAPI.SendCalls()))
+	assert.Equal(t, "прощай user", tbAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	assert.Equal(t, "амнистия для user", tbAPI.SendCalls()[1].C.(tbapi.MessageConfig).Text)
+	require.Equal(t, 2, len(tbAPI.RequestCalls()))
+	unban := tbAPI.RequestCalls()[1].C.(tbapi.UnbanChatMemberConfig)
+	assert.Equal(t, int64(1), unban.UserID, "unbanned by listener")
+	assert.True(t, unban.OnlyIfBanned, "not removed from the chat if rejoined somehow")
+	assert.Empty(t, l.restrictions, "no scheduled unban for kicked user")
+	assert.NotContains(t, l.Bans(123), "активные баны")
+	assert.Contains(t, l.Bans(123), "\\(бан админом, @admin\\), снят @admin\n", "unban kept in history")
 }
 
 func TestTelegramListener_DoWithBotBan(t *testing.T) {
-	msgLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
-	tbAPI := &tbAPIMock{
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
 		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 			return tbapi.Chat{ID: 123}, nil
 		},
@@ -453,8 +609,8 @@ func TestTelegramListener_DoWithBotBan(t *testing.T) {
 		SuperUsers: SuperUser{"admin"},
 		Group:      "gr",
 		OverallBotActivityTerm: Terminator{
-			AllowedPeriod: 1 * time.Second, // to prevent second bot being banned for all activity
-			BanPenalty:    1,
+			Messages: 1,
+			Window:   1 * time.Second, // to prevent second bot being banned for all activity
 		},
 	}
 
@@ -556,9 +712,9 @@ func TestTelegramListener_DoWithBotBan(t *testing.T) {
 }
 
 func TestTelegramListener_DoPinMessages(t *testing.T) {
-	msgLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
 
-	tbAPI := &tbAPIMock{
+	tbAPI := &mocks.TbAPI{
 		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 			return tbapi.Chat{ID: 123}, nil
 		},
@@ -612,10 +768,99 @@ func TestTelegramListener_DoPinMessages(t *testing.T) {
 	assert.Equal(t, 456, tbAPI.RequestCalls()[0].C.(tbapi.PinChatMessageConfig).MessageID)
 }
 
+func TestTelegramListener_DoWithMultipleResponses(t *testing.T) {
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	msgID := 0
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			msgID++
+			return tbapi.Message{MessageID: msgID, Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "bot"}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	b1 := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		return bot.Response{Send: true, Text: "<b>html answer</b>", ParseMode: tbapi.ModeHTML, ReplyTo: msg.ID}
+	}}
+	b2 := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		return bot.Response{Send: true, Text: "*md answer*", Pin: true}
+	}}
+
+	l := TelegramListener{
+		MsgLogger: msgLogger,
+		TbAPI:     tbAPI,
+		Bots:      bot.MultiBot{Bots: []bot.Interface{b1, b2}},
+		Group:     "gr",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 1)
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 42, Chat: &tbapi.Chat{ID: 123}, Text: "text 123",
+		From: &tbapi.User{UserName: "user"}}}
+	close(updChan)
+	tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Equal(t, 2, len(tbAPI.SendCalls()))
+
+	first := tbAPI.SendCalls()[0].C.(tbapi.MessageConfig)
+	assert.Equal(t, "<b>html answer</b>", first.Text)
+	assert.Equal(t, tbapi.ModeHTML, first.ParseMode)
+	assert.Equal(t, 42, first.ReplyToMessageID)
+
+	second := tbAPI.SendCalls()[1].C.(tbapi.MessageConfig)
+	assert.Equal(t, "*md answer*", second.Text)
+	assert.Equal(t, tbapi.ModeMarkdownV2, second.ParseMode)
+	assert.Equal(t, 0, second.ReplyToMessageID)
+
+	require.Equal(t, 2, len(tbAPI.RequestCalls()))
+	menu := tbAPI.RequestCalls()[0].C.(tbapi.SetMyCommandsConfig)
+	assert.Equal(t, []tbapi.BotCommand{{Command: "help", Description: "список команд"}}, menu.Commands)
+	assert.Equal(t, 2, tbAPI.RequestCalls()[1].C.(tbapi.PinChatMessageConfig).MessageID, "only second message pinned")
+}
+
+func TestTelegramListener_DoRefreshMenu(t *testing.T) {
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) { return tbapi.Chat{ID: 123}, nil },
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	admin := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		if msg.Text == "bot! off news" {
+			return bot.Response{Send: true, Text: "бот news выключен", RefreshMenu: true}
+		}
+		return bot.Response{}
+	}}
+	l := TelegramListener{MsgLogger: &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}, TbAPI: tbAPI,
+		Bots: bot.MultiBot{Bots: []bot.Interface{admin}}, Group: "gr"}
+
+	updChan := make(chan tbapi.Update, 2)
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123}, Text: "hi",
+		From: &tbapi.User{UserName: "admin"}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 2, Chat: &tbapi.Chat{ID: 123}, Text: "bot! off news",
+		From: &tbapi.User{UserName: "admin"}}}
+	close(updChan)
+	tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(context.Background())
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Equal(t, 2, len(tbAPI.RequestCalls()), "menu set on start and after bot turned off")
+	assert.IsType(t, tbapi.SetMyCommandsConfig{}, tbAPI.RequestCalls()[0].C)
+	assert.IsType(t, tbapi.SetMyCommandsConfig{}, tbAPI.RequestCalls()[1].C)
+}
+
 func TestTelegramListener_DoUnpinMessages(t *testing.T) {
-	msgLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
 
-	tbAPI := &tbAPIMock{
+	tbAPI := &mocks.TbAPI{
 		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 			return tbapi.Chat{ID: 123}, nil
 		},
@@ -670,8 +915,8 @@ func TestTelegramListener_DoUnpinMessages(t *testing.T) {
 }
 
 func TestTelegramListener_DoNotSaveMessagesFromOtherChats(t *testing.T) {
-	msgLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
-	tbAPI := &tbAPIMock{
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
 		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
 			return tbapi.Chat{ID: 123}, nil
 		},
@@ -750,6 +995,30 @@ func TestTelegram_transformTextMessage(t *testing.T) {
 	)
 }
 
+func TestTelegram_transformForwarded(t *testing.T) {
+	l := TelegramListener{}
+	msg := l.transform(&tbapi.Message{
+		Chat:            &tbapi.Chat{ID: 123456},
+		From:            &tbapi.User{ID: 100000001, UserName: "username"},
+		MessageID:       30,
+		Text:            "Message",
+		ForwardFromChat: &tbapi.Chat{ID: -100123, UserName: "channel"},
+	})
+	assert.Equal(t, &bot.SenderChat{ID: -100123, UserName: "channel"}, msg.Forwarded)
+}
+
+func TestTelegram_transformJoined(t *testing.T) {
+	l := TelegramListener{}
+	msg := l.transform(&tbapi.Message{
+		Chat:           &tbapi.Chat{ID: 123456},
+		From:           &tbapi.User{ID: 100000001, UserName: "username"},
+		MessageID:      30,
+		NewChatMembers: []tbapi.User{{ID: 100000001, UserName: "username", FirstName: "First"}, {ID: 2, FirstName: "Invited", LastName: "User"}},
+	})
+	assert.Equal(t, []bot.User{{ID: 100000001, Username: "username", DisplayName: "First "},
+		{ID: 2, DisplayName: "Invited User"}}, msg.Joined)
+}
+
 func TestTelegram_transformPhoto(t *testing.T) {
 	l := TelegramListener{}
 	assert.Equal(
@@ -846,3 +1115,420 @@ func TestTelegram_transformEntities(t *testing.T) {
 		),
 	)
 }
+
+func TestTelegramListener_DoWithChats(t *testing.T) {
+	mainLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	teamLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			mc := c.(tbapi.MessageConfig)
+			return tbapi.Message{Text: mc.Text, Chat: &tbapi.Chat{ID: mc.ChatID}, From: &tbapi.User{UserName: "bot"}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	mainBots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		if msg.Text == "idle" {
+			return bot.Response{}
+		}
+		return bot.Response{Send: true, Text: "main: " + msg.Text}
+	}}
+	teamBot := &bot.InterfaceMock{
+		OnMessageFunc: func(msg bot.Message) bot.Response {
+			if msg.Text == "idle" {
+				return bot.Response{}
+			}
+			return bot.Response{Send: true, Text: "team: " + msg.Text}
+		},
+		HelpFunc: func() string { return "" },
+	}
+
+	team := &Chat{
+		Group:                  "456",
+		MsgLogger:              teamLogger,
+		Bots:                   bot.MultiBot{Bots: []bot.Interface{teamBot}},
+		SuperUsers:             SuperUser{"team_lead"},
+		AllActivityTerm:        Terminator{Messages: 2, Window: time.Minute, BanDurations: []time.Duration{time.Minute}},
+		BotsActivityTerm:       Terminator{Messages: 10, Window: time.Minute, BanDurations: []time.Duration{time.Minute}},
+		OverallBotActivityTerm: Terminator{Messages: 10, Window: time.Minute, BanDurations: []time.Duration{time.Minute}},
+	}
+	l := TelegramListener{
+		MsgLogger:              mainLogger,
+		TbAPI:                  tbAPI,
+		Bots:                   mainBots,
+		Group:                  "gr",
+		Chats:                  []*Chat{team},
+		AllActivityTerm:        Terminator{Messages: 10, Window: time.Minute, BanDurations: []time.Duration{time.Minute}},
+		BotsActivityTerm:       Terminator{Messages: 10, Window: time.Minute, BanDurations: []time.Duration{time.Minute}},
+		OverallBotActivityTerm: Terminator{Messages: 10, Window: time.Minute, BanDurations: []time.Duration{time.Minute}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
+	defer cancel()
+
+	msg := func(chatID int64, text, user string) tbapi.Update {
+		return tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: chatID}, Text: text,
+			From: &tbapi.User{UserName: user, ID: 1}, Date: int(time.Now().Unix())}}
+	}
+	updChan := make(chan tbapi.Update, 10)
+	updChan <- msg(123, "main msg", "user")
+	updChan <- msg(456, "team msg", "user")
+	updChan <- msg(789, "other msg", "user")
+	updChan <- msg(456, "team msg2", "user")
+	updChan <- msg(456, "team msg3", "user") // banned in team chat only
+	updChan <- msg(123, "main msg2", "user")
+	close(updChan)
+	tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Equal(t, 1, len(tbAPI.GetChatCalls()), "numeric group resolved without request")
+	texts := map[int64][]string{} // by chat, chats sent to independently
+	for _, c := range tbAPI.SendCalls() {
+		mc := c.C.(tbapi.MessageConfig)
+		texts[mc.ChatID] = append(texts[mc.ChatID], mc.Text)
+	}
+	assert.Equal(t, map[int64][]string{123: {"main: main msg", "main: main msg2"}, 789: {"main: other msg"},
+		456: {"team: team msg", "team: team msg2", "@user _тебя слишком много, отдохни\\.\\.\\._"}}, texts)
+
+	require.Equal(t, 2, len(tbAPI.RequestCalls()))
+	menu := tbAPI.RequestCalls()[0].C.(tbapi.SetMyCommandsConfig)
+	assert.Equal(t, &tbapi.BotCommandScope{Type: "chat", ChatID: 456}, menu.Scope)
+	assert.Equal(t, int64(456), tbAPI.RequestCalls()[1].C.(tbapi.RestrictChatMemberConfig).ChatID)
+
+	assert.Equal(t, 4, len(mainLogger.SaveCalls()), "main chat messages with answers, other chat not logged")
+	assert.Equal(t, 6, len(teamLogger.SaveCalls()), "team chat messages with answers and ban message")
+	assert.Equal(t, "team msg", teamLogger.SaveCalls()[0].Msg.Text)
+
+	assert.Contains(t, l.Status(456), "@user до ")
+	assert.Contains(t, l.Status(456), "\\(все сообщения\\)")
+	assert.NotContains(t, l.Status(123), "@user до ", "banned in team chat only")
+}
+
+func TestTelegramListener_DoIdleWithCleanup(t *testing.T) {
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "bot"}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+		GetUpdatesChanFunc: func(config tbapi.UpdateConfig) tbapi.UpdatesChannel {
+			return make(chan tbapi.Update) // quiet chat
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		if msg.Text == "idle" {
+			return bot.Response{Send: true, Text: "idle answer"}
+		}
+		return bot.Response{}
+	}}
+	l := TelegramListener{
+		MsgLogger:    &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}},
+		TbAPI:        tbAPI,
+		Bots:         bots,
+		Group:        "gr",
+		IdleDuration: 50 * time.Millisecond,
+		cleanupEvery: 10 * time.Millisecond, // ticks more often than idle timeout
+		pending:      map[string]pendingDeletion{"123:1": {ChatID: 123, MessageID: 1, At: time.Now()}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err := l.Do(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.GreaterOrEqual(t, len(tbAPI.SendCalls()), 3, "idle answers delivered in spite of cleanup")
+	assert.Equal(t, "idle answer", tbAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	require.Len(t, tbAPI.RequestCalls(), 1)
+	assert.Equal(t, tbapi.NewDeleteMessage(123, 1), tbAPI.RequestCalls()[0].C, "expired message deleted")
+	assert.Empty(t, l.pending)
+}
+
+func TestTelegramListener_DoWithEditsAndCallbacks(t *testing.T) {
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "bot"}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		switch {
+		case msg.Callback != nil:
+			return bot.Response{Send: true, Text: "pressed " + msg.Callback.Data}
+		case msg.Edited:
+			return bot.Response{Send: true, Text: "edited " + msg.Text}
+		}
+		return bot.Response{Send: true, Text: "new " + msg.Text}
+	}}
+
+	l := TelegramListener{
+		MsgLogger:              msgLogger,
+		TbAPI:                  tbAPI,
+		Bots:                   bots,
+		Group:                  "gr",
+		AllActivityTerm:        Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+		BotsActivityTerm:       Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+		OverallBotActivityTerm: Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 4)
+	updChan <- tbapi.Update{EditedMessage: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123}, Text: "wtf!",
+		EditDate: 1234567, From: &tbapi.User{UserName: "user"}}}
+	updChan <- tbapi.Update{ChannelPost: &tbapi.Message{MessageID: 2, Chat: &tbapi.Chat{ID: 123}, Text: "post",
+		SenderChat: &tbapi.Chat{ID: 456, UserName: "channel"}}}
+	updChan <- tbapi.Update{CallbackQuery: &tbapi.CallbackQuery{ID: "cb1", Data: "next", From: &tbapi.User{UserName: "user"},
+		Message: &tbapi.Message{MessageID: 3, Chat: &tbapi.Chat{ID: 123}}}}
+	updChan <- tbapi.Update{CallbackQuery: &tbapi.CallbackQuery{ID: "cb2", Data: "inline"}}
+	close(updChan)
+	tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Equal(t, 3, len(tbAPI.SendCalls()))
+	assert.Equal(t, "edited wtf!", tbAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	assert.Equal(t, "new post", tbAPI.SendCalls()[1].C.(tbapi.MessageConfig).Text)
+	assert.Equal(t, "pressed next", tbAPI.SendCalls()[2].C.(tbapi.MessageConfig).Text)
+
+	require.Equal(t, 2, len(tbAPI.RequestCalls()), "all callbacks answered")
+	assert.Equal(t, tbapi.NewCallback("cb1", ""), tbAPI.RequestCalls()[0].C)
+	assert.Equal(t, tbapi.NewCallback("cb2", ""), tbAPI.RequestCalls()[1].C)
+
+	require.Equal(t, 5, len(msgLogger.SaveCalls()), "edited message, channel post and 3 bot answers")
+	assert.Equal(t, "wtf!", msgLogger.SaveCalls()[0].Msg.Text)
+	assert.True(t, msgLogger.SaveCalls()[0].Msg.Edited)
+	post := savedMessage(msgLogger, "post")
+	require.NotNil(t, post)
+	assert.Equal(t, "channel", post.SenderChat.UserName)
+	assert.False(t, post.Edited)
+}
+
+func TestTelegramListener_DoWithUnbanButton(t *testing.T) {
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "bot"}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		if msg.Text == "wtf!" {
+			return bot.Response{Send: true, Text: "ban", BanInterval: time.Hour, User: msg.From,
+				Buttons: [][]bot.Button{{{Text: "site", URL: "https://radio-t.com"}}}}
+		}
+		return bot.Response{}
+	}}
+
+	l := TelegramListener{
+		MsgLogger:              msgLogger,
+		TbAPI:                  tbAPI,
+		Bots:                   bots,
+		Group:                  "gr",
+		SuperUsers:             SuperUser{"admin"},
+		AllActivityTerm:        Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+		BotsActivityTerm:       Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+		OverallBotActivityTerm: Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	pressed := func(id, user string) tbapi.Update {
+		return tbapi.Update{CallbackQuery: &tbapi.CallbackQuery{ID: id, Data: "unban!42:0", From: &tbapi.User{UserName: user},
+			Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123}}}}
+	}
+	updChan := make(chan tbapi.Update, 3)
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Text: "wtf!",
+		From: &tbapi.User{UserName: "user", ID: 42}}}
+	updChan <- pressed("cb1", "user")
+	updChan <- pressed("cb2", "admin")
+	close(updChan)
+	tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Equal(t, 1, len(tbAPI.SendCalls()))
+	assert.Equal(t, tbapi.NewInlineKeyboardMarkup(
+		tbapi.NewInlineKeyboardRow(tbapi.NewInlineKeyboardButtonURL("site", "https://radio-t.com")),
+		tbapi.NewInlineKeyboardRow(tbapi.NewInlineKeyboardButtonData("разбанить", "unban!42:0")),
+	), tbAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup)
+
+	require.Equal(t, 4, len(tbAPI.RequestCalls()))
+	assert.Equal(t, int64(42), tbAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).UserID, "banned")
+	assert.Equal(t, tbapi.NewCallback("cb1", "только для админов"), tbAPI.RequestCalls()[1].C)
+	unban := tbAPI.RequestCalls()[2].C.(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(42), unban.UserID)
+	assert.Equal(t, int64(123), unban.ChatID)
+	assert.True(t, unban.Permissions.CanSendMessages)
+	assert.Equal(t, tbapi.NewCallback("cb2", "разбанен"), tbAPI.RequestCalls()[3].C)
+}
+
+func TestTelegramListener_DoEditAndDeleteMessages(t *testing.T) {
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	msgID := 100
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			switch m := c.(type) {
+			case tbapi.MessageConfig:
+				msgID++
+				return tbapi.Message{MessageID: msgID, Text: m.Text, From: &tbapi.User{UserName: "bot"}}, nil
+			case tbapi.EditMessageTextConfig:
+				return tbapi.Message{MessageID: m.MessageID, Text: m.Text, EditDate: 1, From: &tbapi.User{UserName: "bot"}}, nil
+			}
+			return tbapi.Message{}, fmt.Errorf("unexpected %T", c)
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		switch msg.Text {
+		case "start":
+			return bot.Response{Send: true, Text: "started", Key: "status"}
+		case "stop":
+			return bot.Response{Send: true, Text: "finished", Key: "status", Edit: true}
+		case "other":
+			return bot.Response{Send: true, Text: "other finished", Key: "other", Edit: true}
+		case "page":
+			return bot.Response{Send: true, Text: "page 2", EditID: 42, Buttons: [][]bot.Button{{{Text: "next", Data: "3"}}}}
+		case "spam":
+			return bot.Response{Send: true, DeleteID: msg.ID}
+		}
+		return bot.Response{}
+	}}
+
+	l := TelegramListener{
+		MsgLogger:              msgLogger,
+		TbAPI:                  tbAPI,
+		Bots:                   bots,
+		Group:                  "gr",
+		AllActivityTerm:        Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+		BotsActivityTerm:       Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+		OverallBotActivityTerm: Terminator{Messages: 10, Window: time.Second, BanDurations: []time.Duration{time.Minute}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 5)
+	for i, text := range []string{"start", "stop", "other", "page", "spam"} {
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: i + 1, Chat: &tbapi.Chat{ID: 123}, Text: text,
+			From: &tbapi.User{UserName: fmt.Sprintf("user%d", i)}}}
+	}
+	close(updChan)
+	tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Equal(t, 4, len(tbAPI.SendCalls()))
+	assert.Equal(t, "started", tbAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	edit := tbAPI.SendCalls()[1].C.(tbapi.EditMessageTextConfig)
+	assert.Equal(t, 101, edit.MessageID, "message sent with the key edited")
+	assert.Equal(t, "finished", edit.Text)
+	assert.Equal(t, "other finished", tbAPI.SendCalls()[2].C.(tbapi.MessageConfig).Text, "unknown key, sent as new")
+	edit = tbAPI.SendCalls()[3].C.(tbapi.EditMessageTextConfig)
+	assert.Equal(t, 42, edit.MessageID)
+	assert.Equal(t, "page 2", edit.Text)
+	kb := tbapi.NewInlineKeyboardMarkup(tbapi.NewInlineKeyboardRow(tbapi.NewInlineKeyboardButtonData("next", "3")))
+	assert.Equal(t, &kb, edit.ReplyMarkup)
+
+	require.Equal(t, 1, len(tbAPI.RequestCalls()))
+	assert.Equal(t, tbapi.NewDeleteMessage(123, 5), tbAPI.RequestCalls()[0].C)
+
+	require.Equal(t, 9, len(msgLogger.SaveCalls()), "5 messages and 4 bot answers")
+	finished := savedMessage(msgLogger, "finished")
+	require.NotNil(t, finished)
+	assert.True(t, finished.Edited)
+}
+
+func TestTelegramListener_DoWithPlainTextFallback(t *testing.T) {
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			m := c.(tbapi.MessageConfig)
+			if m.ParseMode != "" {
+				return tbapi.Message{}, &tbapi.Error{Code: 400,
+					Message: "Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 5"}
+			}
+			return tbapi.Message{MessageID: 1, Text: m.Text, From: &tbapi.User{UserName: "bot"}}, nil
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		return bot.Response{Send: true, Text: "news: [snake_case](https://example.com/a_(b\\)) *bold* 1.5"}
+	}}
+
+	l := TelegramListener{
+		MsgLogger: msgLogger,
+		TbAPI:     tbAPI,
+		Bots:      bots,
+		Group:     "gr",
+	}
+
+	updChan := make(chan tbapi.Update, 1)
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123}, Text: "news",
+		From: &tbapi.User{UserName: "user"}}}
+	close(updChan)
+	tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(context.Background())
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Equal(t, 2, len(tbAPI.SendCalls()))
+	assert.Equal(t, tbapi.ModeMarkdownV2, tbAPI.SendCalls()[0].C.(tbapi.MessageConfig).ParseMode)
+	plain := tbAPI.SendCalls()[1].C.(tbapi.MessageConfig)
+	assert.Equal(t, "", plain.ParseMode)
+	assert.Equal(t, "news: snake_case (https://example.com/a_(b)) *bold* 1.5", plain.Text)
+	assert.Equal(t, int64(0), l.out.Dropped())
+	require.Equal(t, 2, len(msgLogger.SaveCalls()))
+	assert.Equal(t, plain.Text, msgLogger.SaveCalls()[1].Msg.Text)
+}
+
+// savedTexts returns texts of logged messages. Bot's messages logged when sent by outbox, i.e. after next updates.
+func savedTexts(ml *mocks.MsgLogger) []string {
+	res := []string{}
+	for _, c := range ml.SaveCalls() {
+		res = append(res, c.Msg.Text)
+	}
+	return res
+}
+
+// savedMessage returns the first logged message with the text, nil if not logged
+func savedMessage(ml *mocks.MsgLogger, text string) *bot.Message {
+	for _, c := range ml.SaveCalls() {
+		if c.Msg.Text == text {
+			return c.Msg
+		}
+	}
+	return nil
+}
@@ -3,40 +3,70 @@ package events
 import (
 	"fmt"
 	"log"
+	"sort"
 	"time"
 
 	"github.com/radio-t/super-bot/app/bot"
 )
 
-// Terminator helps to block too active users
+// Terminator helps to block too active users. User may send up to Messages in any Window,
+// the next message gets a warning, up to Warnings times, and then a ban. Each next ban of the same user
+// in the same chat is longer, as set by BanDurations, till the offences forgiven.
 type Terminator struct {
-	BanDuration   time.Duration
-	BanPenalty    int
-	AllowedPeriod time.Duration
-	Exclude       SuperUser
-	users         map[bot.User]map[int64]activity // {user: {chatId: activity} }
+	Messages     int             // messages allowed in the window, no limit if 0
+	Window       time.Duration   // sliding window of activity
+	Warnings     int             // warnings before ban
+	BanDurations []time.Duration // for the first, second and further offences, the last one repeated
+	Forgive      time.Duration   // warnings and bans forgotten after that time without offences, never if 0
+	MaxUsers     int             // users tracked, the least active forgotten over the limit, unlimited if 0
+	Exclude      SuperUser
+	Store        bot.KVStore // keeps warnings and bans across restarts, optional
+	Bucket       string      // store's bucket, unique for each terminator
+	users        map[activityKey]*activity
+}
+
+// storedActivity is a user's activity in a chat kept in the store
+type storedActivity struct {
+	User        bot.User
+	ChatID      int64
+	Warnings    int
+	Offences    int
+	LastOffence time.Time
+	BannedUntil time.Time
+}
+
+type activityKey struct {
+	user   bot.User
+	chatID int64
 }
 
 type activity struct {
-	lastActivity time.Time
-	penalty      int
+	sent        []time.Time // messages within the window, oldest first
+	warnings    int         // warnings since the last ban
+	offences    int         // bans
+	lastOffence time.Time   // time of the last warning or ban
+	bannedUntil time.Time
 }
 
 type ban struct {
-	active bool
-	new    bool
+	active   bool
+	new      bool
+	warn     bool          // limit exceeded, but only warning is due
+	duration time.Duration // of the new ban
 }
 
-// check if user\channel bothered bot too often and ban for BanDuration
+// check if user\channel bothered bot too often and warn or ban
 func (t *Terminator) check(user bot.User, senderChat bot.SenderChat, sent time.Time, chatID int64) ban {
-	noBan := ban{active: false, new: false}
-	if t.Exclude.IsSuper(user.Username) {
+	noBan := ban{}
+	if t.Messages <= 0 || t.Exclude.IsSuper(user.Username) {
 		return noBan
 	}
 
 	if t.users == nil {
-		t.users = make(map[bot.User]map[int64]activity)
-		log.Printf("[DEBUG] terminator with BanDuration=%v, BanPenalty=%d, excluded=%v", t.BanDuration, t.BanPenalty, t.Exclude)
+		t.users = map[activityKey]*activity{}
+		log.Printf("[DEBUG] terminator with Messages=%d, Window=%v, Warnings=%d, BanDurations=%v, excluded=%v",
+			t.Messages, t.Window, t.Warnings, t.BanDurations, t.Exclude)
+		t.load()
 	}
 
 	// This userID is a bot which means that message was sent on behalf of the channel,
@@ -46,43 +76,182 @@ func (t *Terminator) check(user bot.User, senderChat bot.SenderChat, sent time.T
 		user = bot.User{ID: senderChat.ID, Username: senderChat.UserName}
 	}
 
-	chatActivity, found := t.users[user]
+	key := activityKey{user: user, chatID: chatID}
+	info, found := t.users[key]
 	if !found {
-		t.users[user] = make(map[int64]activity)
-		t.users[user][chatID] = activity{lastActivity: sent}
+		if t.MaxUsers > 0 && len(t.users) >= t.MaxUsers {
+			t.cleanup()
+		}
+		info = &activity{}
+		t.users[key] = info
+	}
+
+	loggedUser := fmt.Sprintf("%v", user)
+	if user.ID == 0 && user.Username == "" {
+		loggedUser = "everyone due to overall bot activity"
+	}
+
+	now := time.Now()
+	if now.Before(info.bannedUntil) {
+		log.Printf("[DEBUG] still banned %v", loggedUser)
+		return ban{active: true}
+	}
+	if t.Forgive > 0 && !info.lastOffence.IsZero() && now.Sub(info.lastOffence) > t.Forgive {
+		log.Printf("[DEBUG] offences of %v forgiven", loggedUser)
+		info.warnings, info.offences, info.lastOffence = 0, 0, time.Time{}
+		t.forget(key)
+	}
+
+	// slide the window, old messages, i.e. received after restart, are not counted
+	from := now.Add(-t.Window)
+	n := 0
+	for n < len(info.sent) && !info.sent[n].After(from) {
+		n++
+	}
+	info.sent = info.sent[n:]
+	if sent.After(from) {
+		info.sent = append(info.sent, sent)
+	}
+	if len(info.sent) <= t.Messages {
 		return noBan
 	}
 
-	info := chatActivity[chatID]
+	// limit exceeded, the window starts over after warning or ban
+	info.sent = nil
+	info.lastOffence = now
+	if info.warnings < t.Warnings {
+		info.warnings++
+		log.Printf("[INFO] warned %s, warning %d of %d", loggedUser, info.warnings, t.Warnings)
+		t.save(key, info)
+		return ban{warn: true}
+	}
 
-	if time.Now().Before(info.lastActivity.Add(t.AllowedPeriod)) {
-		info.penalty++
-		log.Printf("[DEBUG] penalty increased for %v to %d", user, info.penalty)
-	} else {
-		if info.penalty > 0 {
-			log.Printf("[DEBUG] penalty reset for %v from %d", user, info.penalty)
+	var duration time.Duration
+	if len(t.BanDurations) > 0 {
+		duration = t.BanDurations[len(t.BanDurations)-1]
+		if info.offences < len(t.BanDurations) {
+			duration = t.BanDurations[info.offences]
 		}
-		info.penalty = 0
 	}
+	info.warnings = 0
+	info.offences++
+	info.bannedUntil = now.Add(duration)
+	log.Printf("[WARN] banned %s for %v, offence %d", loggedUser, duration, info.offences)
+	t.save(key, info)
+	return ban{active: true, new: true, duration: duration}
+}
 
-	loggedUser := fmt.Sprintf("%v", user)
-	if user.ID == 0 && user.Username == "" {
-		loggedUser = "everyone due to overall bot activity"
+// cleanup forgets 10% of users, ones without warnings and bans first, the least recently active first.
+// Users with active bans are kept.
+func (t *Terminator) cleanup() {
+	type rec struct {
+		key      activityKey
+		clean    bool
+		lastSeen time.Time
+	}
+	recs := make([]rec, 0, len(t.users))
+	now := time.Now()
+	for k, info := range t.users {
+		if now.Before(info.bannedUntil) {
+			continue
+		}
+		r := rec{key: k, clean: info.offences == 0 && info.warnings == 0, lastSeen: info.lastOffence}
+		if len(info.sent) > 0 && info.sent[len(info.sent)-1].After(r.lastSeen) {
+			r.lastSeen = info.sent[len(info.sent)-1]
+		}
+		recs = append(recs, r)
 	}
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].clean != recs[j].clean {
+			return recs[i].clean
+		}
+		return recs[i].lastSeen.Before(recs[j].lastSeen)
+	})
+	for i := 0; i < len(recs) && i <= t.MaxUsers/10; i++ {
+		if !recs[i].clean {
+			t.forget(recs[i].key)
+		}
+		delete(t.users, recs[i].key)
+	}
+}
 
-	if info.penalty == t.BanPenalty {
-		log.Printf("[WARN] banned %s", loggedUser)
-		info.penalty++
-		t.users[user][chatID] = info
-		return ban{active: true, new: true}
+// load restores warnings and bans from the store, forgiven records removed
+func (t *Terminator) load() {
+	if t.Store == nil {
+		return
 	}
+	keys, err := t.Store.Keys(t.Bucket)
+	if err != nil {
+		log.Printf("[WARN] failed to load activities from %s, %v", t.Bucket, err)
+		return
+	}
+	for _, k := range keys {
+		rec := storedActivity{}
+		if _, err := t.Store.Load(t.Bucket, k, &rec); err != nil {
+			log.Printf("[WARN] failed to load activity %s from %s, %v", k, t.Bucket, err)
+			continue
+		}
+		if t.Forgive > 0 && time.Since(rec.LastOffence) > t.Forgive && time.Now().After(rec.BannedUntil) {
+			if err := t.Store.Delete(t.Bucket, k); err != nil {
+				log.Printf("[WARN] failed to remove activity %s from %s, %v", k, t.Bucket, err)
+			}
+			continue
+		}
+		t.users[activityKey{user: rec.User, chatID: rec.ChatID}] = &activity{warnings: rec.Warnings,
+			offences: rec.Offences, lastOffence: rec.LastOffence, bannedUntil: rec.BannedUntil}
+	}
+	log.Printf("[DEBUG] loaded %d users activities from %s", len(t.users), t.Bucket)
+}
 
-	if info.penalty >= t.BanPenalty {
-		log.Printf("[DEBUG] still banned %v", loggedUser)
-		return ban{active: true, new: false}
+func (t *Terminator) save(key activityKey, info *activity) {
+	if t.Store == nil {
+		return
+	}
+	rec := storedActivity{User: key.user, ChatID: key.chatID, Warnings: info.warnings, Offences: info.offences,
+		LastOffence: info.lastOffence, BannedUntil: info.bannedUntil}
+	if err := t.Store.Save(t.Bucket, t.storeKey(key), rec); err != nil {
+		log.Printf("[WARN] failed to store activity of %v in %s, %v", key.user, t.Bucket, err)
+	}
+}
+
+func (t *Terminator) forget(key activityKey) {
+	if t.Store == nil {
+		return
+	}
+	if err := t.Store.Delete(t.Bucket, t.storeKey(key)); err != nil {
+		log.Printf("[WARN] failed to remove activity of %v from %s, %v", key.user, t.Bucket, err)
 	}
+}
 
-	info.lastActivity = sent
-	t.users[user][chatID] = info
-	return noBan
+func (t *Terminator) storeKey(key activityKey) string {
+	return fmt.Sprintf("%d:%d:%s:%s", key.chatID, key.user.ID, key.user.Username, key.user.DisplayName)
+}
+
+// lift ends active ban of the user in the chat, i.e. unbanned by admin. Offences are kept.
+func (t *Terminator) lift(chatID, userID int64) {
+	for key, info := range t.users {
+		if key.chatID == chatID && key.user.ID == userID && time.Now().Before(info.bannedUntil) {
+			info.bannedUntil = time.Time{}
+			t.save(key, info)
+		}
+	}
+}
+
+// bannedUser is a user banned by terminator, for status reports
+type bannedUser struct {
+	user   bot.User
+	chatID int64
+	until  time.Time
+}
+
+// banned returns users with active bans, ordered by ban end
+func (t *Terminator) banned() []bannedUser {
+	res := []bannedUser{}
+	for key, info := range t.users {
+		if time.Now().Before(info.bannedUntil) {
+			res = append(res, bannedUser{user: key.user, chatID: key.chatID, until: info.bannedUntil})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].until.Before(res[j].until) })
+	return res
 }
@@ -1,118 +1,219 @@
 package events
 
 import (
+	"fmt"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/storage"
 )
 
 func TestTerminator_checkTerminate(t *testing.T) {
 	term := Terminator{
-		BanDuration:   500 * time.Millisecond,
-		BanPenalty:    3,
-		AllowedPeriod: 100 * time.Millisecond,
-		Exclude:       []string{"umputun"},
+		Messages:     3,
+		Window:       time.Second,
+		Warnings:     1,
+		BanDurations: []time.Duration{200 * time.Millisecond, 400 * time.Millisecond},
+		Exclude:      []string{"umputun"},
+	}
+	user := bot.User{Username: "user"}
+	send := func(n int) {
+		for i := 0; i < n; i++ {
+			require.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+		}
 	}
 
-	// trigger ban
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-	time.Sleep(20 * time.Millisecond)
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-	time.Sleep(20 * time.Millisecond)
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
+	// warning first
+	send(3)
+	assert.Equal(t, ban{warn: true}, term.check(user, bot.SenderChat{}, time.Now(), 1))
 
-	// banned
-	assert.Equal(t, ban{active: true, new: true}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-	time.Sleep(20 * time.Millisecond)
-	assert.Equal(t, ban{active: true, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
+	// banned, the window started over after warning
+	send(3)
+	assert.Equal(t, ban{active: true, new: true, duration: 200 * time.Millisecond}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	assert.Equal(t, ban{active: true}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	require.Len(t, term.banned(), 1)
 
 	// ban expired
-	time.Sleep(510 * time.Millisecond)
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-
-	// trigger ban again
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-	time.Sleep(20 * time.Millisecond)
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-	time.Sleep(20 * time.Millisecond)
-	assert.Equal(t, ban{active: true, new: true}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
+	time.Sleep(210 * time.Millisecond)
+	assert.Empty(t, term.banned())
+	send(3)
+
+	// warned and banned again, for longer
+	assert.Equal(t, ban{warn: true}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	send(3)
+	assert.Equal(t, ban{active: true, new: true, duration: 400 * time.Millisecond}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+
+	// the last duration repeated for further offences
+	time.Sleep(410 * time.Millisecond)
+	send(3)
+	assert.Equal(t, ban{warn: true}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	send(3)
+	assert.Equal(t, ban{active: true, new: true, duration: 400 * time.Millisecond}, term.check(user, bot.SenderChat{}, time.Now(), 1))
 }
 
 func TestTerminator_checkAdmin(t *testing.T) {
 	term := Terminator{
-		BanDuration:   500 * time.Millisecond,
-		BanPenalty:    3,
-		AllowedPeriod: 100 * time.Millisecond,
-		Exclude:       []string{"umputun"},
+		Messages:     3,
+		Window:       100 * time.Millisecond,
+		BanDurations: []time.Duration{500 * time.Millisecond},
+		Exclude:      []string{"umputun"},
 	}
 
 	// try to trigger ban
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "umputun"}, bot.SenderChat{}, time.Now(), 1))
-	time.Sleep(20 * time.Millisecond)
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "umputun"}, bot.SenderChat{}, time.Now(), 1))
-	time.Sleep(20 * time.Millisecond)
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "umputun"}, bot.SenderChat{}, time.Now(), 1))
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "umputun"}, bot.SenderChat{}, time.Now(), 1))
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, ban{}, term.check(bot.User{Username: "umputun"}, bot.SenderChat{}, time.Now(), 1))
+	}
 }
 
-func TestTerminator_checkOk(t *testing.T) {
+func TestTerminator_checkSlidingWindow(t *testing.T) {
 	term := Terminator{
-		BanDuration:   500 * time.Millisecond,
-		BanPenalty:    3,
-		AllowedPeriod: 50 * time.Millisecond,
-		Exclude:       []string{"umputun"},
+		Messages:     2,
+		Window:       100 * time.Millisecond,
+		BanDurations: []time.Duration{500 * time.Millisecond},
 	}
-
-	// trigger ban
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-	time.Sleep(51 * time.Millisecond)
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-	time.Sleep(51 * time.Millisecond)
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
-	time.Sleep(51 * time.Millisecond)
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now(), 1))
+	user := bot.User{Username: "user"}
+
+	// the first message is out of the window by the third one
+	assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+
+	// but the second one is not
+	assert.Equal(t, ban{active: true, new: true, duration: 500 * time.Millisecond},
+		term.check(user, bot.SenderChat{}, time.Now(), 1))
 }
 
 func TestTerminator_ignoreOldMessages(t *testing.T) {
 	term := Terminator{
-		BanDuration:   500 * time.Millisecond,
-		BanPenalty:    3,
-		AllowedPeriod: 10 * time.Millisecond,
+		Messages:     3,
+		Window:       10 * time.Millisecond,
+		BanDurations: []time.Duration{500 * time.Millisecond},
 	}
+	user := bot.User{Username: "user"}
 
 	// ignore old messages
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-12*time.Millisecond), 1))
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-11*time.Millisecond), 1))
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-10*time.Millisecond), 1))
-
-	// handle messages that entered "allowed period" window
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-9*time.Millisecond), 1)) // penalty = 0
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-8*time.Millisecond), 1)) // penalty = 1
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-7*time.Millisecond), 1)) // penalty = 2
-	assert.Equal(t, ban{active: true, new: true}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-6*time.Millisecond), 1))   // ban
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now().Add(-11*time.Millisecond), 1))
+	}
+
+	// handle messages that entered the window
+	assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now().Add(-5*time.Millisecond), 1))
+	assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now().Add(-4*time.Millisecond), 1))
+	assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now().Add(-3*time.Millisecond), 1))
+	assert.Equal(t, ban{active: true, new: true, duration: 500 * time.Millisecond},
+		term.check(user, bot.SenderChat{}, time.Now().Add(-2*time.Millisecond), 1))
 }
 
 func TestTerminator_banPerChat(t *testing.T) {
 	term := Terminator{
-		BanDuration:   500 * time.Millisecond,
-		BanPenalty:    3,
-		AllowedPeriod: 10 * time.Millisecond,
+		Messages:     3,
+		Window:       time.Second,
+		BanDurations: []time.Duration{500 * time.Millisecond},
 	}
+	user := bot.User{Username: "user"}
 
 	// ban in one chat, but still active in another
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-9*time.Millisecond), -213)) // penalty = 0
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-8*time.Millisecond), -213)) // penalty = 1
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-7*time.Millisecond), -213)) // penalty = 2
-	assert.Equal(t, ban{active: true, new: true}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-6*time.Millisecond), -213))   // ban
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), -213))
+	}
+	assert.Equal(t, ban{active: true, new: true, duration: 500 * time.Millisecond}, term.check(user, bot.SenderChat{}, time.Now(), -213))
 
 	// another chat, the same user
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-9*time.Millisecond), 346)) // penalty = 1
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-8*time.Millisecond), 346)) // penalty = 2
-	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-7*time.Millisecond), 346)) // penalty 0
-	assert.Equal(t, ban{active: true, new: true}, term.check(bot.User{Username: "user"}, bot.SenderChat{}, time.Now().Add(-6*time.Millisecond), 346))   // ban
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 346))
+	}
+	assert.Equal(t, ban{active: true, new: true, duration: 500 * time.Millisecond}, term.check(user, bot.SenderChat{}, time.Now(), 346))
+}
+
+func TestTerminator_forgive(t *testing.T) {
+	term := Terminator{
+		Messages:     1,
+		Window:       time.Second,
+		BanDurations: []time.Duration{10 * time.Millisecond, time.Hour},
+		Forgive:      50 * time.Millisecond,
+	}
+	user := bot.User{Username: "user"}
+
+	assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	assert.Equal(t, ban{active: true, new: true, duration: 10 * time.Millisecond}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	assert.Equal(t, ban{active: true, new: true, duration: 10 * time.Millisecond}, term.check(user, bot.SenderChat{}, time.Now(), 1),
+		"the first offence again")
+}
+
+func TestTerminator_maxUsers(t *testing.T) {
+	term := Terminator{
+		Messages:     1,
+		Window:       time.Minute,
+		BanDurations: []time.Duration{time.Minute},
+		MaxUsers:     10,
+	}
+
+	banned := bot.User{Username: "banned"}
+	term.check(banned, bot.SenderChat{}, time.Now(), 1)
+	require.True(t, term.check(banned, bot.SenderChat{}, time.Now(), 1).new)
+
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, ban{}, term.check(bot.User{Username: fmt.Sprintf("user%d", i)}, bot.SenderChat{}, time.Now(), 1))
+		assert.LessOrEqual(t, len(term.users), 10)
+	}
+	assert.Equal(t, ban{active: true}, term.check(banned, bot.SenderChat{}, time.Now(), 1), "banned user not forgotten")
+	assert.Contains(t, term.users, activityKey{user: bot.User{Username: "user99"}, chatID: 1}, "recent user kept")
+	assert.NotContains(t, term.users, activityKey{user: bot.User{Username: "user0"}, chatID: 1}, "old user forgotten")
+}
+
+func TestTerminator_restored(t *testing.T) {
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	term := Terminator{Messages: 3, Window: time.Second, BanDurations: []time.Duration{time.Minute, time.Hour},
+		Store: store, Bucket: "term"}
+	user := bot.User{Username: "user", ID: 123}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	}
+	assert.Equal(t, ban{active: true, new: true, duration: time.Minute}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	assert.Equal(t, ban{}, term.check(bot.User{Username: "other"}, bot.SenderChat{}, time.Now(), 1))
+
+	// restart
+	term = Terminator{Messages: 3, Window: time.Second, BanDurations: []time.Duration{time.Minute, time.Hour},
+		Store: store, Bucket: "term"}
+	assert.Equal(t, ban{active: true}, term.check(user, bot.SenderChat{}, time.Now(), 1), "still banned")
+	assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 2), "other chat")
+	require.Len(t, term.banned(), 1)
+	assert.Equal(t, user, term.banned()[0].user)
+
+	keys, err := store.Keys("term")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1:123:user:"}, keys, "only offenders stored")
+
+	// the offence remembered after the ban
+	term.users[activityKey{user: user, chatID: 1}].bannedUntil = time.Now()
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+	}
+	assert.Equal(t, ban{active: true, new: true, duration: time.Hour}, term.check(user, bot.SenderChat{}, time.Now(), 1))
+}
+
+func TestTerminator_lift(t *testing.T) {
+	term := Terminator{Messages: 1, Window: time.Minute, BanDurations: []time.Duration{time.Minute, time.Hour}}
+	user := bot.User{Username: "user", ID: 1}
+	term.check(user, bot.SenderChat{}, time.Now(), 123)
+	require.True(t, term.check(user, bot.SenderChat{}, time.Now(), 123).new)
+
+	term.lift(123, 1)
+	assert.Empty(t, term.banned())
+	assert.Equal(t, ban{}, term.check(user, bot.SenderChat{}, time.Now(), 123), "not banned anymore")
+	assert.Equal(t, ban{active: true, new: true, duration: time.Hour}, term.check(user, bot.SenderChat{}, time.Now(), 123),
+		"offence remembered")
 }
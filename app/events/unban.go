@@ -0,0 +1,91 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// restrictionsBucket keeps active restrictions in the store
+const restrictionsBucket = "restrictions"
+
+// restriction is a user restricted in a chat till the given time
+type restriction struct {
+	ChatID int64
+	UserID int64
+	Until  time.Time
+}
+
+func (r restriction) key() string {
+	return fmt.Sprintf("%d:%d", r.ChatID, r.UserID)
+}
+
+// scheduleUnban keeps the restriction to be lifted explicitly at the end, not relying on telegram alone.
+// Overlapping restrictions of the same user lifted at the latest end.
+func (l *TelegramListener) scheduleUnban(chatID, userID int64, until time.Time) {
+	if l.restrictions == nil {
+		l.restrictions = map[string]restriction{}
+	}
+	r := restriction{ChatID: chatID, UserID: userID, Until: until}
+	if prev, ok := l.restrictions[r.key()]; ok && prev.Until.After(until) {
+		return
+	}
+	l.restrictions[r.key()] = r
+	if l.Store != nil {
+		if err := l.Store.Save(restrictionsBucket, r.key(), r); err != nil {
+			log.Printf("[WARN] failed to store restriction %s, %v", r.key(), err)
+		}
+	}
+}
+
+// cancelUnban forgets the restriction lifted before the end, i.e. by admin
+func (l *TelegramListener) cancelUnban(chatID, userID int64) {
+	key := restriction{ChatID: chatID, UserID: userID}.key()
+	if _, ok := l.restrictions[key]; !ok {
+		return
+	}
+	delete(l.restrictions, key)
+	if l.Store != nil {
+		if err := l.Store.Delete(restrictionsBucket, key); err != nil {
+			log.Printf("[WARN] failed to remove restriction %s, %v", key, err)
+		}
+	}
+}
+
+// unbanExpired lifts ended restrictions. Failed ones not retried, as telegram lifts them by itself
+// and the user could leave the chat.
+func (l *TelegramListener) unbanExpired() {
+	for k, r := range l.restrictions {
+		if r.Until.After(time.Now()) {
+			continue
+		}
+		if err := l.unbanUserOrChannel(r.ChatID, r.UserID, 0); err != nil {
+			log.Printf("[WARN] can't lift expired restriction %s, %v", k, err)
+		} else {
+			log.Printf("[INFO] expired restriction of user %d in chat %d lifted", r.UserID, r.ChatID)
+		}
+		l.cancelUnban(r.ChatID, r.UserID)
+	}
+}
+
+// loadRestrictions restores restrictions made before restart
+func (l *TelegramListener) loadRestrictions() {
+	if l.Store == nil {
+		return
+	}
+	keys, err := l.Store.Keys(restrictionsBucket)
+	if err != nil {
+		log.Printf("[WARN] failed to load restrictions, %v", err)
+		return
+	}
+	l.restrictions = map[string]restriction{}
+	for _, k := range keys {
+		var r restriction
+		if _, err := l.Store.Load(restrictionsBucket, k, &r); err != nil {
+			log.Printf("[WARN] failed to load restriction %s, %v", k, err)
+			continue
+		}
+		l.restrictions[k] = r
+	}
+	log.Printf("[INFO] loaded %d restrictions", len(l.restrictions))
+}
@@ -0,0 +1,100 @@
+package events
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/events/mocks"
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+func TestTelegramListener_UnbanExpired(t *testing.T) {
+	store, err := storage.NewBolt(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{MessageID: 100, Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "bot"}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		if msg.Text != "wtf!" {
+			return bot.Response{}
+		}
+		return bot.Response{Send: true, Text: "бан", BanInterval: time.Duration(msg.From.ID) * time.Hour, User: msg.From}
+	}}
+	newListener := func(updates ...tbapi.Update) *TelegramListener {
+		updChan := make(chan tbapi.Update, len(updates))
+		for _, u := range updates {
+			updChan <- u
+		}
+		close(updChan)
+		tbAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+		return &TelegramListener{
+			MsgLogger:  &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}},
+			TbAPI:      tbAPI,
+			Bots:       bots,
+			Group:      "gr",
+			Store:      store,
+			SuperUsers: SuperUser{"admin"},
+		}
+	}
+
+	l := newListener(
+		tbapi.Update{Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123}, Text: "wtf!", From: &tbapi.User{UserName: "u1", ID: 1}}},
+		tbapi.Update{Message: &tbapi.Message{MessageID: 2, Chat: &tbapi.Chat{ID: 123}, Text: "wtf!", From: &tbapi.User{UserName: "u2", ID: 2}}},
+	)
+	err = l.Do(context.Background())
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Len(t, tbAPI.RequestCalls(), 2)
+	require.Len(t, l.restrictions, 2)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), l.restrictions["123:1"].Until, time.Second)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), l.restrictions["123:2"].Until, time.Second)
+	assert.Contains(t, l.Status(123), "*ограничено пользователей:* 2\n")
+	assert.NotContains(t, l.Status(456), "ограничено пользователей", "other chat")
+
+	l.unbanExpired()
+	assert.Len(t, tbAPI.RequestCalls(), 2, "nothing expired yet")
+
+	// restart, restrictions restored
+	l = newListener()
+	err = l.Do(context.Background())
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Len(t, l.restrictions, 2)
+
+	r := l.restrictions["123:1"]
+	r.Until = time.Now().Add(-time.Second)
+	l.restrictions["123:1"] = r
+	l.unbanExpired()
+	require.Len(t, tbAPI.RequestCalls(), 3)
+	unban := tbAPI.RequestCalls()[2].C.(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(1), unban.UserID)
+	assert.True(t, unban.Permissions.CanSendMessages)
+	assert.Len(t, l.restrictions, 1)
+	keys, err := store.Keys(restrictionsBucket)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"123:2"}, keys)
+
+	// lifted by admin before the end
+	answer := l.unbanOnCallback(l.main, &tbapi.CallbackQuery{From: &tbapi.User{UserName: "admin"},
+		Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}}, Data: unbanCallback + "2:0"})
+	assert.Equal(t, "разбанен", answer)
+	assert.Empty(t, l.restrictions)
+	keys, err = store.Keys(restrictionsBucket)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
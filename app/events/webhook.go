@@ -0,0 +1,117 @@
+package events
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// secretHeader is the header with secret token set by telegram for each webhook request
+const secretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Webhook defines http receiver of telegram updates, used by TelegramListener instead of long polling if Address set
+type Webhook struct {
+	Address string // listen address, i.e. ":8080"
+	Path    string // path of the handler, i.e. "/telegram"
+	URL     string // public url registered with setWebhook, webhook expected to be set outside if empty
+	Secret  string // secret token, requests without it in X-Telegram-Bot-Api-Secret-Token header rejected
+}
+
+// enabled returns true if webhook mode selected
+func (w Webhook) enabled() bool {
+	return w.Address != ""
+}
+
+// register sets webhook url with secret token in telegram, skipped if url not defined
+func (w Webhook) register(api tbAPI) error {
+	if w.URL == "" {
+		log.Printf("[INFO] webhook url not defined, expected to be set outside")
+		return nil
+	}
+	params := tbapi.Params{"url": w.URL}
+	params.AddNonEmpty("secret_token", w.Secret)
+	resp, err := api.MakeRequest("setWebhook", params)
+	if err != nil {
+		return fmt.Errorf("failed to set webhook %s: %w", w.URL, err)
+	}
+	if !resp.Ok {
+		return fmt.Errorf("failed to set webhook %s: %s", w.URL, resp.Description)
+	}
+	log.Printf("[INFO] webhook set to %s", w.URL)
+	return nil
+}
+
+// listen starts http server passing received updates to the returned channel, server stopped on ctx cancellation
+func (w Webhook) listen(ctx context.Context) (tbapi.UpdatesChannel, error) {
+	if w.Secret == "" {
+		log.Printf("[WARN] webhook secret not defined, all requests accepted")
+	}
+	ln, err := net.Listen("tcp", w.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", w.Address, err)
+	}
+
+	updates := make(chan tbapi.Update, 100)
+	mux := http.NewServeMux()
+	mux.Handle(w.path(), w.handler(ctx, updates))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second, WriteTimeout: 30 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		if err := srv.Close(); err != nil {
+			log.Printf("[WARN] failed to close webhook server, %v", err)
+		}
+	}()
+	go func() {
+		log.Printf("[INFO] webhook listener on %s%s", ln.Addr(), w.path())
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("[ERROR] webhook server failed, %v", err)
+		}
+	}()
+	return updates, nil
+}
+
+// handler accepts POST requests with valid secret and passes decoded updates to the channel.
+// Blocks till the update taken, so telegram retries it later if the listener is too slow.
+func (w Webhook) handler(ctx context.Context, updates chan<- tbapi.Update) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if w.Secret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(secretHeader)), []byte(w.Secret)) != 1 {
+			log.Printf("[WARN] webhook request from %s with wrong secret", r.RemoteAddr)
+			http.Error(rw, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update tbapi.Update
+		if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 10*1024*1024)).Decode(&update); err != nil {
+			log.Printf("[WARN] can't decode webhook update, %v", err)
+			http.Error(rw, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case updates <- update:
+			rw.WriteHeader(http.StatusOK)
+		case <-ctx.Done():
+			http.Error(rw, "shutting down", http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+		}
+	}
+}
+
+func (w Webhook) path() string {
+	if w.Path == "" {
+		return "/"
+	}
+	return w.Path
+}
@@ -0,0 +1,121 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/events/mocks"
+)
+
+func TestTelegramListener_DoWithWebhook(t *testing.T) {
+	msgLogger := &mocks.MsgLogger{SaveFunc: func(msg *bot.Message) {}}
+	var sent int32
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			atomic.AddInt32(&sent, 1)
+			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "bot"}}, nil
+		},
+		MakeRequestFunc: func(endpoint string, params tbapi.Params) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+		GetUpdatesChanFunc: func(config tbapi.UpdateConfig) tbapi.UpdatesChannel {
+			t.Fatal("long polling not expected in webhook mode")
+			return nil
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		if msg.Text == "text 123" {
+			return bot.Response{Send: true, Text: "bot's answer"}
+		}
+		return bot.Response{}
+	}}
+
+	addr := freeAddress(t)
+	l := TelegramListener{
+		MsgLogger: msgLogger,
+		TbAPI:     tbAPI,
+		Bots:      bots,
+		Group:     "gr",
+		Webhook:   Webhook{Address: addr, Path: "/tg", URL: "https://example.com/tg", Secret: "secret123"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Do(ctx) }()
+
+	// fake telegram posting updates
+	post := func(method, secret string, upd tbapi.Update) int {
+		body, err := json.Marshal(upd)
+		require.NoError(t, err)
+		req, err := http.NewRequest(method, fmt.Sprintf("http://%s/tg", addr), bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(secretHeader, secret)
+		var resp *http.Response
+		require.Eventually(t, func() bool { // wait for the listener to start
+			resp, err = http.DefaultClient.Do(req)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	upd := tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Text: "text 123",
+		From: &tbapi.User{UserName: "user"}}}
+	assert.Equal(t, http.StatusForbidden, post(http.MethodPost, "wrong", upd))
+	assert.Equal(t, http.StatusMethodNotAllowed, post(http.MethodGet, "secret123", upd))
+	assert.Equal(t, http.StatusOK, post(http.MethodPost, "secret123", upd))
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&sent) == 1 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	require.Equal(t, 1, len(tbAPI.MakeRequestCalls()))
+	assert.Equal(t, "setWebhook", tbAPI.MakeRequestCalls()[0].Endpoint)
+	assert.Equal(t, tbapi.Params{"url": "https://example.com/tg", "secret_token": "secret123"},
+		tbAPI.MakeRequestCalls()[0].Params)
+	assert.Equal(t, "bot's answer", tbAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	require.Equal(t, 2, len(msgLogger.SaveCalls()))
+	assert.Equal(t, "text 123", msgLogger.SaveCalls()[0].Msg.Text)
+}
+
+func TestTelegramListener_DoWithWebhookFailed(t *testing.T) {
+	tbAPI := &mocks.TbAPI{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		MakeRequestFunc: func(endpoint string, params tbapi.Params) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: false, Description: "bad webhook"}, nil
+		},
+	}
+	l := TelegramListener{
+		TbAPI:   tbAPI,
+		Bots:    &bot.InterfaceMock{},
+		Group:   "gr",
+		Webhook: Webhook{Address: freeAddress(t), URL: "https://example.com/tg"},
+	}
+	err := l.Do(context.Background())
+	assert.EqualError(t, err, "failed to get updates: failed to set webhook https://example.com/tg: bad webhook")
+}
+
+// freeAddress returns local address with a free port
+func freeAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
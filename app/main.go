@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 
 	"github.com/radio-t/super-bot/app/bot"
 	"github.com/radio-t/super-bot/app/bot/openai"
+	"github.com/radio-t/super-bot/app/config"
 	"github.com/radio-t/super-bot/app/events"
 	"github.com/radio-t/super-bot/app/reporter"
 	"github.com/radio-t/super-bot/app/storage"
@@ -33,13 +35,22 @@ var opts struct {
 		Timeout time.Duration `long:"timeout" env:"TIMEOUT" description:"http client timeout for getting files from Telegram" default:"30s"`
 	} `group:"telegram" namespace:"telegram" env-namespace:"TELEGRAM"`
 
+	Webhook struct {
+		Address string `long:"address" env:"ADDRESS" description:"listen address for telegram webhook, long polling used if not set"`
+		Path    string `long:"path" env:"PATH" default:"/telegram" description:"path of webhook handler"`
+		URL     string `long:"url" env:"URL" description:"public url of webhook to register in telegram"`
+		Secret  string `long:"secret" env:"SECRET" description:"secret token of webhook requests"`
+	} `group:"webhook" namespace:"webhook" env-namespace:"WEBHOOK"`
+
 	RtjcPort             int              `short:"p" long:"port" env:"RTJC_PORT" default:"18001" description:"rtjc port room"`
 	LogsPath             string           `short:"l" long:"logs" env:"TELEGRAM_LOGS" default:"logs" description:"path to logs"`
 	SuperUsers           events.SuperUser `long:"super" description:"super-users"`
 	MashapeToken         string           `long:"mashape" env:"MASHAPE_TOKEN" description:"mashape token"`
 	SysData              string           `long:"sys-data" env:"SYS_DATA" default:"data" description:"location of sys data"`
-	NewsArticles         int              `long:"max-articles" env:"MAX_ARTICLES" default:"5" description:"max number of news articles"`
+	Config               string           `long:"conf" env:"CONFIG" description:"bots configuration file, yaml or json"`
 	IdleDuration         time.Duration    `long:"idle" env:"IDLE" default:"30s" description:"idle duration"`
+	NewsArticles         int              `long:"max-articles" env:"MAX_ARTICLES" description:"max number of news articles, overrides news.max_articles of config"`
+	BotTimeout           time.Duration    `long:"bot-timeout" env:"BOT_TIMEOUT" default:"15s" description:"max time for each bot to answer, openai waits for openai timeout"`
 	ExportNum            int              `long:"export-num" description:"show number for export"`
 	ExportPath           string           `long:"export-path" default:"logs" description:"path to export directory"`
 	ExportDay            int              `long:"export-day" description:"day in yyyymmdd"`
@@ -99,84 +110,75 @@ func main() {
 	}
 	tbAPI.Debug = opts.Dbg
 
-	httpClient := &http.Client{Timeout: 5 * time.Second}
-	// 5 seconds is not enough for OpenAI requests
-	httpClientOpenAI := makeOpenAIHttpClient()
-	openAIBot := openai.NewOpenAI(openai.Params{
-		AuthToken:               opts.OpenAI.AuthToken,
-		MaxTokensResponse:       opts.OpenAI.MaxTokensResponse,
-		MaxTokensRequest:        opts.OpenAI.MaxTokensRequest,
-		MaxSymbolsRequest:       opts.OpenAI.MaxSymbolsRequest,
-		Prompt:                  opts.OpenAI.Prompt,
-		HistorySize:             opts.OpenAI.HistorySize,
-		HistoryReplyProbability: opts.OpenAI.HistoryReplyProbability,
-		EnableAutoResponse:      opts.OpenAI.EnableAutoResponse,
-	}, httpClientOpenAI, opts.SuperUsers)
-
-	multiBot := bot.MultiBot{
-		bot.NewBroadcastStatus(
-			ctx,
-			bot.BroadcastParams{
-				URL:          "https://stream.radio-t.com",
-				PingInterval: 10 * time.Second,
-				DelayToOff:   time.Minute,
-				Client:       http.Client{Timeout: 5 * time.Second}}),
-		bot.NewNews(httpClient, "https://news.radio-t.com/api", opts.NewsArticles),
-		bot.NewAnecdote(httpClient),
-		bot.NewStackOverflow(),
-		bot.NewDuck(opts.MashapeToken, httpClient),
-		bot.NewPodcasts(httpClient, "https://radio-t.com/site-api", 5),
-		bot.NewPrepPost(httpClient, "https://radio-t.com/site-api", 5*time.Minute),
-		bot.NewWTF(time.Hour*24, 7*time.Hour*24, opts.SuperUsers),
-		bot.NewBanhammer(tbAPI, opts.SuperUsers, 5000),
-		bot.NewWhen(),
-		openAIBot,
-	}
-
-	if sb, err := bot.NewSys(opts.SysData); err == nil {
-		multiBot = append(multiBot, sb)
-	} else {
-		log.Printf("[ERROR] failed to load sysbot, %v", err)
-	}
-
-	if wttb, err := bot.NewWhatsTheTime(opts.SysData); err == nil {
-		multiBot = append(multiBot, wttb)
+	var store bot.KVStore // nil store means no persistence, bots keep state in memory only
+	boltStore, err := storage.NewBolt(filepath.Join(opts.SysData, "state.db"))
+	if err != nil {
+		log.Printf("[WARN] can't open state storage, bots state won't survive restart, %v", err)
 	} else {
-		log.Printf("[ERROR] failed to load whats the time bot, %v", err)
+		defer boltStore.Close() // nolint
+		store = boltStore
 	}
 
-	allActivityTerm := events.Terminator{
-		BanDuration:   time.Minute * 5,
-		BanPenalty:    10,
-		AllowedPeriod: time.Second * 60,
-		Exclude:       opts.SuperUsers,
-	}
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	// 5 seconds is not enough for OpenAI requests
+	httpClientOpenAI := makeOpenAIHttpClient()
+	openAIBot := makeOpenAI(httpClientOpenAI, opts.SuperUsers, store)
 
-	botsActivityTerm := events.Terminator{
-		BanDuration:   time.Minute * 15,
-		BanPenalty:    3,
-		AllowedPeriod: time.Minute * 5,
-		Exclude:       opts.SuperUsers,
+	conf := config.Default()
+	if opts.Config != "" {
+		if conf, err = config.Load(opts.Config); err != nil {
+			log.Fatalf("[ERROR] can't load configuration, %v", err)
+		}
 	}
-
-	botsAllUsersActivityTerm := events.Terminator{
-		BanDuration:   time.Minute * 5,
-		BanPenalty:    5,
-		AllowedPeriod: time.Minute * 5,
-		Exclude:       opts.SuperUsers,
+	if opts.NewsArticles > 0 {
+		conf.Bots.News.MaxArticles = opts.NewsArticles
 	}
 
+	mainLogger := reporter.NewLogger(opts.LogsPath)
 	tgListener := events.TelegramListener{
 		TbAPI:                  tbAPI,
-		AllActivityTerm:        allActivityTerm,
-		BotsActivityTerm:       botsActivityTerm,
-		OverallBotActivityTerm: botsAllUsersActivityTerm,
-		MsgLogger:              reporter.NewLogger(opts.LogsPath),
-		Bots:                   multiBot,
+		AllActivityTerm:        makeTerminator(conf.Terminators.All, opts.SuperUsers, store, "terminator_all"),
+		BotsActivityTerm:       makeTerminator(conf.Terminators.Bots, opts.SuperUsers, store, "terminator_bots"),
+		OverallBotActivityTerm: makeTerminator(conf.Terminators.BotsOverall, opts.SuperUsers, store, "terminator_bots_overall"),
+		MsgLogger:              mainLogger,
 		Group:                  opts.Telegram.Group,
 		Debug:                  opts.Dbg,
 		IdleDuration:           opts.IdleDuration,
 		SuperUsers:             opts.SuperUsers,
+		Store:                  store,
+		Webhook: events.Webhook{
+			Address: opts.Webhook.Address,
+			Path:    opts.Webhook.Path,
+			URL:     opts.Webhook.URL,
+			Secret:  opts.Webhook.Secret,
+		},
+	}
+
+	managedBots := makeBots(ctx, conf.Bots, opts.SuperUsers, tbAPI, httpClient, openAIBot, store, mainLogger)
+	tgListener.Bots = makeMultiBot(tbAPI, opts.SuperUsers, managedBots, openAIBot, &tgListener)
+
+	for _, cc := range conf.Chats {
+		superUsers := opts.SuperUsers
+		if len(cc.SuperUsers) > 0 {
+			superUsers = cc.SuperUsers
+		}
+		logsPath := cc.Logs
+		if logsPath == "" {
+			logsPath = filepath.Join(opts.LogsPath, cc.Group)
+		}
+		chatStore := bot.WithBucketPrefix(store, "chat_"+cc.Group+"_")
+		chatOpenAI := makeOpenAI(httpClientOpenAI, superUsers, chatStore) // separate history and limits for each chat
+		chatLogger := reporter.NewLogger(logsPath)
+		chatBots := makeBots(ctx, cc.Bots, superUsers, tbAPI, httpClient, chatOpenAI, chatStore, chatLogger)
+		tgListener.Chats = append(tgListener.Chats, &events.Chat{
+			Group:                  cc.Group,
+			MsgLogger:              chatLogger,
+			Bots:                   makeMultiBot(tbAPI, superUsers, chatBots, chatOpenAI, &tgListener),
+			SuperUsers:             superUsers,
+			AllActivityTerm:        makeTerminator(cc.Terminators.All, superUsers, chatStore, "terminator_all"),
+			BotsActivityTerm:       makeTerminator(cc.Terminators.Bots, superUsers, chatStore, "terminator_bots"),
+			OverallBotActivityTerm: makeTerminator(cc.Terminators.BotsOverall, superUsers, chatStore, "terminator_bots_overall"),
+		})
 	}
 
 	remarkClient := openai.RemarkClient{
@@ -213,6 +215,145 @@ func main() {
 	}
 }
 
+// makeOpenAI creates OpenAI bot, used by chat's bots and by summarizer
+func makeOpenAI(httpClient *http.Client, superUsers events.SuperUser, store bot.KVStore) *openai.OpenAI {
+	return openai.NewOpenAI(openai.Params{
+		AuthToken:               opts.OpenAI.AuthToken,
+		MaxTokensResponse:       opts.OpenAI.MaxTokensResponse,
+		MaxTokensRequest:        opts.OpenAI.MaxTokensRequest,
+		MaxSymbolsRequest:       opts.OpenAI.MaxSymbolsRequest,
+		Prompt:                  opts.OpenAI.Prompt,
+		HistorySize:             opts.OpenAI.HistorySize,
+		HistoryReplyProbability: opts.OpenAI.HistoryReplyProbability,
+		EnableAutoResponse:      opts.OpenAI.EnableAutoResponse,
+		Store:                   store,
+	}, httpClient, superUsers)
+}
+
+// makeTerminator creates activity limiter excluding superusers, with state kept in the store's bucket
+func makeTerminator(conf config.Terminator, superUsers events.SuperUser, store bot.KVStore, bucket string) events.Terminator {
+	return events.Terminator{
+		Messages:     conf.Messages,
+		Window:       conf.Window,
+		Warnings:     conf.Warnings,
+		BanDurations: conf.BanDurations,
+		Forgive:      conf.Forgive,
+		MaxUsers:     conf.MaxUsers,
+		Exclude:      superUsers,
+		Store:        store,
+		Bucket:       bucket,
+	}
+}
+
+// makeMultiBot combines chat's bots with admin bot managing them
+func makeMultiBot(tbAPI *tbapi.BotAPI, superUsers events.SuperUser, bots []*bot.Managed,
+	reporters ...bot.StatusReporter) bot.MultiBot {
+	res := bot.MultiBot{Timeout: opts.BotTimeout, BotName: tbAPI.Self.UserName}
+	for _, b := range bots {
+		res.Bots = append(res.Bots, b)
+	}
+	res.Bots = append(res.Bots, bot.NewAdmin(superUsers, bots, reporters...))
+	return res
+}
+
+// makeBots creates all bots enabled in configuration, in the order of their priority.
+// Bots named after their configuration sections, to be managed with admin commands.
+func makeBots(ctx context.Context, conf config.Bots, superUsers events.SuperUser, tbAPI *tbapi.BotAPI,
+	httpClient *http.Client, openAIBot *openai.OpenAI, store bot.KVStore, modLog bot.ModerationLog) []*bot.Managed {
+	res := []*bot.Managed{}
+	add := func(name string, bc config.Bot, makeBot func() (bot.Interface, error)) {
+		if !bc.Enabled {
+			return
+		}
+		b, err := makeBot()
+		if err != nil {
+			log.Printf("[ERROR] failed to make bot, %v", err)
+			return
+		}
+		if len(bc.Triggers) > 0 {
+			rb, err := bot.WithTriggers(b, bc.Triggers)
+			if err != nil {
+				log.Printf("[WARN] triggers %v ignored, %v", bc.Triggers, err)
+			} else {
+				b = rb
+			}
+		}
+		res = append(res, bot.NewManaged(name, b).WithTTL(bc.TTL).WithTimeout(bc.Timeout))
+	}
+
+	add("broadcast", conf.Broadcast.Bot, func() (bot.Interface, error) {
+		return bot.NewBroadcastStatus(ctx, bot.BroadcastParams{
+			URL:          conf.Broadcast.URL,
+			PingInterval: conf.Broadcast.PingInterval,
+			DelayToOff:   conf.Broadcast.DelayToOff,
+			Client:       http.Client{Timeout: 5 * time.Second},
+			Store:        store}), nil
+	})
+	add("news", conf.News.Bot, func() (bot.Interface, error) {
+		return bot.NewNews(httpClient, conf.News.API, conf.News.MaxArticles), nil
+	})
+	add("anecdote", conf.Anecdote, func() (bot.Interface, error) { return bot.NewAnecdote(httpClient), nil })
+	add("stackoverflow", conf.StackOverflow, func() (bot.Interface, error) { return bot.NewStackOverflow(), nil })
+	add("duck", conf.Duck, func() (bot.Interface, error) { return bot.NewDuck(opts.MashapeToken, httpClient), nil })
+	add("podcasts", conf.Podcasts.Bot, func() (bot.Interface, error) {
+		return bot.NewPodcasts(httpClient, conf.Podcasts.API, conf.Podcasts.MaxResults), nil
+	})
+	add("preppost", conf.PrepPost.Bot, func() (bot.Interface, error) {
+		return bot.NewPrepPost(httpClient, conf.PrepPost.API, conf.PrepPost.CheckInterval, store), nil
+	})
+	add("wtf", conf.WTF.Bot, func() (bot.Interface, error) {
+		return bot.NewWTF(conf.WTF.MinDuration, conf.WTF.MaxDuration, superUsers, store), nil
+	})
+	add("banhammer", conf.Banhammer.Bot, func() (bot.Interface, error) {
+		return bot.NewBanhammer(superUsers, conf.Banhammer.MaxRecentUsers, store), nil
+	})
+	add("spam", conf.Spam.Bot, func() (bot.Interface, error) {
+		sb, err := bot.NewSpam(bot.SpamParams{
+			Messages:     conf.Spam.Messages,
+			Threshold:    conf.Spam.Threshold,
+			BanDuration:  conf.Spam.BanDuration,
+			DryRun:       conf.Spam.DryRun,
+			MaxUsers:     conf.Spam.MaxUsers,
+			SuperUser:    superUsers,
+			DataLocation: opts.SysData,
+			Store:        store,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load spam bot: %w", err)
+		}
+		return sb, nil
+	})
+	add("moderation", conf.Moderation, func() (bot.Interface, error) {
+		mb, err := bot.NewModeration(opts.SysData, superUsers, modLog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load moderation bot: %w", err)
+		}
+		return mb, nil
+	})
+	add("when", conf.When, func() (bot.Interface, error) { return bot.NewWhen(), nil })
+	openAIConf := conf.OpenAI
+	if openAIConf.Timeout == 0 { // the only slow bot, waits for openai requests instead of the common bot timeout
+		openAIConf.Timeout = opts.OpenAI.Timeout + 10*time.Second
+	}
+	add("openai", openAIConf, func() (bot.Interface, error) { return openAIBot, nil })
+	add("sys", conf.Sys, func() (bot.Interface, error) {
+		sb, err := bot.NewSys(opts.SysData, superUsers, store)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sysbot: %w", err)
+		}
+		return sb, nil
+	})
+	add("quotes", conf.Quotes, func() (bot.Interface, error) { return bot.NewQuotes(store), nil })
+	add("whatsthetime", conf.WhatsTheTime, func() (bot.Interface, error) {
+		wttb, err := bot.NewWhatsTheTime(opts.SysData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load whats the time bot: %w", err)
+		}
+		return wttb, nil
+	})
+	return res
+}
+
 func export() {
 	log.Printf("[INFO] export mode, destination=%s, template=%s", opts.ExportPath, opts.TemplateFile)
 	botAPI, err := tbapi.NewBotAPI(opts.Telegram.Token)
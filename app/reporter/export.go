@@ -231,6 +231,7 @@ func readMessages(path string, broadcastUsers SuperUser) ([]bot.Message, error)
 		broadcastStartedIndex  uint
 		broadcastFinishedIndex uint
 	)
+	positions := map[int]int{} // message id to its index in messages, to replace edited messages
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
@@ -258,9 +259,17 @@ func readMessages(path string, broadcastUsers SuperUser) ([]bot.Message, error)
 			}
 		}
 
+		if i, found := positions[msg.ID]; found && msg.Edited {
+			messages[i] = msg // edited version replaces the original one
+			continue
+		}
+
 		if filter(msg) {
 			continue
 		}
+		if msg.ID != 0 {
+			positions[msg.ID] = len(messages)
+		}
 		messages = append(messages, msg)
 		currentIndex++
 	}
@@ -263,6 +263,25 @@ func Test_readMessagesCheckBroadcastMessages(t *testing.T) {
 	}
 }
 
+func Test_readMessagesReplacesEdited(t *testing.T) {
+	err := createFile(testFile, []bot.Message{
+		{ID: 1, Text: "message-1"},
+		{ID: 2, Text: "message-2"},
+		{ID: 1, Text: "message-1 fixed", Edited: true},
+		{ID: 3, Text: "message-3 edited", Edited: true}, // original not in the log
+	})
+	defer os.Remove(testFile)
+	assert.NoError(t, err)
+
+	msgs, err := readMessages(testFile, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []bot.Message{
+		{ID: 1, Text: "message-1 fixed", Edited: true},
+		{ID: 2, Text: "message-2"},
+		{ID: 3, Text: "message-3 edited", Edited: true},
+	}, msgs)
+}
+
 func Test_downloadFilesNeverCalledForTextMessages(t *testing.T) {
 	msgs := []bot.Message{
 		{
@@ -10,18 +10,21 @@ import (
 	"github.com/radio-t/super-bot/app/bot"
 )
 
-// Reporter collects all messages and saves to plain file
+// Reporter collects all messages and saves to plain file.
+// Moderation actions saved to separate file, not to be exported with messages.
 type Reporter struct {
 	logsPath string
 	messages chan string
+	actions  chan string
 }
 
 // NewLogger makes new reporter bot
 func NewLogger(logs string) (result Reporter) {
 	log.Printf("[INFO] new reporter, path=%s", logs)
 	_ = os.MkdirAll(logs, 0o750)
-	result = Reporter{logsPath: logs, messages: make(chan string, 1000)}
-	go result.activate()
+	result = Reporter{logsPath: logs, messages: make(chan string, 1000), actions: make(chan string, 100)}
+	go result.activate(result.messages, "")
+	go result.activate(result.actions, "moderation-")
 	return result
 }
 
@@ -45,8 +48,24 @@ func (l Reporter) Save(msg *bot.Message) {
 	}
 }
 
-func (l Reporter) activate() {
-	log.Print("[INFO] activate reporter")
+// SaveModeration saves moderation action to log channel, non-blocking and skip if needed
+func (l Reporter) SaveModeration(rec bot.ModerationRecord) {
+	bdata, err := json.Marshal(&rec)
+	if err != nil {
+		log.Printf("[WARN] failed to log moderation, error %v", err)
+		return
+	}
+
+	select {
+	case l.actions <- string(bdata) + "\n":
+	default:
+		log.Printf("[WARN] can't buffer moderation log entry %v", rec)
+	}
+}
+
+// activate writes entries to daily files with prefix
+func (l Reporter) activate(entries chan string, prefix string) {
+	log.Printf("[INFO] activate reporter %q", prefix)
 	buffer := make([]string, 0, 100)
 
 	writeBuff := func() error {
@@ -54,7 +73,7 @@ func (l Reporter) activate() {
 			return nil
 		}
 		// nolint
-		fh, err := os.OpenFile(fmt.Sprintf("%s/%s.log", l.logsPath, time.Now().Format("20060102")),
+		fh, err := os.OpenFile(fmt.Sprintf("%s/%s%s.log", l.logsPath, prefix, time.Now().Format("20060102")),
 			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0660)
 
 		if err != nil {
@@ -75,7 +94,7 @@ func (l Reporter) activate() {
 
 	for {
 		select {
-		case entry := <-l.messages:
+		case entry := <-entries:
 			buffer = append(buffer, entry)
 			if len(buffer) >= 100 { // forced flush every 100 records
 				if err := writeBuff(); err != nil {
@@ -42,3 +42,21 @@ func TestNewLogger(t *testing.T) {
 		})
 	}
 }
+
+func TestReporter_SaveModeration(t *testing.T) {
+	dir := t.TempDir()
+	reporter := NewLogger(dir)
+	reporter.SaveModeration(bot.ModerationRecord{User: bot.User{Username: "user"}, Action: "delete", Rule: "казино"})
+	reporter.Save(&msg)
+
+	time.Sleep(5500 * time.Millisecond) // flushed on inactivity
+	day := time.Now().Format("20060102")
+	data, err := os.ReadFile(fmt.Sprintf("%s/moderation-%s.log", dir, day))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"Action":"delete"`)
+	assert.Contains(t, string(data), `"Rule":"казино"`)
+
+	data, err = os.ReadFile(fmt.Sprintf("%s/%s.log", dir, day))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "казино", "messages log kept apart")
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt is a key-value storage keeping bots state across restarts in a single boltdb file.
+// Values are json-encoded, each bot uses its own bucket.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// NewBolt opens or creates boltdb file, creates parent directory if needed
+func NewBolt(fileName string) (*Bolt, error) {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to make directory for %s: %w", fileName, err)
+	}
+	db, err := bolt.Open(fileName, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", fileName, err)
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Load decodes value of the key into v, returns false if bucket or key not found
+func (b *Bolt) Load(bucket, key string, v interface{}) (found bool, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		data := bkt.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, v)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to load %s/%s: %w", bucket, key, err)
+	}
+	return found, nil
+}
+
+// Save stores json-encoded v with the key, bucket created if missing
+func (b *Bolt) Save(bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s/%s: %w", bucket, key, err)
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bkt, e := tx.CreateBucketIfNotExists([]byte(bucket))
+		if e != nil {
+			return e
+		}
+		return bkt.Put([]byte(key), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// Delete removes the key, missing bucket or key is not an error
+func (b *Bolt) Delete(bucket, key string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// Keys returns all keys of the bucket, sorted
+func (b *Bolt) Keys(bucket string) ([]string, error) {
+	res := []string{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, _ []byte) error {
+			res = append(res, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys of %s: %w", bucket, err)
+	}
+	return res, nil
+}
+
+// Close closes boltdb file
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBolt(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "sub", "state.db")
+	s, err := NewBolt(fileName)
+	require.NoError(t, err)
+
+	type rec struct {
+		Name string
+		TS   time.Time
+	}
+	ts := time.Date(2023, 3, 25, 12, 0, 0, 0, time.UTC)
+
+	var r rec
+	found, err := s.Load("bkt", "k1", &r)
+	require.NoError(t, err)
+	assert.False(t, found, "no bucket")
+
+	require.NoError(t, s.Save("bkt", "k1", rec{Name: "n1", TS: ts}))
+	require.NoError(t, s.Save("bkt", "k2", rec{Name: "n2"}))
+
+	found, err = s.Load("bkt", "k3", &r)
+	require.NoError(t, err)
+	assert.False(t, found, "no key")
+
+	found, err = s.Load("bkt", "k1", &r)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, rec{Name: "n1", TS: ts}, r)
+
+	keys, err := s.Keys("bkt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k1", "k2"}, keys)
+
+	require.NoError(t, s.Delete("bkt", "k1"))
+	require.NoError(t, s.Delete("no-bkt", "k1"))
+	keys, err = s.Keys("bkt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k2"}, keys)
+	require.NoError(t, s.Close())
+
+	// reopen to check state persisted
+	s, err = NewBolt(fileName)
+	require.NoError(t, err)
+	defer s.Close()
+	found, err = s.Load("bkt", "k2", &r)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "n2", r.Name)
+
+	keys, err = s.Keys("no-bkt")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}